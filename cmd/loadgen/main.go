@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	log "github.com/sirupsen/logrus" // Better Logging.
+	flag "github.com/spf13/pflag"    // POSIX/GNU-style CLI arguments.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/loadgen"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+)
+
+// serviceName identifies this binary, e.g. in logs.
+const serviceName = "kds-loadgen"
+
+func main() {
+	config := &loadgen.Config{}
+	config.RegisterFlags(flag.CommandLine)
+	logConfig := &logging.Config{}
+	logConfig.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if err := logConfig.Configure(serviceName); err != nil {
+		log.WithField("err", err).Fatal("invalid logging configuration")
+	}
+	mix, err := config.Validate()
+	if err != nil {
+		log.WithField("err", err).Fatal("invalid configuration")
+	}
+	apiKey, err := config.APIKey()
+	if err != nil {
+		log.WithField("err", err).Fatal("failed to read API key")
+	}
+
+	// Stop on SIGINT (ctrl+c), or once the configured duration elapsed, if any:
+	ctx, cancel := context.WithCancel(context.Background())
+	if config.Duration > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), config.Duration)
+	}
+	defer cancel()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	generator := loadgen.NewGenerator(config, mix, apiKey)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		generator.Run(ctx)
+	}()
+
+	// Report live, until done:
+	if config.ReportInterval > 0 {
+		ticker := time.NewTicker(config.ReportInterval)
+		defer ticker.Stop()
+	live:
+		for {
+			select {
+			case <-done:
+				break live
+			case <-ticker.C:
+				write(generator.Recorder().Live(), config.Output, os.Stdout)
+			}
+		}
+	}
+	<-done
+	write(generator.Recorder().Final(), config.Output, os.Stdout)
+}
+
+func write(report *loadgen.Report, output string, w io.Writer) {
+	var err error
+	if output == loadgen.JSONOutput {
+		err = report.WriteJSON(w)
+	} else {
+		err = report.WriteText(w)
+	}
+	if err != nil {
+		log.WithField("err", err).Error("failed to write report")
+	}
+}
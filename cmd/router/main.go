@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/gorilla/mux"         // Better HTTP API.
+	log "github.com/sirupsen/logrus" // Better Logging.
+	flag "github.com/spf13/pflag"    // POSIX/GNU-style CLI arguments.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/admin"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/metrics"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/router"
+)
+
+// serviceName identifies this binary, e.g. in logs.
+const serviceName = "kds-router"
+
+func main() {
+	config := &router.Config{}
+	config.RegisterFlags(flag.CommandLine)
+	adminConfig := &admin.Config{}
+	adminConfig.RegisterFlags(flag.CommandLine)
+	logConfig := &logging.Config{}
+	logConfig.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if err := logConfig.Configure(serviceName); err != nil {
+		log.WithField("err", err).Fatal("invalid logging configuration")
+	}
+	routing, err := config.Routing()
+	if err != nil {
+		log.WithField("err", err).Fatal("invalid configuration")
+	}
+	adminToken, err := adminConfig.Token()
+	if err != nil {
+		log.WithField("err", err).Fatal("failed to read admin token")
+	}
+
+	// Gracefully shut down on SIGINT (ctrl+c):
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+
+	// Metrics are served under /router/metrics, not to clash with backends' own:
+	registry := metrics.NewRegistry()
+	proxy := router.New(routing, registry)
+	ctx, cancel := context.WithCancel(context.Background())
+	go proxy.CheckHealth(ctx)
+
+	r := mux.NewRouter()
+	proxy.RegisterRoutes(r, adminToken)
+	httpServer := &http.Server{
+		Addr:    fmt.Sprintf("0.0.0.0:%v", config.Port),
+		Handler: r,
+		// No write timeout, for streams, e.g. /users/watch, to be proxied. Backends time out responses themselves.
+		ReadTimeout: 15 * time.Second,
+		IdleTimeout: 60 * time.Second,
+	}
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.WithField("addr", httpServer.Addr).WithField("err", err).Error("HTTP server stopped unexpectedly")
+		}
+	}()
+	for _, backend := range proxy.Backends() {
+		log.WithField("backend", backend.Name).WithField("url", backend.URL).WithField("weight", backend.Weight).WithField("canary", backend.Canary).Info("routing requests")
+	}
+
+	// Block until we receive the signal to quit:
+	<-stop
+
+	log.Info("shutting down...")
+	httpServer.Shutdown(context.Background())
+	cancel()
+	log.Info("bye!")
+	os.Exit(0)
+}
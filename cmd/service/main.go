@@ -6,67 +6,302 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 
 	"github.com/gorilla/mux"         // Better HTTP API.
 	log "github.com/sirupsen/logrus" // Better Logging.
 	flag "github.com/spf13/pflag"    // POSIX/GNU-style CLI arguments.
 
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/admin"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/auth"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/conf"
 	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/metrics"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/outbox"
 	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/server"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/tracing"
 )
 
+// serviceName identifies this service, e.g. in traces.
+const serviceName = "kds-service"
+
+// config gathers the configuration of all components of this service.
+type config struct {
+	db       *db.Config
+	dbFaults *db.FaultsConfig
+	cache    *db.CacheConfig
+	http     *server.Config
+	outbox   *outbox.Config
+	admin    *admin.Config
+	auth     *auth.Config
+	tracing  *tracing.Config
+	logging  *logging.Config
+}
+
 func main() {
-	dbConfig, httpConfig := parseCLIArguments()
+	config := parseCLIArguments()
 
 	// Gracefully shut down on SIGINT (ctrl+c):
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt)
 
 	// Create the database client:
-	db, err := db.NewPostgreSQLDB(dbConfig)
+	database, err := db.Open(config.db)
 	if err != nil {
 		log.WithField("err", err).Fatal("failed to create database client")
 	}
 
+	// Relay user events to downstream systems, if configured to:
+	ctx, cancel := context.WithCancel(context.Background())
+	sink, err := config.outbox.NewSink()
+	if err != nil {
+		log.WithField("err", err).Fatal("failed to create events sink")
+	}
+	var relays sync.WaitGroup
+	if sink != nil {
+		events, ok := database.(db.Outbox)
+		if !ok {
+			log.WithField("db", fmt.Sprintf("%T", database)).Fatal("database does not record events to relay")
+		}
+		relay := outbox.NewRelay(events, sink, config.outbox)
+		relays.Add(1)
+		go func() {
+			defer relays.Done()
+			relay.Run(ctx)
+		}()
+	}
+
+	// Inject faults in calls to the database, if configured to, or later on via the admin endpoints:
+	faults, err := config.dbFaults.Faults()
+	if err != nil {
+		log.WithField("err", err).Fatal("invalid DB faults")
+	}
+	faultyDB, err := db.NewFaultyDB(database, faults)
+	if err != nil {
+		log.WithField("err", err).Fatal("failed to create faulty database client")
+	}
+
+	// Metrics are served under /metrics:
+	registry := metrics.NewRegistry()
+
+	// Cache users read by ID, if configured to, in front of the faulty database, to show the difference caching makes:
+	if err := config.cache.Validate(); err != nil {
+		log.WithField("err", err).Fatal("invalid cache configuration")
+	}
+	var served db.DB = faultyDB
+	if config.cache.Enabled() {
+		cachedDB, err := db.NewCachedDB(faultyDB, config.cache.Size, config.cache.TTL)
+		if err != nil {
+			log.WithField("err", err).Fatal("failed to create cached database client")
+		}
+		cachedDB.RegisterMetrics(registry)
+		served = cachedDB
+	}
+
+	// Admin endpoints are only served if an admin token is configured:
+	adminToken, err := config.admin.Token()
+	if err != nil {
+		log.WithField("err", err).Fatal("failed to read admin token")
+	}
+
+	// Inject faults in HTTP responses, if configured to, or later on via the admin endpoints:
+	profile, err := config.http.Profile()
+	if err != nil {
+		log.WithField("err", err).Fatal("invalid HTTP faults")
+	}
+	injector, err := server.NewFaultInjector(profile)
+	if err != nil {
+		log.WithField("err", err).Fatal("failed to create HTTP faults injector")
+	}
+
+	// Rate limit clients and shed load, if configured to:
+	limits, err := config.http.Limits()
+	if err != nil {
+		log.WithField("err", err).Fatal("invalid HTTP limits")
+	}
+	limiter, err := server.NewLimiter(limits, registry)
+	if err != nil {
+		log.WithField("err", err).Fatal("failed to create HTTP limiter")
+	}
+
+	// Authenticate clients, if configured to:
+	authenticator, err := config.auth.Authenticator()
+	if err != nil {
+		log.WithField("err", err).Fatal("failed to configure authentication")
+	}
+
+	// Serve HTTPS, if configured to, reloading the certificate when it changes:
+	reloader, err := config.http.CertReloader()
+	if err != nil {
+		log.WithField("err", err).Fatal("invalid TLS configuration")
+	}
+	if reloader != nil {
+		go reloader.Watch(ctx, config.http.TLSReloadInterval)
+	}
+
+	// Trace requests, down to database queries, if configured to:
+	tracer, err := config.tracing.Tracer(serviceName)
+	if err != nil {
+		log.WithField("err", err).Fatal("failed to configure tracing")
+	}
+
+	// Advertise v1's deprecation, if configured to:
+	deprecation, err := config.http.V1Deprecation()
+	if err != nil {
+		log.WithField("err", err).Fatal("invalid API deprecation")
+	}
+
+	// Cache statistics about users, if configured to:
+	statsCache, err := config.http.StatsCache()
+	if err != nil {
+		log.WithField("err", err).Fatal("invalid stats cache")
+	}
+
 	// Create the HTTP server:
-	httpServer := newHTTPServer(httpConfig, db)
+	api := server.New(served)
+	api.DeprecateV1(deprecation)
+	if statsCache != nil {
+		api.CacheStats(statsCache)
+	}
+	if tracer != nil {
+		api.Trace(tracer)
+	}
+	api.InjectFaults(injector)
+	api.LimitRequests(limiter)
+	if authenticator != nil {
+		api.Authenticate(authenticator)
+	}
+	api.ExposeMetrics(registry)
+	router := mux.NewRouter()
+	api.RegisterRoutes(router)
+	httpServers := []*http.Server{newHTTPServer(config.http, config.http.Port, router)}
+	if reloader != nil {
+		httpServers[0].TLSConfig = reloader.TLSConfig()
+	}
 
-	// Run the server in a goroutine so that it doesn't block:
-	go func() {
-		if err := httpServer.ListenAndServe(); err != nil {
-			log.WithField("err", err).Error("HTTP server stopped unexpectedly")
+	// Serve admin endpoints on their own port, if configured to, or alongside the API otherwise:
+	if len(adminToken) > 0 {
+		adminServer := admin.New(adminToken, faultyDB, injector)
+		adminServer.ExposeConfig(flag.CommandLine)
+		if config.http.AdminPort > 0 {
+			adminRouter := mux.NewRouter()
+			adminRouter.Use(server.LogRequests)
+			adminServer.RegisterRoutes(adminRouter)
+			adminHTTPServer := newHTTPServer(config.http, config.http.AdminPort, adminRouter)
+			adminHTTPServer.WriteTimeout = 0 // For CPU profiles and execution traces, which last 30s by default, to complete.
+			httpServers = append(httpServers, adminHTTPServer)
+		} else {
+			adminServer.RegisterRoutes(router)
 		}
-	}()
+	} else if config.http.AdminPort > 0 {
+		log.WithField("port", config.http.AdminPort).Fatal("admin endpoints are disabled: --admin-port requires --admin-token-file")
+	}
+
+	// Serve health checks over plain HTTP too, if configured to, e.g. for Kubernetes probes:
+	if config.http.PlaintextPort > 0 {
+		probes := mux.NewRouter()
+		api.RegisterProbeRoutes(probes)
+		httpServers = append(httpServers, newHTTPServer(config.http, config.http.PlaintextPort, probes))
+	}
+
+	// Run the servers in goroutines so that these don't block:
+	for _, httpServer := range httpServers {
+		go serve(httpServer)
+	}
 
 	// Block until we receive the signal to quit:
 	<-stop
 
 	log.Info("shutting down...")
-	httpServer.Shutdown(context.Background())
+	for _, httpServer := range httpServers {
+		httpServer.Shutdown(context.Background())
+	}
+	cancel()
+	if tracer != nil {
+		tracer.Close() // Exports the remaining spans.
+	}
+	// Wait for the relay to stop before closing the sink it may still be publishing to:
+	relays.Wait()
+	if sink != nil {
+		sink.Close()
+	}
+	// Close the database client last, once nothing uses it anymore, e.g. to stop compacting its file, or to close its connections:
+	if err := served.Close(); err != nil {
+		log.WithField("err", err).Error("failed to close database client")
+	}
 	log.Info("bye!")
 	os.Exit(0)
 }
 
-func parseCLIArguments() (*db.Config, *server.Config) {
-	// Parse CLI arguments into config object:
-	dbConfig := &db.Config{}
-	dbConfig.RegisterFlags(flag.CommandLine)
-	httpConfig := &server.Config{}
-	httpConfig.RegisterFlags(flag.CommandLine)
+// parseCLIArguments parses CLI arguments, environment variables, and the configuration file, if any, into a config object.
+// It also runs the "config print" command, which prints the effective configuration, if provided.
+func parseCLIArguments() *config {
+	config := &config{
+		db:       &db.Config{},
+		dbFaults: &db.FaultsConfig{},
+		cache:    &db.CacheConfig{},
+		http:     &server.Config{},
+		outbox:   &outbox.Config{},
+		admin:    &admin.Config{},
+		auth:     &auth.Config{},
+		tracing:  &tracing.Config{},
+		logging:  &logging.Config{},
+	}
+	config.db.RegisterFlags(flag.CommandLine)
+	config.dbFaults.RegisterFlags(flag.CommandLine)
+	config.cache.RegisterFlags(flag.CommandLine)
+	config.http.RegisterFlags(flag.CommandLine)
+	config.outbox.RegisterFlags(flag.CommandLine)
+	config.admin.RegisterFlags(flag.CommandLine)
+	config.auth.RegisterFlags(flag.CommandLine)
+	config.tracing.RegisterFlags(flag.CommandLine)
+	config.logging.RegisterFlags(flag.CommandLine)
+	loader := &conf.Loader{}
+	loader.RegisterFlags(flag.CommandLine)
 	flag.Parse()
-	return dbConfig, httpConfig
+	// The configuration may contain secrets, and fail to load, before logging is configured, hence redact logs already:
+	logging.RedactStandardLogger()
+	if err := loader.Load(flag.CommandLine, os.Environ()); err != nil {
+		log.WithField("err", err).Fatal("invalid configuration")
+	}
+	if err := config.logging.Configure(serviceName); err != nil {
+		log.WithField("err", err).Fatal("invalid logging configuration")
+	}
+	switch args := flag.Args(); {
+	case len(args) == 0:
+		return config
+	case len(args) == 2 && args[0] == "config" && args[1] == "print":
+		if err := loader.Print(os.Stdout, flag.CommandLine); err != nil {
+			log.WithField("err", err).Fatal("failed to print configuration")
+		}
+		os.Exit(0)
+	default:
+		log.WithField("args", args).Fatal("unknown command: expected none, or \"config print\"")
+	}
+	return config
 }
 
-func newHTTPServer(httpConfig *server.Config, db db.DB) *http.Server {
-	server := server.New(db)
-	router := mux.NewRouter()
-	server.RegisterRoutes(router)
+func newHTTPServer(httpConfig *server.Config, port int, handler http.Handler) *http.Server {
 	return &http.Server{
-		Addr:    fmt.Sprintf("0.0.0.0:%v", httpConfig.Port),
-		Handler: router,
+		Addr:    fmt.Sprintf("0.0.0.0:%v", port),
+		Handler: handler,
 		// Good practice to set timeouts to avoid Slowloris attacks.
 		ReadTimeout:  httpConfig.ReadTimeout,
 		WriteTimeout: httpConfig.WriteTimeout,
 		IdleTimeout:  httpConfig.IdleTimeout,
 	}
 }
+
+// serve serves HTTPS if the provided server has a TLS configuration, or plain HTTP otherwise, until it is shut down.
+func serve(httpServer *http.Server) {
+	var err error
+	if httpServer.TLSConfig != nil {
+		err = httpServer.ListenAndServeTLS("", "") // The certificate is provided by the TLS configuration.
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		log.WithField("addr", httpServer.Addr).WithField("err", err).Error("HTTP server stopped unexpectedly")
+	}
+}
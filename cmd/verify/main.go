@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	log "github.com/sirupsen/logrus" // Better Logging.
+	flag "github.com/spf13/pflag"    // POSIX/GNU-style CLI arguments.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/verify"
+)
+
+// serviceName identifies this binary, e.g. in logs.
+const serviceName = "kds-verify"
+
+// Exit codes, e.g. for a Kubernetes Job to be retried, or reported as failed.
+const (
+	exitPassed = 0
+	exitFailed = 1
+	exitError  = 2 // The verification could not run, e.g. because of invalid arguments.
+)
+
+func main() {
+	config := &verify.Config{}
+	config.RegisterFlags(flag.CommandLine)
+	logConfig := &logging.Config{}
+	logConfig.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if err := logConfig.Configure(serviceName); err != nil {
+		log.WithField("err", err).Error("invalid logging configuration")
+		os.Exit(exitError)
+	}
+	if err := config.Validate(); err != nil {
+		log.WithField("err", err).Error("invalid configuration")
+		os.Exit(exitError)
+	}
+	apiKey, err := config.APIKey()
+	if err != nil {
+		log.WithField("err", err).Error("failed to read API key")
+		os.Exit(exitError)
+	}
+
+	// Stop on SIGINT (ctrl+c):
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	report := verify.New(config, apiKey).Run(ctx)
+	if config.Output == verify.JSONOutput {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		log.WithField("err", err).Error("failed to write report")
+		os.Exit(exitError)
+	}
+	if !report.Passed {
+		os.Exit(exitFailed)
+	}
+	os.Exit(exitPassed)
+}
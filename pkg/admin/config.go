@@ -0,0 +1,40 @@
+package admin
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag" // POSIX/GNU-style CLI arguments.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+)
+
+// Config encapsulates the input required to configure the admin endpoints.
+type Config struct {
+	tokenFile string
+}
+
+const adminTokenFile = "admin-token-file"
+
+// RegisterFlags maps the provided CLI arguments to fields in this configuration object.
+func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
+	f.StringVar(&cfg.tokenFile, adminTokenFile, "", "File containing the bearer token required to call admin endpoints. Admin endpoints are disabled if empty")
+}
+
+// Token reads the admin token from the configured file, or returns an empty token if admin endpoints are disabled.
+func (cfg Config) Token() (string, error) {
+	if len(cfg.tokenFile) == 0 {
+		return "", nil
+	}
+	bytes, err := ioutil.ReadFile(cfg.tokenFile)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read admin token file")
+	}
+	token := strings.TrimSpace(string(bytes))
+	if len(token) == 0 {
+		return "", errors.New("invalid admin token: file is empty")
+	}
+	logging.AddSecret(token)
+	return token, nil
+}
@@ -0,0 +1,43 @@
+package admin_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	flag "github.com/spf13/pflag"        // POSIX/GNU-style CLI arguments.
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/admin"
+)
+
+func TestParsingEmptyArgumentsShouldDisableAdminEndpoints(t *testing.T) {
+	config := parseArgs(t, []string{})
+	token, err := config.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "", token)
+}
+
+func TestParsingArgumentsShouldReadTokenFromFile(t *testing.T) {
+	tokenFile, err := ioutil.TempFile(os.TempDir(), "token")
+	assert.NoError(t, err)
+	defer os.Remove(tokenFile.Name()) // Clean-up.
+	_, err = tokenFile.Write([]byte("s3cr3t\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, tokenFile.Close())
+
+	config := parseArgs(t, []string{"--admin-token-file", tokenFile.Name()})
+	token, err := config.Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", token)
+}
+
+// Utility function to create a Config object, register CLI arguments, and parse them.
+func parseArgs(t *testing.T, args []string) *admin.Config {
+	config := admin.Config{}
+	cli := flag.NewFlagSet("service-test", flag.ContinueOnError)
+	config.RegisterFlags(cli)
+	err := cli.Parse(args)
+	assert.NoError(t, err)
+	return &config
+}
@@ -0,0 +1,139 @@
+package admin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/pprof" // Also registers its handlers on http.DefaultServeMux, which is not served.
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"time"
+
+	"github.com/gorilla/mux"         // Better HTTP API.
+	log "github.com/sirupsen/logrus" // Better Logging.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/conf"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+)
+
+// LogLevel is the level of the logs written by this process, e.g. "debug".
+type LogLevel struct {
+	Level string `json:"level"`
+}
+
+// MemStats are statistics about this process' memory and garbage collector, a subset of runtime.MemStats.
+type MemStats struct {
+	Goroutines    int       `json:"goroutines"`
+	HeapAlloc     uint64    `json:"heapAlloc"`   // Bytes of allocated heap objects.
+	HeapInuse     uint64    `json:"heapInuse"`   // Bytes in in-use heap spans.
+	HeapObjects   uint64    `json:"heapObjects"` // Number of allocated heap objects.
+	Sys           uint64    `json:"sys"`         // Bytes of memory obtained from the OS.
+	TotalAlloc    uint64    `json:"totalAlloc"`  // Cumulative bytes allocated for heap objects.
+	Mallocs       uint64    `json:"mallocs"`
+	Frees         uint64    `json:"frees"`
+	NumGC         uint32    `json:"numGC"`
+	LastGC        time.Time `json:"lastGC"`
+	PauseTotal    string    `json:"pauseTotal"` // Cumulative stop-the-world pauses, e.g. "12.5ms".
+	GCCPUFraction float64   `json:"gcCPUFraction"`
+	NextGC        uint64    `json:"nextGC"` // Target heap size of the next garbage collection.
+}
+
+// registerRuntimeRoutes registers the routes to inspect and tune this process at runtime, e.g. to diagnose a
+// misbehaving canary without redeploying it.
+func (server *Server) registerRuntimeRoutes(admin *mux.Router) {
+	admin.Handle("/log/level", server.authenticate(server.ReadLogLevelHandler)).Methods("GET").Name("admin_log_level")
+	admin.Handle("/log/level", server.authenticate(server.UpdateLogLevelHandler)).Methods("PUT").Name("admin_log_level")
+	admin.Handle("/config", server.authenticate(server.ConfigHandler)).Methods("GET").Name("admin_config")
+	admin.Handle("/memstats", server.authenticate(server.MemStatsHandler)).Methods("GET").Name("admin_memstats")
+	admin.Handle("/debug/goroutines", server.authenticate(server.GoroutinesHandler)).Methods("GET").Name("admin_debug_goroutines")
+	admin.Handle("/debug/pprof/", server.authenticate(pprof.Index)).Methods("GET").Name("admin_debug_pprof")
+	admin.Handle("/debug/pprof/cmdline", server.authenticate(pprof.Cmdline)).Methods("GET").Name("admin_debug_pprof_cmdline")
+	admin.Handle("/debug/pprof/profile", server.authenticate(pprof.Profile)).Methods("GET").Name("admin_debug_pprof_profile")
+	admin.Handle("/debug/pprof/symbol", server.authenticate(pprof.Symbol)).Methods("GET", "POST").Name("admin_debug_pprof_symbol")
+	admin.Handle("/debug/pprof/trace", server.authenticate(pprof.Trace)).Methods("GET").Name("admin_debug_pprof_trace")
+	admin.Handle("/debug/pprof/{profile}", server.authenticate(server.ProfileHandler)).Methods("GET").Name("admin_debug_pprof_profiles")
+}
+
+// ReadLogLevelHandler returns the current log level.
+func (server *Server) ReadLogLevelHandler(resp http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	writeJSON(resp, logger, LogLevel{Level: log.GetLevel().String()})
+}
+
+// UpdateLogLevelHandler changes the log level, e.g. to "debug" to log database queries, until changed back or restarted.
+func (server *Server) UpdateLogLevelHandler(resp http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	bytes, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(resp, logger, err, "failed to read request's body", http.StatusInternalServerError)
+		return
+	}
+	level := LogLevel{}
+	if err := json.Unmarshal(bytes, &level); err != nil {
+		writeError(resp, logger, err, "failed to deserialise log level", http.StatusBadRequest)
+		return
+	}
+	parsed, err := log.ParseLevel(level.Level)
+	if err != nil {
+		writeError(resp, logger, err, "invalid log level", http.StatusBadRequest)
+		return
+	}
+	previous := log.GetLevel()
+	log.SetLevel(parsed)
+	// Logged at warning level, so that it is logged unless only errors are:
+	logger.WithField("from", previous.String()).WithField("to", parsed.String()).Warn("updated log level")
+	writeJSON(resp, logger, LogLevel{Level: parsed.String()})
+}
+
+// ConfigHandler returns the effective configuration of this process, as flags mapped to their values, with secrets redacted.
+func (server *Server) ConfigHandler(resp http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	if server.flags == nil {
+		writeJSON(resp, logger, map[string]interface{}{})
+		return
+	}
+	writeJSON(resp, logger, conf.Values(server.flags))
+}
+
+// MemStatsHandler returns statistics about this process' memory and garbage collector.
+func (server *Server) MemStatsHandler(resp http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	stats := runtime.MemStats{}
+	runtime.ReadMemStats(&stats)
+	writeJSON(resp, logger, MemStats{
+		Goroutines:    runtime.NumGoroutine(),
+		HeapAlloc:     stats.HeapAlloc,
+		HeapInuse:     stats.HeapInuse,
+		HeapObjects:   stats.HeapObjects,
+		Sys:           stats.Sys,
+		TotalAlloc:    stats.TotalAlloc,
+		Mallocs:       stats.Mallocs,
+		Frees:         stats.Frees,
+		NumGC:         stats.NumGC,
+		LastGC:        time.Unix(0, int64(stats.LastGC)).UTC(),
+		PauseTotal:    time.Duration(stats.PauseTotalNs).String(),
+		GCCPUFraction: stats.GCCPUFraction,
+		NextGC:        stats.NextGC,
+	})
+}
+
+// GoroutinesHandler dumps the stack traces of all goroutines, as plain text, in the same format as an unrecovered panic.
+func (server *Server) GoroutinesHandler(resp http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	resp.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	resp.WriteHeader(http.StatusOK)
+	if err := runtimepprof.Lookup("goroutine").WriteTo(resp, 2); err != nil {
+		logger.WithField("err", err).Error("failed to write response")
+	}
+}
+
+// ProfileHandler serves the runtime profile named in the path, e.g. heap, as net/http/pprof would under /debug/pprof/.
+// It is needed as pprof.Index only serves profiles under /debug/pprof/, and not under /admin/debug/pprof/.
+func (server *Server) ProfileHandler(resp http.ResponseWriter, req *http.Request) {
+	name := mux.Vars(req)["profile"]
+	if runtimepprof.Lookup(name) == nil {
+		http.Error(resp, "unknown profile: "+name, http.StatusNotFound)
+		return
+	}
+	pprof.Handler(name).ServeHTTP(resp, req)
+}
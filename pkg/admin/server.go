@@ -0,0 +1,136 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gorilla/mux"         // Better HTTP API.
+	log "github.com/sirupsen/logrus" // Better Logging.
+	flag "github.com/spf13/pflag"    // POSIX/GNU-style CLI arguments.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+	httpserver "github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/server"
+)
+
+// Server serves admin endpoints, e.g. to adjust the faults injected at runtime, or to profile this process,
+// to callers presenting the admin token.
+type Server struct {
+	token    string
+	faultyDB *db.FaultyDB
+	injector *httpserver.FaultInjector
+	flags    *flag.FlagSet
+}
+
+// New creates a new admin server.
+func New(token string, faultyDB *db.FaultyDB, injector *httpserver.FaultInjector) *Server {
+	return &Server{
+		token:    token,
+		faultyDB: faultyDB,
+		injector: injector,
+	}
+}
+
+// ExposeConfig serves the effective configuration, as per the provided flags, under /admin/config, with secrets redacted.
+func (server *Server) ExposeConfig(f *flag.FlagSet) {
+	server.flags = f
+}
+
+// RegisterRoutes registers the admin HTTP routes, under /admin, to the provided mux.Router.
+func (server *Server) RegisterRoutes(router *mux.Router) {
+	// N.B.: routes' names start with server.AdminRoutePrefix, for these to never be limited nor faulty:
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.Handle("/faults/db", server.authenticate(server.ReadDBFaultsHandler)).Methods("GET").Name("admin_faults_db")
+	admin.Handle("/faults/db", server.authenticate(server.UpdateDBFaultsHandler)).Methods("PUT").Name("admin_faults_db")
+	admin.Handle("/faults/http", server.authenticate(server.ReadHTTPFaultsHandler)).Methods("GET").Name("admin_faults_http")
+	admin.Handle("/faults/http", server.authenticate(server.UpdateHTTPFaultsHandler)).Methods("PUT").Name("admin_faults_http")
+	server.registerRuntimeRoutes(admin)
+}
+
+// authenticate only lets requests bearing the admin token through.
+func (server *Server) authenticate(handler http.HandlerFunc) http.Handler {
+	expected := []byte("Bearer " + server.token)
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), expected) != 1 {
+			logging.FromContext(req.Context()).Warn("unauthorised admin request")
+			resp.Header().Set("WWW-Authenticate", "Bearer")
+			resp.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler(resp, req)
+	})
+}
+
+// ReadDBFaultsHandler returns the faults currently injected in calls to the database.
+func (server *Server) ReadDBFaultsHandler(resp http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	writeJSON(resp, logger, server.faultyDB.Faults())
+}
+
+// UpdateDBFaultsHandler replaces the faults injected in calls to the database.
+func (server *Server) UpdateDBFaultsHandler(resp http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	bytes, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(resp, logger, err, "failed to read request's body", http.StatusInternalServerError)
+		return
+	}
+	faults := db.Faults{}
+	if err := json.Unmarshal(bytes, &faults); err != nil {
+		writeError(resp, logger, err, "failed to deserialise faults", http.StatusBadRequest)
+		return
+	}
+	if err := server.faultyDB.SetFaults(faults); err != nil {
+		writeError(resp, logger, err, "invalid faults", http.StatusBadRequest)
+		return
+	}
+	logger.WithField("faults", string(bytes)).Info("updated DB faults")
+	writeJSON(resp, logger, server.faultyDB.Faults())
+}
+
+// ReadHTTPFaultsHandler returns the profile of faults currently injected in HTTP responses.
+func (server *Server) ReadHTTPFaultsHandler(resp http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	writeJSON(resp, logger, server.injector.Profile())
+}
+
+// UpdateHTTPFaultsHandler replaces the profile of faults injected in HTTP responses.
+func (server *Server) UpdateHTTPFaultsHandler(resp http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	bytes, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(resp, logger, err, "failed to read request's body", http.StatusInternalServerError)
+		return
+	}
+	profile := httpserver.FaultProfile{}
+	if err := json.Unmarshal(bytes, &profile); err != nil {
+		writeError(resp, logger, err, "failed to deserialise faults", http.StatusBadRequest)
+		return
+	}
+	if err := server.injector.SetProfile(profile); err != nil {
+		writeError(resp, logger, err, "invalid faults", http.StatusBadRequest)
+		return
+	}
+	logger.WithField("faults", string(bytes)).Info("updated HTTP faults")
+	writeJSON(resp, logger, server.injector.Profile())
+}
+
+func writeError(resp http.ResponseWriter, logger *log.Entry, err error, message string, status int) {
+	logger.WithField("err", err).Error(message)
+	http.Error(resp, message+": "+err.Error(), status)
+}
+
+func writeJSON(resp http.ResponseWriter, logger *log.Entry, value interface{}) {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		writeError(resp, logger, err, "failed to serialise response as JSON", http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(http.StatusOK)
+	if _, err := resp.Write(bytes); err != nil {
+		logger.WithField("err", err).Error("failed to write response")
+	}
+}
@@ -0,0 +1,82 @@
+package admin_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"             // Better HTTP API.
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/admin"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/server"
+)
+
+const token = "s3cr3t"
+
+func TestAdminEndpointsShouldRequireToken(t *testing.T) {
+	router := newRouter(t)
+
+	resp := serve(router, "GET", "/admin/faults/db", "", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Equal(t, "Bearer", resp.Header().Get("WWW-Authenticate"))
+
+	resp = serve(router, "GET", "/admin/faults/db", "not-the-token", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestAdminEndpointsShouldReadAndUpdateDBFaults(t *testing.T) {
+	router := newRouter(t)
+
+	resp := serve(router, "GET", "/admin/faults/db", token, "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "{}", resp.Body.String())
+
+	resp = serve(router, "PUT", "/admin/faults/db", token, "{\"CreateUser\":{\"latency\":\"uniform:10ms-50ms\",\"errorRate\":0.5}}")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "{\"CreateUser\":{\"latency\":\"uniform:10ms-50ms\",\"errorRate\":0.5}}", resp.Body.String())
+
+	resp = serve(router, "PUT", "/admin/faults/db", token, "{\"CreateUser\":{\"errorRate\":1.5}}")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestAdminEndpointsShouldReadAndUpdateHTTPFaults(t *testing.T) {
+	router := newRouter(t)
+
+	resp := serve(router, "GET", "/admin/faults/http", token, "")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "{\"faults\":[]}", resp.Body.String())
+
+	resp = serve(router, "PUT", "/admin/faults/http", token, "{\"name\":\"bad-release\",\"faults\":[{\"route\":\"users\",\"percentage\":10,\"status\":503}]}")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "{\"name\":\"bad-release\",\"faults\":[{\"route\":\"users\",\"percentage\":10,\"status\":503}]}", resp.Body.String())
+
+	resp = serve(router, "PUT", "/admin/faults/http", token, "{\"faults\":[{\"route\":\"users\",\"percentage\":150}]}")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func newRouter(t *testing.T, options ...func(*admin.Server)) *mux.Router {
+	faultyDB, err := db.NewFaultyDB(db.NewInMemoryDB(), nil)
+	assert.NoError(t, err)
+	injector, err := server.NewFaultInjector(server.FaultProfile{})
+	assert.NoError(t, err)
+	adminServer := admin.New(token, faultyDB, injector)
+	for _, option := range options {
+		option(adminServer)
+	}
+	router := mux.NewRouter()
+	adminServer.RegisterRoutes(router)
+	return router
+}
+
+func serve(router *mux.Router, verb, uri, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(verb, uri, bytes.NewReader([]byte(body)))
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	return resp
+}
@@ -0,0 +1,123 @@
+// Package auth authenticates clients, via HMAC-signed JWTs or static API keys, and checks the scopes they were granted.
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+)
+
+// Scopes granted to clients, and required by routes.
+const (
+	ScopeUsersRead    = "users:read"
+	ScopeUsersWrite   = "users:write"
+	ScopeEventsReplay = "events:replay"
+)
+
+// APIKeyHeader is the header clients present their API key in.
+const APIKeyHeader = "X-API-Key"
+
+// ErrUnauthenticated is returned when a request bears no credentials, or invalid ones.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Principal is an authenticated client.
+type Principal struct {
+	Subject string
+	Scopes  []string
+}
+
+// HasScope returns whether this principal was granted the provided scope.
+func (principal Principal) HasScope(scope string) bool {
+	for _, granted := range principal.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator authenticates requests bearing a JWT, as "Authorization: Bearer <JWT>", or an API key, in the X-API-Key header.
+type Authenticator struct {
+	jwtKeys map[string][]byte      // Keyed by key ID.
+	apiKeys map[[32]byte]Principal // Keyed by the SHA-256 of the API key, so that looking keys up does not leak them through timing.
+	now     func() time.Time
+}
+
+// NewAuthenticator creates a new Authenticator, accepting JWTs signed with any of the provided keys, indexed by key ID,
+// and the provided API keys, granted the provided scopes.
+func NewAuthenticator(jwtKeys map[string][]byte, apiKeys map[string][]string) (*Authenticator, error) {
+	if len(jwtKeys) == 0 && len(apiKeys) == 0 {
+		return nil, errors.New("no JWT key nor API key configured")
+	}
+	authenticator := &Authenticator{
+		jwtKeys: make(map[string][]byte, len(jwtKeys)),
+		apiKeys: make(map[[32]byte]Principal, len(apiKeys)),
+		now:     time.Now,
+	}
+	for id, key := range jwtKeys {
+		if len(key) < minKeyLength {
+			return nil, errors.New("invalid JWT key " + id + ": too short, expected at least 32 bytes")
+		}
+		authenticator.jwtKeys[id] = key
+	}
+	for key, scopes := range apiKeys {
+		hash := sha256.Sum256([]byte(key))
+		authenticator.apiKeys[hash] = Principal{Subject: "api-key:" + fingerprint(hash), Scopes: scopes}
+	}
+	return authenticator, nil
+}
+
+// minKeyLength is the minimum length of JWT keys, as per RFC 7518, section 3.2, for HS256.
+const minKeyLength = 32
+
+// fingerprint identifies API keys in logs without leaking them.
+func fingerprint(hash [32]byte) string {
+	const hex = "0123456789abcdef"
+	bytes := make([]byte, 8)
+	for i := 0; i < 4; i++ {
+		bytes[2*i] = hex[hash[i]>>4]
+		bytes[2*i+1] = hex[hash[i]&0x0f]
+	}
+	return string(bytes)
+}
+
+// Authenticate returns the client which sent the provided request, or ErrUnauthenticated.
+func (authenticator *Authenticator) Authenticate(req *http.Request) (*Principal, error) {
+	if key := req.Header.Get(APIKeyHeader); len(key) > 0 {
+		if principal, ok := authenticator.apiKeys[sha256.Sum256([]byte(key))]; ok {
+			return &principal, nil
+		}
+		return nil, ErrUnauthenticated
+	}
+	authorization := req.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return nil, ErrUnauthenticated
+	}
+	return authenticator.verify(strings.TrimPrefix(authorization, "Bearer "))
+}
+
+// Require only lets requests from clients granted the provided scope through to the provided handler,
+// rejecting others with 401 Unauthorized, if not authenticated, or 403 Forbidden, if not granted the scope.
+func (authenticator *Authenticator) Require(scope string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		logger := logging.FromContext(req.Context())
+		principal, err := authenticator.Authenticate(req)
+		if err != nil {
+			logger.WithField("err", err).Debug("unauthenticated request")
+			resp.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(resp, "unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		if !principal.HasScope(scope) {
+			logger.WithField("subject", principal.Subject).WithField("scope", scope).Warn("forbidden request: missing scope")
+			resp.Header().Set("WWW-Authenticate", "Bearer error=\"insufficient_scope\", scope=\""+scope+"\"")
+			http.Error(resp, "forbidden: missing scope "+scope, http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(resp, req)
+	})
+}
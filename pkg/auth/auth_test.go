@@ -0,0 +1,117 @@
+package auth_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/auth"
+)
+
+var (
+	oldKey = []byte("0123456789abcdef0123456789abcdef")
+	newKey = []byte("fedcba9876543210fedcba9876543210")
+)
+
+func TestAuthenticateShouldAcceptJWTsSignedWithAnyActiveKey(t *testing.T) {
+	authenticator := newAuthenticator(t)
+	for _, token := range []string{
+		newJWT(t, "2026-09", oldKey, time.Hour),
+		newJWT(t, "2026-10", newKey, time.Hour),
+		newJWT(t, "", newKey, time.Hour), // Without key ID, all keys are tried.
+	} {
+		principal, err := authenticator.Authenticate(withBearer(token))
+		assert.NoError(t, err)
+		assert.Equal(t, &auth.Principal{Subject: "loadgen", Scopes: []string{auth.ScopeUsersRead}}, principal)
+	}
+}
+
+func TestAuthenticateShouldRejectInvalidJWTs(t *testing.T) {
+	authenticator := newAuthenticator(t)
+	valid := newJWT(t, "2026-10", newKey, time.Hour)
+	parts := strings.Split(valid, ".")
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin","exp":9999999999,"scope":"users:write"}`)) + "." + parts[2]
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+	for _, token := range []string{
+		"",
+		"not-a-jwt",
+		newJWT(t, "2026-09", newKey, time.Hour), // Signed with another key than the one identified.
+		newJWT(t, "", []byte("not-an-active-key-not-an-active-key"), time.Hour), // Signed with an unknown key.
+		newJWT(t, "2026-10", newKey, -time.Hour),                                // Expired.
+		tampered,
+		unsigned,
+	} {
+		_, err := authenticator.Authenticate(withBearer(token))
+		assert.Error(t, err, token)
+	}
+}
+
+func TestAuthenticateShouldAcceptAPIKeys(t *testing.T) {
+	authenticator := newAuthenticator(t)
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set(auth.APIKeyHeader, "k3y")
+	principal, err := authenticator.Authenticate(req)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{auth.ScopeUsersRead, auth.ScopeUsersWrite}, principal.Scopes)
+	assert.NotContains(t, principal.Subject, "k3y")
+
+	req.Header.Set(auth.APIKeyHeader, "not-the-key")
+	_, err = authenticator.Authenticate(req)
+	assert.Equal(t, auth.ErrUnauthenticated, err)
+}
+
+func TestRequireShouldRejectUnauthenticatedAndUnauthorisedRequests(t *testing.T) {
+	authenticator := newAuthenticator(t)
+	handler := authenticator.Require(auth.ScopeUsersWrite, http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusCreated)
+	}))
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("POST", "/users", nil))
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Equal(t, "Bearer", resp.Header().Get("WWW-Authenticate"))
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, withBearer(newJWT(t, "2026-10", newKey, time.Hour)))
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Equal(t, "Bearer error=\"insufficient_scope\", scope=\"users:write\"", resp.Header().Get("WWW-Authenticate"))
+
+	resp = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/users", nil)
+	req.Header.Set(auth.APIKeyHeader, "k3y")
+	handler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+}
+
+func TestNewAuthenticatorShouldRejectShortKeys(t *testing.T) {
+	_, err := auth.NewAuthenticator(map[string][]byte{"short": []byte("s3cr3t")}, nil)
+	assert.EqualError(t, err, "invalid JWT key short: too short, expected at least 32 bytes")
+	_, err = auth.NewAuthenticator(nil, nil)
+	assert.EqualError(t, err, "no JWT key nor API key configured")
+}
+
+func newAuthenticator(t *testing.T) *auth.Authenticator {
+	authenticator, err := auth.NewAuthenticator(
+		map[string][]byte{"2026-09": oldKey, "2026-10": newKey},
+		map[string][]string{"k3y": {auth.ScopeUsersRead, auth.ScopeUsersWrite}},
+	)
+	assert.NoError(t, err)
+	return authenticator
+}
+
+func newJWT(t *testing.T, keyID string, key []byte, validity time.Duration) string {
+	token, err := auth.NewJWT(keyID, key, "loadgen", []string{auth.ScopeUsersRead}, validity)
+	assert.NoError(t, err)
+	return token
+}
+
+func withBearer(token string) *http.Request {
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag" // POSIX/GNU-style CLI arguments.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+)
+
+// Config encapsulates the input required to configure authentication.
+type Config struct {
+	jwtKeyFiles []string
+	apiKeysFile string
+}
+
+const (
+	jwtKeyFile  = "auth-jwt-key-file"
+	apiKeysFile = "auth-api-keys-file"
+)
+
+// RegisterFlags maps the provided CLI arguments to fields in this configuration object.
+func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
+	f.StringArrayVar(&cfg.jwtKeyFiles, jwtKeyFile, nil, "File containing a key JWTs may be signed with, using HMAC. The file's name, without extension, is the key's ID (kid). Repeatable, e.g. to rotate keys")
+	f.StringVar(&cfg.apiKeysFile, apiKeysFile, "", "File containing one API key per line, followed by the scopes it grants, comma-separated, e.g. \"<key> users:read,users:write\"")
+}
+
+// Enabled returns whether authentication is enabled, i.e. whether any key is configured.
+func (cfg Config) Enabled() bool {
+	return len(cfg.jwtKeyFiles) > 0 || len(cfg.apiKeysFile) > 0
+}
+
+// Authenticator reads the configured keys, and returns an Authenticator accepting them, or nil if authentication is disabled.
+func (cfg Config) Authenticator() (*Authenticator, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	jwtKeys := make(map[string][]byte, len(cfg.jwtKeyFiles))
+	for _, path := range cfg.jwtKeyFiles {
+		key, err := readKey(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid --%v", jwtKeyFile)
+		}
+		id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if _, ok := jwtKeys[id]; ok {
+			return nil, fmt.Errorf("invalid --%v: duplicate key ID %q", jwtKeyFile, id)
+		}
+		jwtKeys[id] = key
+	}
+	apiKeys := map[string][]string{}
+	if len(cfg.apiKeysFile) > 0 {
+		var err error
+		if apiKeys, err = readAPIKeys(cfg.apiKeysFile); err != nil {
+			return nil, errors.Wrapf(err, "invalid --%v", apiKeysFile)
+		}
+	}
+	return NewAuthenticator(jwtKeys, apiKeys)
+}
+
+func readKey(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Scan()
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	key := strings.TrimSpace(scanner.Text())
+	if len(key) == 0 {
+		return nil, fmt.Errorf("%v is empty", path)
+	}
+	logging.AddSecret(key)
+	return []byte(key), nil
+}
+
+// readAPIKeys reads API keys, and the scopes they grant, one per line. Empty lines and lines starting with # are ignored.
+func readAPIKeys(path string) (map[string][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	apiKeys := map[string][]string{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%v:%v: expected \"<key> <scope>[,<scope>...]\"", path, line)
+		}
+		if _, ok := apiKeys[fields[0]]; ok {
+			return nil, fmt.Errorf("%v:%v: duplicate key", path, line)
+		}
+		logging.AddSecret(fields[0])
+		apiKeys[fields[0]] = strings.Split(fields[1], ",")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return apiKeys, nil
+}
@@ -0,0 +1,52 @@
+package auth_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"        // POSIX/GNU-style CLI arguments.
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/auth"
+)
+
+func TestParsingEmptyArgumentsShouldDisableAuthentication(t *testing.T) {
+	config := parseArgs(t, []string{})
+	assert.False(t, config.Enabled())
+	authenticator, err := config.Authenticator()
+	assert.NoError(t, err)
+	assert.Nil(t, authenticator)
+}
+
+func TestParsingArgumentsShouldReadKeysFromFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir) // Clean-up.
+	keyFile := filepath.Join(dir, "2026-10.key")
+	assert.NoError(t, ioutil.WriteFile(keyFile, append(newKey, '\n'), 0600))
+	apiKeysFile := filepath.Join(dir, "api-keys")
+	assert.NoError(t, ioutil.WriteFile(apiKeysFile, []byte("# Load generator:\nk3y users:read,users:write\n\n"), 0600))
+
+	config := parseArgs(t, []string{"--auth-jwt-key-file", keyFile, "--auth-api-keys-file", apiKeysFile})
+	authenticator, err := config.Authenticator()
+	assert.NoError(t, err)
+	_, err = authenticator.Authenticate(withBearer(newJWT(t, "2026-10", newKey, time.Hour)))
+	assert.NoError(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(apiKeysFile, []byte("k3y\n"), 0600))
+	_, err = config.Authenticator()
+	assert.EqualError(t, err, "invalid --auth-api-keys-file: "+apiKeysFile+":1: expected \"<key> <scope>[,<scope>...]\"")
+}
+
+// Utility function to create a Config object, register CLI arguments, and parse them.
+func parseArgs(t *testing.T, args []string) *auth.Config {
+	config := auth.Config{}
+	cli := flag.NewFlagSet("service-test", flag.ContinueOnError)
+	config.RegisterFlags(cli)
+	err := cli.Parse(args)
+	assert.NoError(t, err)
+	return &config
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"hash"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// leeway tolerates clock skew between the issuer of JWTs and this server.
+const leeway = 30 * time.Second
+
+var algorithms = map[string]func() hash.Hash{
+	"HS256": sha256.New,
+	"HS384": sha512.New384,
+	"HS512": sha512.New,
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+type jwtClaims struct {
+	Subject   string   `json:"sub"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	Scope     string   `json:"scope,omitempty"` // Space-separated, as per RFC 8693.
+	Scopes    []string `json:"scp,omitempty"`
+}
+
+// verify checks the provided JWT is signed with one of the configured keys, and is currently valid.
+func (authenticator *Authenticator) verify(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.Wrap(ErrUnauthenticated, "malformed JWT")
+	}
+	header := jwtHeader{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errors.Wrap(ErrUnauthenticated, "malformed JWT header")
+	}
+	newHash, ok := algorithms[header.Algorithm]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnauthenticated, "unsupported JWT algorithm %q", header.Algorithm)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrap(ErrUnauthenticated, "malformed JWT signature")
+	}
+	if !authenticator.validSignature(newHash, header.KeyID, parts[0]+"."+parts[1], signature) {
+		return nil, errors.Wrap(ErrUnauthenticated, "invalid JWT signature")
+	}
+
+	claims := jwtClaims{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.Wrap(ErrUnauthenticated, "malformed JWT claims")
+	}
+	now := authenticator.now()
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(leeway)) {
+		return nil, errors.Wrap(ErrUnauthenticated, "expired JWT")
+	}
+	if claims.NotBefore != 0 && now.Before(time.Unix(claims.NotBefore, 0).Add(-leeway)) {
+		return nil, errors.Wrap(ErrUnauthenticated, "JWT not valid yet")
+	}
+	scopes := claims.Scopes
+	if len(claims.Scope) > 0 {
+		scopes = append(scopes, strings.Fields(claims.Scope)...)
+	}
+	return &Principal{Subject: claims.Subject, Scopes: scopes}, nil
+}
+
+// validSignature checks the provided signature against the key with the provided ID or, if there is none, against all keys.
+func (authenticator *Authenticator) validSignature(newHash func() hash.Hash, keyID, signed string, signature []byte) bool {
+	if len(keyID) > 0 {
+		key, ok := authenticator.jwtKeys[keyID]
+		return ok && hmac.Equal(sign(newHash, key, signed), signature)
+	}
+	for _, key := range authenticator.jwtKeys {
+		if hmac.Equal(sign(newHash, key, signed), signature) {
+			return true
+		}
+	}
+	return false
+}
+
+func sign(newHash func() hash.Hash, key []byte, signed string) []byte {
+	mac := hmac.New(newHash, key)
+	mac.Write([]byte(signed))
+	return mac.Sum(nil)
+}
+
+func decodeSegment(segment string, value interface{}) error {
+	bytes, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, value)
+}
+
+// NewJWT creates a JWT for the provided subject and scopes, valid for the provided duration, signed with HS256 and the provided key.
+// This is mainly useful for testing, and to issue tokens to load generators.
+func NewJWT(keyID string, key []byte, subject string, scopes []string, validity time.Duration) (string, error) {
+	header, err := json.Marshal(jwtHeader{Algorithm: "HS256", KeyID: keyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(jwtClaims{
+		Subject:   subject,
+		ExpiresAt: time.Now().Add(validity).Unix(),
+		Scope:     strings.Join(scopes, " "),
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign(sha256.New, key, signed)), nil
+}
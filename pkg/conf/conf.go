@@ -0,0 +1,224 @@
+// Package conf layers the configuration of this service: flags set on the command line take precedence over
+// environment variables, e.g. KDS_DB_URI for --db-uri, which take precedence over the file provided via --config,
+// which takes precedence over flags' defaults. Secret flags may also be set to @<path>, to read their value from a file.
+package conf
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag" // POSIX/GNU-style CLI arguments.
+)
+
+const (
+	// EnvPrefix prefixes the environment variables flags can be set with.
+	EnvPrefix = "KDS_"
+
+	configFile       = "config"
+	secretAnnotation = "secret"
+	redacted         = "<redacted>"
+
+	commandLine  = "command line"
+	defaultValue = "default"
+)
+
+// MarkSecret marks the provided flag as secret: its value is redacted when printed, and can be read from a file, via @<path>.
+func MarkSecret(f *flag.FlagSet, name string) {
+	if err := f.SetAnnotation(name, secretAnnotation, []string{"true"}); err != nil {
+		panic(err) // The flag should be registered before being marked as secret.
+	}
+}
+
+func isSecret(f *flag.Flag) bool {
+	_, ok := f.Annotations[secretAnnotation]
+	return ok
+}
+
+// EnvVar returns the name of the environment variable the provided flag can be set with, e.g. KDS_DB_URI for --db-uri.
+func EnvVar(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// Loader sets flags not set on the command line from environment variables and a configuration file.
+type Loader struct {
+	file    string
+	sources map[string]string // Where each flag's value comes from.
+}
+
+// RegisterFlags maps the provided CLI arguments to fields in this configuration object.
+func (l *Loader) RegisterFlags(f *flag.FlagSet) {
+	f.StringVar(&l.file, configFile, "", fmt.Sprintf("YAML or JSON file to read flags from, as <flag>: <value>. Flags set on the command line, or via %v* environment variables, take precedence", EnvPrefix))
+}
+
+// Load sets flags not set on the command line from the provided environment, e.g. os.Environ(), or, failing that, from
+// the configuration file, if any, and then reads secret flags set to @<path> from the referenced files.
+// It should be called once the command line is parsed. Errors name the source of the offending value.
+func (l *Loader) Load(f *flag.FlagSet, environ []string) error {
+	l.sources = make(map[string]string)
+	f.Visit(func(flag *flag.Flag) {
+		l.sources[flag.Name] = commandLine
+	})
+	env := make(map[string]string)
+	for _, variable := range environ {
+		if i := strings.Index(variable, "="); i > 0 && strings.HasPrefix(variable, EnvPrefix) {
+			env[variable[:i]] = variable[i+1:]
+		}
+	}
+	if value, ok := env[EnvVar(configFile)]; ok && !f.Changed(configFile) {
+		l.file = value
+	}
+	values, err := l.readFile(f)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	f.VisitAll(func(flag *flag.Flag) {
+		names = append(names, flag.Name)
+	})
+	for _, name := range names {
+		if _, ok := l.sources[name]; ok || name == configFile {
+			continue
+		}
+		if value, ok := env[EnvVar(name)]; ok {
+			err = l.set(f, name, []string{value}, "environment variable "+EnvVar(name))
+		} else if values, ok := values[name]; ok {
+			err = l.set(f, name, values, "config file "+l.file)
+		} else {
+			l.sources[name] = defaultValue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return l.dereference(f)
+}
+
+func (l *Loader) readFile(f *flag.FlagSet) (map[string][]string, error) {
+	if len(l.file) == 0 {
+		return nil, nil
+	}
+	values, err := ReadFile(l.file)
+	if err != nil {
+		return nil, err
+	}
+	for name := range values {
+		if f.Lookup(name) == nil || name == configFile {
+			return nil, fmt.Errorf("invalid config file %v: unknown flag %q", l.file, name)
+		}
+	}
+	return values, nil
+}
+
+func (l *Loader) set(f *flag.FlagSet, name string, values []string, source string) error {
+	for _, value := range values {
+		if err := f.Set(name, value); err != nil {
+			if isSecret(f.Lookup(name)) {
+				value = redacted
+			}
+			return fmt.Errorf("invalid value %q for --%v from %v: %v", value, name, source, err)
+		}
+	}
+	l.sources[name] = source
+	return nil
+}
+
+// dereference replaces the value of secret flags set to @<path> with the content of the referenced file.
+func (l *Loader) dereference(f *flag.FlagSet) error {
+	var err error
+	f.VisitAll(func(flag *flag.Flag) {
+		value := flag.Value.String()
+		if err != nil || !isSecret(flag) || !strings.HasPrefix(value, "@") {
+			return
+		}
+		path := value[1:]
+		bytes, readErr := ioutil.ReadFile(path)
+		if readErr != nil {
+			err = errors.Wrapf(readErr, "failed to read --%v from %v, as set by %v", flag.Name, path, l.sources[flag.Name])
+			return
+		}
+		if setErr := flag.Value.Set(strings.TrimSpace(string(bytes))); setErr != nil {
+			err = fmt.Errorf("invalid value for --%v from %v, as set by %v: %v", flag.Name, path, l.sources[flag.Name], setErr)
+			return
+		}
+		l.sources[flag.Name] = fmt.Sprintf("%v, via %v", l.sources[flag.Name], path)
+	})
+	return err
+}
+
+// Source returns where the value of the provided flag comes from, e.g. "environment variable KDS_DB_URI".
+func (l *Loader) Source(name string) string {
+	if source, ok := l.sources[name]; ok {
+		return source
+	}
+	return defaultValue
+}
+
+// Print writes the effective configuration to the provided writer, in the format of configuration files, annotated
+// with where each value comes from. Secret values are redacted.
+func (l *Loader) Print(w io.Writer, f *flag.FlagSet) error {
+	var lines []string
+	f.VisitAll(func(flag *flag.Flag) {
+		if flag.Name == configFile {
+			return
+		}
+		comment := " # " + l.Source(flag.Name)
+		values, isList := listValues(f, flag)
+		if !isList {
+			lines = append(lines, fmt.Sprintf("%v: %v%v", flag.Name, quote(redact(flag, flag.Value.String())), comment))
+			return
+		}
+		if len(values) == 0 {
+			lines = append(lines, fmt.Sprintf("%v: []%v", flag.Name, comment))
+			return
+		}
+		lines = append(lines, fmt.Sprintf("%v:%v", flag.Name, comment))
+		for _, value := range values {
+			lines = append(lines, "  - "+quote(redact(flag, value)))
+		}
+	})
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// Values returns the effective configuration, as flags' names mapped to their value, or list of values, e.g. to be
+// served as JSON. Secret values are redacted.
+func Values(f *flag.FlagSet) map[string]interface{} {
+	values := make(map[string]interface{})
+	f.VisitAll(func(flag *flag.Flag) {
+		list, isList := listValues(f, flag)
+		if !isList {
+			values[flag.Name] = redact(flag, flag.Value.String())
+			return
+		}
+		redactedList := make([]string, 0, len(list))
+		for _, value := range list {
+			redactedList = append(redactedList, redact(flag, value))
+		}
+		values[flag.Name] = redactedList
+	})
+	return values
+}
+
+func listValues(f *flag.FlagSet, flag *flag.Flag) ([]string, bool) {
+	switch flag.Value.Type() {
+	case "stringArray":
+		values, _ := f.GetStringArray(flag.Name)
+		return values, true
+	case "stringSlice":
+		values, _ := f.GetStringSlice(flag.Name)
+		return values, true
+	default:
+		return nil, false
+	}
+}
+
+func redact(flag *flag.Flag, value string) string {
+	if isSecret(flag) && len(value) > 0 {
+		return redacted
+	}
+	return value
+}
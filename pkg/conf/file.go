@@ -0,0 +1,201 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ReadFile reads flags' values from the provided configuration file, mapping each flag's name to its values.
+// JSON files are objects of scalars or arrays of scalars. YAML files are limited to the equivalent subset: a mapping
+// of scalars, or of lists of scalars, either as flow sequences, e.g. [a, b], or as block sequences, i.e. "- a" lines.
+func ReadFile(path string) (map[string][]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read config file")
+	}
+	var values map[string][]string
+	if filepath.Ext(path) == ".json" || bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")) {
+		values, err = parseJSON(content)
+	} else {
+		values, err = parseYAML(string(content))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %v: %v", path, err)
+	}
+	return values, nil
+}
+
+func parseJSON(content []byte) (map[string][]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber() // Keeps numbers as written, e.g. 8080 rather than 8080.0.
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil {
+		return nil, err
+	}
+	values := make(map[string][]string, len(object))
+	for key, value := range object {
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		values[key] = make([]string, 0, len(items))
+		for _, item := range items {
+			switch item := item.(type) {
+			case string:
+				values[key] = append(values[key], item)
+			case json.Number:
+				values[key] = append(values[key], item.String())
+			case bool:
+				values[key] = append(values[key], strconv.FormatBool(item))
+			default:
+				return nil, fmt.Errorf("%q: expected a string, number, boolean, or an array of these, but got %v", key, item)
+			}
+		}
+	}
+	return values, nil
+}
+
+func parseYAML(content string) (map[string][]string, error) {
+	values := make(map[string][]string)
+	list := "" // Key of the block sequence being read, if any.
+	for i, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) == 0 || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			if len(list) == 0 {
+				return nil, fmt.Errorf("line %v: list item without key", i+1)
+			}
+			value, err := parseScalar(strings.TrimPrefix(trimmed, "-"), "")
+			if err != nil {
+				return nil, fmt.Errorf("line %v: %v", i+1, err)
+			}
+			values[list] = append(values[list], value)
+			continue
+		}
+		if strings.TrimLeft(line, " \t") != line {
+			return nil, fmt.Errorf("line %v: nested mappings are not supported", i+1)
+		}
+		colon := strings.Index(trimmed, ":")
+		if colon <= 0 {
+			return nil, fmt.Errorf("line %v: expected <flag>: <value> but got %q", i+1, trimmed)
+		}
+		key, rest := trimmed[:colon], strings.TrimSpace(trimmed[colon+1:])
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("line %v: duplicate key %q", i+1, key)
+		}
+		list = ""
+		var err error
+		switch {
+		case len(rest) == 0 || strings.HasPrefix(rest, "#"):
+			list = key
+			values[key] = []string{}
+		case strings.HasPrefix(rest, "["):
+			values[key], err = parseFlowSequence(rest)
+		default:
+			var value string
+			value, err = parseScalar(rest, "")
+			values[key] = []string{value}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", i+1, err)
+		}
+	}
+	return values, nil
+}
+
+func parseFlowSequence(s string) ([]string, error) {
+	values := []string{}
+	rest := strings.TrimSpace(s[1:])
+	if strings.HasPrefix(rest, "]") {
+		return values, checkTrailing(rest[1:])
+	}
+	for {
+		value, remainder, err := nextScalar(rest, ",]")
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		remainder = strings.TrimSpace(remainder)
+		switch {
+		case strings.HasPrefix(remainder, ","):
+			rest = remainder[1:]
+		case strings.HasPrefix(remainder, "]"):
+			return values, checkTrailing(remainder[1:])
+		default:
+			return nil, fmt.Errorf("unterminated list %q", s)
+		}
+	}
+}
+
+// parseScalar parses the provided scalar, which may be followed by a comment.
+func parseScalar(s, terminators string) (string, error) {
+	value, rest, err := nextScalar(s, terminators)
+	if err != nil {
+		return "", err
+	}
+	return value, checkTrailing(rest)
+}
+
+// nextScalar parses the scalar at the start of the provided string, and returns it, along with what follows it.
+// Unquoted scalars end at any of the provided terminators, or at a comment.
+func nextScalar(s, terminators string) (string, string, error) {
+	s = strings.TrimLeft(s, " \t")
+	switch {
+	case strings.HasPrefix(s, `"`):
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '"':
+				value, err := strconv.Unquote(s[:i+1])
+				return value, s[i+1:], err
+			}
+		}
+		return "", "", fmt.Errorf("unterminated string %v", s)
+	case strings.HasPrefix(s, "'"):
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' { // Escaped quote.
+					i++
+					continue
+				}
+				return strings.Replace(s[1:i], "''", "'", -1), s[i+1:], nil
+			}
+		}
+		return "", "", fmt.Errorf("unterminated string %v", s)
+	default:
+		end := len(s)
+		if i := strings.IndexAny(s, terminators); i >= 0 && len(terminators) > 0 {
+			end = i
+		}
+		if i := strings.Index(s, " #"); i >= 0 && i < end {
+			end = i
+		}
+		return strings.TrimSpace(s[:end]), s[end:], nil
+	}
+}
+
+func checkTrailing(s string) error {
+	s = strings.TrimSpace(s)
+	if len(s) > 0 && !strings.HasPrefix(s, "#") {
+		return fmt.Errorf("unexpected %q", s)
+	}
+	return nil
+}
+
+// quote quotes the provided value if it would not be read back as is from a configuration file.
+func quote(value string) string {
+	if len(value) == 0 || value != strings.TrimSpace(value) || strings.ContainsAny(value, ":#,[]{}\"'\\&*!|>%@`") || strings.HasPrefix(value, "-") {
+		return strconv.Quote(value)
+	}
+	return value
+}
@@ -0,0 +1,71 @@
+package conf_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/conf"
+)
+
+func TestReadFileShouldParseYAMLSubset(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir) // Clean-up.
+	file := writeFile(t, dir, "config.yaml", `---
+# Comments are ignored.
+http-port: 8080 # So are trailing ones.
+db-uri: "postgres://foo@bar:5432/baz?sslmode=disable"
+http-fault-profile: 'it''s bad'
+http-fault: ["route=users,status=503", percentage=10]
+db-fault-latency:
+  - "*=uniform:10ms:20ms"
+  - CreateUser=normal:5ms:1ms
+http-route-rate-limit: []
+outbox-sink:
+`)
+	values, err := conf.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"http-port":             {"8080"},
+		"db-uri":                {"postgres://foo@bar:5432/baz?sslmode=disable"},
+		"http-fault-profile":    {"it's bad"},
+		"http-fault":            {"route=users,status=503", "percentage=10"},
+		"db-fault-latency":      {"*=uniform:10ms:20ms", "CreateUser=normal:5ms:1ms"},
+		"http-route-rate-limit": {},
+		"outbox-sink":           {},
+	}, values)
+}
+
+func TestReadFileShouldParseJSON(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir) // Clean-up.
+	file := writeFile(t, dir, "config.json", `{"http-port": 8080, "cache-ttl": "1m", "http-trust-forwarded-for": true, "http-fault": ["route=users", "status=503"]}`)
+	values, err := conf.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"http-port":                {"8080"},
+		"cache-ttl":                {"1m"},
+		"http-trust-forwarded-for": {"true"},
+		"http-fault":               {"route=users", "status=503"},
+	}, values)
+}
+
+func TestReadFileShouldReturnErrorWhenInvalid(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir) // Clean-up.
+	for content, expected := range map[string]string{
+		"- orphan\n":                         "line 1: list item without key",
+		"db:\n  uri: foo\n":                  "line 2: nested mappings are not supported",
+		"port: 1\nport: 2\n":                 "line 2: duplicate key \"port\"",
+		"uri: \"unterminated\n":              "line 1: unterminated string \"unterminated",
+		"faults: [a, b\n":                    "line 1: unterminated list \"[a, b\"",
+		"uri: \"foo\" bar\n":                 "line 1: unexpected \"bar\"",
+		"{\"db\": {\"uri\": \"foo\"}}":       "\"db\": expected a string, number, boolean, or an array of these, but got map[uri:foo]",
+		"{\"port\": 8080, \"faults\": [{}]}": "\"faults\": expected a string, number, boolean, or an array of these, but got map[]",
+	} {
+		file := writeFile(t, dir, "config", content)
+		_, err := conf.ReadFile(file)
+		assert.EqualError(t, err, "invalid config file "+file+": "+expected, content)
+	}
+}
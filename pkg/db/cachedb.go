@@ -0,0 +1,346 @@
+package db
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	flag "github.com/spf13/pflag" // POSIX/GNU-style CLI arguments.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/metrics"
+)
+
+// cacheLoadTimeout bounds calls to the decorated DB, as these are not cancelled by callers.
+const cacheLoadTimeout = 10 * time.Second
+
+// CachedDB decorates a DB, caching the results of ReadUserByID, including users not found, in a bounded LRU cache.
+// Entries expire after a TTL, and are invalidated by writes through this CachedDB, but not by writes from other processes.
+// Concurrent lookups of the same uncached ID are coalesced into a single call to the decorated DB.
+type CachedDB struct {
+	db        DB
+	size      int
+	ttl       time.Duration
+	now       func() time.Time
+	entries   map[int]*list.Element
+	lru       *list.List // Most recently used entries first.
+	loads     map[int]*load
+	mutex     sync.Mutex // For thread-safe access to the entries, the LRU list and the loads.
+	hits      uint64
+	misses    uint64
+	evictions uint64
+	coalesced uint64
+}
+
+type cacheEntry struct {
+	id      int
+	user    *domain.User // nil if the user was not found.
+	expires time.Time
+}
+
+// load is a call to ReadUserByID in flight, which concurrent lookups of the same ID wait for.
+type load struct {
+	done        chan struct{}
+	user        *domain.User
+	err         error
+	invalidated bool // Whether a write invalidated this ID while loading, in which case the result should not be cached.
+}
+
+// CacheStats are the counters of a CachedDB.
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Coalesced uint64 `json:"coalesced"`
+	Size      int    `json:"size"`
+}
+
+// NewCachedDB creates a new DB caching up to size users read from the provided DB, for the provided TTL.
+func NewCachedDB(db DB, size int, ttl time.Duration) (*CachedDB, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid cache size: expected a positive number but got %v", size)
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("invalid cache TTL: expected a positive duration but got %v", ttl)
+	}
+	return &CachedDB{
+		db:      db,
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[int]*list.Element),
+		lru:     list.New(),
+		loads:   make(map[int]*load),
+	}, nil
+}
+
+// Stats returns the current counters of this cache.
+func (database *CachedDB) Stats() CacheStats {
+	database.mutex.Lock()
+	size := database.lru.Len()
+	database.mutex.Unlock()
+	return CacheStats{
+		Hits:      atomic.LoadUint64(&database.hits),
+		Misses:    atomic.LoadUint64(&database.misses),
+		Evictions: atomic.LoadUint64(&database.evictions),
+		Coalesced: atomic.LoadUint64(&database.coalesced),
+		Size:      size,
+	}
+}
+
+// RegisterMetrics exposes this cache's counters via the provided registry.
+func (database *CachedDB) RegisterMetrics(registry *metrics.Registry) {
+	registry.CounterFunc("users_cache_hits_total", "Number of users read by ID from the cache.", func() float64 {
+		return float64(database.Stats().Hits)
+	})
+	registry.CounterFunc("users_cache_misses_total", "Number of users read by ID not found in the cache.", func() float64 {
+		return float64(database.Stats().Misses)
+	})
+	registry.CounterFunc("users_cache_evictions_total", "Number of users evicted from the cache to make room for others.", func() float64 {
+		return float64(database.Stats().Evictions)
+	})
+	registry.CounterFunc("users_cache_coalesced_total", "Number of cache misses which waited for another lookup of the same user.", func() float64 {
+		return float64(database.Stats().Coalesced)
+	})
+	registry.GaugeFunc("users_cache_size", "Number of users currently cached.", func() float64 {
+		return float64(database.Stats().Size)
+	})
+}
+
+// Unwrap returns the decorated DB.
+func (database *CachedDB) Unwrap() DB {
+	return database.db
+}
+
+// Ping ensures this database client can reach the database.
+func (database *CachedDB) Ping(ctx context.Context) error {
+	return database.db.Ping(ctx)
+}
+
+// CreateUser stores the provided user, and invalidates any cached lookup of its ID.
+func (database *CachedDB) CreateUser(ctx context.Context, user *domain.User) (int, error) {
+	id, err := database.db.CreateUser(ctx, user)
+	if err != nil {
+		return id, err
+	}
+	database.invalidate(id)
+	return id, nil
+}
+
+// ReadUsers returns all stored users. These are not cached.
+func (database *CachedDB) ReadUsers(ctx context.Context) ([]*domain.User, error) {
+	return database.db.ReadUsers(ctx)
+}
+
+// ReadUserByID return the stored user corresponding to the provided ID, from the cache if possible.
+func (database *CachedDB) ReadUserByID(ctx context.Context, id int) (*domain.User, error) {
+	database.mutex.Lock()
+	if entry, ok := database.lookup(id); ok {
+		database.mutex.Unlock()
+		atomic.AddUint64(&database.hits, 1)
+		return result(entry.user, nil)
+	}
+	atomic.AddUint64(&database.misses, 1)
+	l, ok := database.loads[id]
+	if ok {
+		atomic.AddUint64(&database.coalesced, 1)
+	} else {
+		l = &load{done: make(chan struct{})}
+		database.loads[id] = l
+		go database.load(ctx, id, l)
+	}
+	database.mutex.Unlock()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-l.done:
+		return result(l.user, l.err)
+	}
+}
+
+// ReadUserByEmail returns the stored user with the provided email, regardless of case. These are not cached.
+func (database *CachedDB) ReadUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return database.db.ReadUserByEmail(ctx, email)
+}
+
+// load reads the user corresponding to the provided ID from the decorated DB, and caches it.
+// As the load is shared by concurrent lookups, it is not cancelled when the context of the caller which started it is done.
+func (database *CachedDB) load(ctx context.Context, id int, l *load) {
+	ctx, cancel := context.WithTimeout(detach(ctx), cacheLoadTimeout)
+	defer cancel()
+	l.user, l.err = database.db.ReadUserByID(ctx, id)
+
+	database.mutex.Lock()
+	delete(database.loads, id)
+	if !l.invalidated && (l.err == nil || l.err == ErrNotFound) {
+		database.store(id, l.user)
+	}
+	database.mutex.Unlock()
+	close(l.done)
+}
+
+// result returns a copy of the provided user, so that callers cannot alter cached users, or ErrNotFound if there is none.
+func result(user *domain.User, err error) (*domain.User, error) {
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrNotFound
+	}
+	clone := *user
+	return &clone, nil
+}
+
+// lookup returns the unexpired entry for the provided ID, if any. It should be called while holding the mutex.
+func (database *CachedDB) lookup(id int) (*cacheEntry, bool) {
+	element, ok := database.entries[id]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if !database.now().Before(entry.expires) {
+		database.remove(element)
+		return nil, false
+	}
+	database.lru.MoveToFront(element)
+	return entry, true
+}
+
+// store caches the provided user, evicting the least recently used entry if the cache is full.
+// It should be called while holding the mutex.
+func (database *CachedDB) store(id int, user *domain.User) {
+	entry := &cacheEntry{id: id, user: user, expires: database.now().Add(database.ttl)}
+	if element, ok := database.entries[id]; ok {
+		element.Value = entry
+		database.lru.MoveToFront(element)
+		return
+	}
+	database.entries[id] = database.lru.PushFront(entry)
+	if database.lru.Len() > database.size {
+		database.remove(database.lru.Back())
+		atomic.AddUint64(&database.evictions, 1)
+	}
+}
+
+// remove removes the provided entry. It should be called while holding the mutex.
+func (database *CachedDB) remove(element *list.Element) {
+	database.lru.Remove(element)
+	delete(database.entries, element.Value.(*cacheEntry).id)
+}
+
+// invalidate removes the entry for the provided ID, and prevents a concurrent load of it from being cached.
+func (database *CachedDB) invalidate(id int) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	if element, ok := database.entries[id]; ok {
+		database.remove(element)
+	}
+	if l, ok := database.loads[id]; ok {
+		l.invalidated = true
+	}
+}
+
+// DeleteUser forwards to the decorated DB, if it is a Deleter, and invalidates any cached lookup of the provided ID.
+func (database *CachedDB) DeleteUser(ctx context.Context, id int) error {
+	deleter, ok := database.db.(Deleter)
+	if !ok {
+		return ErrNotSupported
+	}
+	err := deleter.DeleteUser(ctx, id)
+	database.invalidate(id) // Even on failure, as the user may have been deleted regardless, e.g. if the context timed out.
+	return err
+}
+
+// SearchUsers forwards to the decorated DB, if it is a Searcher. Results are not cached.
+func (database *CachedDB) SearchUsers(ctx context.Context, text string, after *SearchCursor, limit int) ([]*Match, error) {
+	if searcher, ok := database.db.(Searcher); ok {
+		return searcher.SearchUsers(ctx, text, after, limit)
+	}
+	return nil, ErrNotSupported
+}
+
+// UserStats forwards to the decorated DB, if it is an Aggregator.
+func (database *CachedDB) UserStats(ctx context.Context, since time.Time, topFamilyNames int) (*UserStats, error) {
+	if aggregator, ok := database.db.(Aggregator); ok {
+		return aggregator.UserStats(ctx, since, topFamilyNames)
+	}
+	return nil, ErrNotSupported
+}
+
+// ReplayEvents forwards to the decorated DB, if it is an Outbox.
+func (database *CachedDB) ReplayEvents(ctx context.Context, fromID int64) (int64, error) {
+	if outbox, ok := database.db.(Outbox); ok {
+		return outbox.ReplayEvents(ctx, fromID)
+	}
+	return 0, ErrNotSupported
+}
+
+// DeliverEvents forwards to the decorated DB, if it is an Outbox.
+func (database *CachedDB) DeliverEvents(ctx context.Context, limit int, publish func(*domain.Event) error) (int, error) {
+	if outbox, ok := database.db.(Outbox); ok {
+		return outbox.DeliverEvents(ctx, limit, publish)
+	}
+	return 0, ErrNotSupported
+}
+
+// WatchUsers forwards to the decorated DB, if it is a Watcher.
+func (database *CachedDB) WatchUsers(ctx context.Context, afterEventID int64) (<-chan *domain.UserChange, error) {
+	if watcher, ok := database.db.(Watcher); ok {
+		return watcher.WatchUsers(ctx, afterEventID)
+	}
+	return nil, ErrNotSupported
+}
+
+// Close closes the decorated DB.
+func (database *CachedDB) Close() error {
+	return database.db.Close()
+}
+
+// detachedContext carries the values of its parent, but is never cancelled.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func detach(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
+
+// CacheConfig encapsulates the input required to configure the cache of users read from the database.
+type CacheConfig struct {
+	Size int
+	TTL  time.Duration
+}
+
+const (
+	cacheSize = "cache-size"
+	cacheTTL  = "cache-ttl"
+)
+
+// RegisterFlags maps the provided CLI arguments to fields in this configuration object.
+func (cfg *CacheConfig) RegisterFlags(f *flag.FlagSet) {
+	f.IntVar(&cfg.Size, cacheSize, 0, "Maximum number of users cached when read by ID. 0 disables caching")
+	f.DurationVar(&cfg.TTL, cacheTTL, 1*time.Minute, "Duration users read by ID are cached for")
+}
+
+// Enabled returns whether caching is enabled.
+func (cfg CacheConfig) Enabled() bool {
+	return cfg.Size > 0
+}
+
+// Validate checks this configuration is valid.
+func (cfg CacheConfig) Validate() error {
+	if cfg.Size < 0 {
+		return fmt.Errorf("invalid --%v: expected a positive number but got %v", cacheSize, cfg.Size)
+	}
+	if cfg.Enabled() && cfg.TTL <= 0 {
+		return fmt.Errorf("invalid --%v: expected a positive duration but got %v", cacheTTL, cfg.TTL)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package db_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"        // POSIX/GNU-style CLI arguments.
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db/dbtest"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+)
+
+func TestCachedDBConformance(t *testing.T) {
+	dbtest.Conformance(t, func(t *testing.T) db.DB {
+		database, err := db.NewCachedDB(db.NewInMemoryDB(), 2, time.Minute)
+		assert.NoError(t, err)
+		return database
+	})
+}
+
+func TestCachedDBShouldServeHitsFromCache(t *testing.T) {
+	counting := &countingDB{DB: db.NewInMemoryDB()}
+	database, err := db.NewCachedDB(counting, 10, time.Minute)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	id, err := database.CreateUser(ctx, &domain.User{FirstName: "Luke"})
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		user, err := database.ReadUserByID(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, "Luke", user.FirstName)
+		user.FirstName = "Darth" // Does not alter the cached user.
+	}
+	assert.Equal(t, int64(1), counting.reads())
+	assert.Equal(t, db.CacheStats{Hits: 2, Misses: 1, Size: 1}, database.Stats())
+}
+
+func TestCachedDBShouldInvalidateUsersNotFoundOnCreation(t *testing.T) {
+	database, err := db.NewCachedDB(db.NewInMemoryDB(), 10, time.Minute)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = database.ReadUserByID(ctx, 1)
+	assert.Equal(t, db.ErrNotFound, err)
+	_, err = database.ReadUserByID(ctx, 1)
+	assert.Equal(t, db.ErrNotFound, err) // Cached.
+
+	id, err := database.CreateUser(ctx, &domain.User{FirstName: "Luke"})
+	assert.NoError(t, err)
+	user, err := database.ReadUserByID(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Luke", user.FirstName)
+}
+
+func TestCachedDBShouldInvalidateDeletedUsers(t *testing.T) {
+	database, err := db.NewCachedDB(db.NewInMemoryDB(), 10, time.Minute)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	id, err := database.CreateUser(ctx, &domain.User{FirstName: "Luke"})
+	assert.NoError(t, err)
+	_, err = database.ReadUserByID(ctx, id)
+	assert.NoError(t, err) // Cached.
+
+	assert.NoError(t, database.DeleteUser(ctx, id))
+	_, err = database.ReadUserByID(ctx, id)
+	assert.Equal(t, db.ErrNotFound, err)
+}
+
+func TestCachedDBShouldEvictLeastRecentlyUsedUsers(t *testing.T) {
+	counting := &countingDB{DB: db.NewInMemoryDB()}
+	database, err := db.NewCachedDB(counting, 2, time.Minute)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	for _, firstName := range []string{"Luke", "Obi-Wan", "Leia"} {
+		_, err := database.CreateUser(ctx, &domain.User{FirstName: firstName})
+		assert.NoError(t, err)
+	}
+
+	for _, id := range []int{1, 2, 1, 3, 1, 2} { // Reading 3 evicts 2, then reading 2 evicts 3.
+		_, err := database.ReadUserByID(ctx, id)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int64(4), counting.reads())
+	assert.Equal(t, db.CacheStats{Hits: 2, Misses: 4, Evictions: 2, Size: 2}, database.Stats())
+}
+
+func TestCachedDBShouldExpireUsers(t *testing.T) {
+	counting := &countingDB{DB: db.NewInMemoryDB()}
+	database, err := db.NewCachedDB(counting, 10, 20*time.Millisecond)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	id, err := database.CreateUser(ctx, &domain.User{FirstName: "Luke"})
+	assert.NoError(t, err)
+
+	_, err = database.ReadUserByID(ctx, id)
+	assert.NoError(t, err)
+	time.Sleep(30 * time.Millisecond)
+	_, err = database.ReadUserByID(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), counting.reads())
+}
+
+func TestCachedDBShouldCoalesceConcurrentLookups(t *testing.T) {
+	latency, err := db.ParseLatency("fixed:50ms")
+	assert.NoError(t, err)
+	slowDB, err := db.NewFaultyDB(db.NewInMemoryDB(), db.Faults{db.MethodReadUserByID: {Latency: latency}})
+	assert.NoError(t, err)
+	counting := &countingDB{DB: slowDB}
+	database, err := db.NewCachedDB(counting, 10, time.Minute)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	id, err := database.CreateUser(ctx, &domain.User{FirstName: "Luke"})
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user, err := database.ReadUserByID(ctx, id)
+			assert.NoError(t, err)
+			assert.Equal(t, "Luke", user.FirstName)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(1), counting.reads())
+	assert.Equal(t, uint64(19), database.Stats().Coalesced)
+}
+
+func TestCachedDBShouldReturnWhenContextIsDone(t *testing.T) {
+	slowDB, err := db.NewFaultyDB(db.NewInMemoryDB(), db.Faults{db.MethodReadUserByID: {TimeoutRate: 1}})
+	assert.NoError(t, err)
+	database, err := db.NewCachedDB(slowDB, 10, time.Minute)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = database.ReadUserByID(ctx, 1)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestNewCachedDBShouldRejectInvalidSizeAndTTL(t *testing.T) {
+	_, err := db.NewCachedDB(db.NewInMemoryDB(), 0, time.Minute)
+	assert.EqualError(t, err, "invalid cache size: expected a positive number but got 0")
+	_, err = db.NewCachedDB(db.NewInMemoryDB(), 10, 0)
+	assert.EqualError(t, err, "invalid cache TTL: expected a positive duration but got 0s")
+}
+
+func TestParsingCacheArguments(t *testing.T) {
+	config := db.CacheConfig{}
+	cli := flag.NewFlagSet("service-test", flag.ContinueOnError)
+	config.RegisterFlags(cli)
+	assert.NoError(t, cli.Parse([]string{}))
+	assert.False(t, config.Enabled())
+	assert.NoError(t, config.Validate())
+
+	assert.NoError(t, cli.Parse([]string{"--cache-size", "1000", "--cache-ttl", "30s"}))
+	assert.Equal(t, db.CacheConfig{Size: 1000, TTL: 30 * time.Second}, config)
+	assert.True(t, config.Enabled())
+	assert.NoError(t, config.Validate())
+
+	assert.NoError(t, cli.Parse([]string{"--cache-ttl", "0s"}))
+	assert.EqualError(t, config.Validate(), "invalid --cache-ttl: expected a positive duration but got 0s")
+}
+
+// countingDB counts calls to ReadUserByID.
+type countingDB struct {
+	db.DB
+	count int64
+}
+
+func (database *countingDB) ReadUserByID(ctx context.Context, id int) (*domain.User, error) {
+	atomic.AddInt64(&database.count, 1)
+	return database.DB.ReadUserByID(ctx, id)
+}
+
+func (database *countingDB) reads() int64 {
+	return atomic.LoadInt64(&database.count)
+}
@@ -4,9 +4,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/url"
+	"time"
 
 	"github.com/pkg/errors"
 	flag "github.com/spf13/pflag" // POSIX/GNU-style CLI arguments.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/conf"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
 )
 
 // Config encapsulates the input required to configure a database connection.
@@ -15,6 +19,8 @@ type Config struct {
 	passwordFile  string
 	MigrationsDir string
 	SchemaVersion uint
+
+	PasswordReloadInterval time.Duration
 }
 
 const (
@@ -22,14 +28,18 @@ const (
 	dbMigrationsDir = "db-migrations-dir"
 	dbSchemaVersion = "db-schema-version"
 	dbPasswdFile    = "db-passwd-file"
+
+	dbPasswdReloadInterval = "db-passwd-reload-interval"
 )
 
 // RegisterFlags maps the provided CLI arguments to fields in this configuration object.
 func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
-	f.StringVar(&cfg.RawURI, dbURI, "postgres://postgres@localhost:5432/users?sslmode=disable", "URI to connect to the database")
+	f.StringVar(&cfg.RawURI, dbURI, "postgres://postgres@localhost:5432/users?sslmode=disable", fmt.Sprintf("URI to connect to the database. The scheme selects the backend, one of %q", Schemes()))
+	conf.MarkSecret(f, dbURI) // May contain credentials.
 	f.StringVar(&cfg.passwordFile, dbPasswdFile, "", fmt.Sprintf("File containing the password to authenticate against the database (username goes in --%v)", dbURI))
 	f.StringVar(&cfg.MigrationsDir, dbMigrationsDir, "/home/service/migrations", "Directory containing the database migrations to apply on application startup")
 	f.UintVar(&cfg.SchemaVersion, dbSchemaVersion, SchemaVersion, "Version of the schema of the database. This version will be applied on application startup")
+	f.DurationVar(&cfg.PasswordReloadInterval, dbPasswdReloadInterval, 10*time.Second, fmt.Sprintf("How often --%v is checked for changes, upon which connections are re-established with the new password. 0 disables reloading", dbPasswdFile))
 }
 
 // URI parses this configuration object's database URI, reads the database password from the specified file, and injects it in the URI it returns.
@@ -47,6 +57,7 @@ func (cfg Config) URI() (string, error) {
 		if err != nil {
 			return "", errors.Wrap(err, "failed to read database password file")
 		}
+		logging.AddSecret(string(passwordBytes))
 		uri.User = url.UserPassword(uri.User.Username(), string(passwordBytes))
 	}
 	return uri.String(), nil
@@ -1,15 +1,18 @@
 package db_test
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"testing"
 
+	log "github.com/sirupsen/logrus"     // Better Logging.
 	flag "github.com/spf13/pflag"        // POSIX/GNU-style CLI arguments.
 	"github.com/stretchr/testify/assert" // More readable test assertions.
 
 	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
 )
 
 func TestParsingEmptyArgumentsShouldReturnDefaultConfig(t *testing.T) {
@@ -20,7 +23,7 @@ func TestParsingEmptyArgumentsShouldReturnDefaultConfig(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "postgres://postgres@localhost:5432/users?sslmode=disable", uri)
 	assert.Equal(t, "/home/service/migrations", config.MigrationsDir)
-	assert.Equal(t, uint(2), config.SchemaVersion)
+	assert.Equal(t, uint(9), config.SchemaVersion)
 }
 
 func TestParsingArgumentsShouldOverrideDefaultConfig(t *testing.T) {
@@ -47,6 +50,40 @@ func TestParsingArgumentsShouldOverrideDefaultConfig(t *testing.T) {
 	assert.Equal(t, uint(42), config.SchemaVersion)
 }
 
+func TestDatabasePasswordShouldNeverBeLogged(t *testing.T) {
+	const password = "n3v3r-l0gg3d"
+	passwordFile, err := passwordFile(password + "\n")
+	assert.NoError(t, err)
+	defer os.Remove(passwordFile.Name()) // Clean-up.
+	var logs bytes.Buffer
+	logger := log.StandardLogger()
+	defer func(formatter log.Formatter) { logger.Formatter = formatter }(logger.Formatter) // Clean-up.
+	defer log.SetOutput(logger.Out)                                                        // Clean-up.
+	log.SetOutput(&logs)
+	defer log.SetLevel(log.GetLevel()) // Clean-up.
+	assert.NoError(t, (&logging.Config{Format: logging.FormatText, Level: "debug", DebugSample: 1}).Configure("test"))
+
+	// Nothing listens on port 1, so that connecting fails, and errors are logged:
+	config := parseArgs(t, []string{
+		"--db-uri", "postgres://postgres@127.0.0.1:1/users?sslmode=disable&connect_timeout=1&max-open-conns=10",
+		"--db-passwd-file", passwordFile.Name(),
+	})
+	uri, err := config.URI()
+	assert.NoError(t, err)
+	assert.Contains(t, uri, password)
+	_, err = db.Open(config)
+	assert.Error(t, err)
+	log.WithField("err", err).Error("failed to create database client")
+	// Even if logged carelessly, in fields, messages, or errors:
+	log.WithField("uri", uri).WithField("password", password+"\n").Info("connecting to " + uri)
+	log.WithField("err", fmt.Errorf("failed to connect to %v", uri)).Warn("retrying")
+	log.WithField("dsn", "host=localhost password="+password).Info("connecting")
+
+	assert.NotContains(t, logs.String(), password)
+	assert.Contains(t, logs.String(), "failed to create database client")
+	assert.Contains(t, logs.String(), "postgres://postgres:<redacted>@127.0.0.1:1/users")
+}
+
 func TestInvalidDatabaseURIShouldReturnError(t *testing.T) {
 	config := parseArgs(t, []string{
 		"--db-uri", "::not-a-valid-URI",
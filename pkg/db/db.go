@@ -3,27 +3,88 @@ package db
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
 )
 
 // SchemaVersion is the current version of the DB schema.
 // N.B.: this constant should be updated every time new migrations are added.
-const SchemaVersion = uint(2)
+const SchemaVersion = uint(9)
 
 // DB is the interface for a database client.
 type DB interface {
 	// Ping ensures this database client can reach the database.
 	Ping(ctx context.Context) error
-	// CreateUser stores the provided user.
+	// CreateUser stores the provided user, or returns ErrEmailTaken if another user has the same email, regardless of case.
 	CreateUser(ctx context.Context, user *domain.User) (int, error)
 	// ReadUsers returns all stored users.
 	ReadUsers(ctx context.Context) ([]*domain.User, error)
 	// ReadUserByID return the stored user corresponding to the provided ID.
 	ReadUserByID(ctx context.Context, id int) (*domain.User, error)
+	// ReadUserByEmail return the stored user with the provided email, regardless of case.
+	ReadUserByEmail(ctx context.Context, email string) (*domain.User, error)
 	// Close closes this connection to the database.
 	Close() error
 }
 
+// Decorator is implemented by databases which decorate another one, e.g. to inject faults or cache users.
+type Decorator interface {
+	// Unwrap returns the decorated DB.
+	Unwrap() DB
+}
+
+// Outbox is implemented by databases which record an event in the same transaction as each write to users,
+// so that these events can reliably be relayed to downstream systems.
+type Outbox interface {
+	// DeliverEvents passes, oldest first, up to limit events which have not yet been delivered to the provided function,
+	// stops at the first one it fails to publish, marks the ones published as delivered, and returns how many there were,
+	// along with the publishing error, if any. Concurrent calls, e.g. from several replicas, do not deliver the same events.
+	DeliverEvents(ctx context.Context, limit int, publish func(*domain.Event) error) (int, error)
+	// ReplayEvents marks all delivered events with an ID greater than or equal to the provided one as pending again,
+	// and returns the number of events which will therefore be delivered again.
+	ReplayEvents(ctx context.Context, fromID int64) (int64, error)
+}
+
+// Deleter is implemented by databases which can delete users.
+type Deleter interface {
+	// DeleteUser deletes the stored user corresponding to the provided ID, or returns ErrNotFound if there is none.
+	DeleteUser(ctx context.Context, id int) error
+}
+
+// Watcher is implemented by databases which can stream changes to users.
+// Changes are identified by the ID of the event recording them, which watchers resume after, but these IDs need not increase.
+type Watcher interface {
+	// WatchUsers streams changes recorded after the event with the provided ID: first the changes already stored, oldest first,
+	// then changes as they happen. The returned channel is closed once the provided context is done, or if streaming fails,
+	// in which case callers may resume by watching again after the ID of the last change they received.
+	WatchUsers(ctx context.Context, afterEventID int64) (<-chan *domain.UserChange, error)
+}
+
+// LatestEvent may be passed to WatchUsers instead of an event's ID, to only stream the changes recorded from now on.
+const LatestEvent = int64(-1)
+
+// SendChange sends the provided change, unless the provided context is done first, in which case it returns false.
+func SendChange(ctx context.Context, changes chan<- *domain.UserChange, change *domain.UserChange) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case changes <- change:
+		return true
+	}
+}
+
 // ErrNotFound is returned when the requested user is not found.
 var ErrNotFound = errors.New("not found")
+
+// ErrEmailTaken is returned when creating an user with the same email as another one, regardless of case.
+var ErrEmailTaken = errors.New("email already taken")
+
+// errClosed is returned when using a database client after it was closed.
+var errClosed = errors.New("database client closed")
+
+// creationTime returns the current time, as recorded for newly created users, i.e. in UTC and with PostgreSQL's precision.
+func creationTime() *time.Time {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	return &now
+}
@@ -0,0 +1,389 @@
+package dbtest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+)
+
+// Conformance checks the provided implementation of db.DB behaves like all others.
+// newDB is called once per test case, and should return an empty database, which is then closed by the test case.
+func Conformance(t *testing.T, newDB func(t *testing.T) db.DB) {
+	for _, test := range []struct {
+		name string
+		run  func(t *testing.T, database db.DB)
+	}{
+		{"Ping", testPing},
+		{"EmptyDatabase", testEmptyDatabase},
+		{"IDAssignment", testIDAssignment},
+		{"Ordering", testOrdering},
+		{"NotFound", testNotFound},
+		{"ConcurrentCreations", testConcurrentCreations},
+		{"ContextCancellation", testContextCancellation},
+		{"Isolation", testIsolation},
+		{"Deletion", testDeletion},
+		{"CreationTime", testCreationTime},
+		{"EmailUniqueness", testEmailUniqueness},
+		{"Search", testSearch},
+		{"Stats", testStats},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			database := newDB(t)
+			if database == nil {
+				t.FailNow()
+			}
+			defer Cleanup(t, database)
+			test.run(t, database)
+		})
+	}
+}
+
+func testPing(t *testing.T, database db.DB) {
+	assert.NoError(t, database.Ping(context.Background()))
+}
+
+func testEmptyDatabase(t *testing.T, database db.DB) {
+	users, err := database.ReadUsers(context.Background())
+	assert.NoError(t, err)
+	assert.NotNil(t, users) // Serialised as [] rather than null.
+	assert.Equal(t, 0, len(users))
+}
+
+func testIDAssignment(t *testing.T, database db.DB) {
+	ctx := context.Background()
+	id, err := database.CreateUser(ctx, &domain.User{FirstName: "Luke", FamilyName: "Skywalker", Age: 20})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, id)
+
+	// Client-supplied IDs are ignored:
+	id, err = database.CreateUser(ctx, &domain.User{ID: 1337, FirstName: "Obi-Wan", FamilyName: "Kenobi", Age: 40})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, id)
+	id, err = database.CreateUser(ctx, &domain.User{ID: 1, FirstName: "Leia", FamilyName: "Organa", Age: 20})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, id)
+
+	_, err = database.ReadUserByID(ctx, 1337)
+	assert.Equal(t, db.ErrNotFound, err)
+	user, err := database.ReadUserByID(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.User{ID: 1, FirstName: "Luke", FamilyName: "Skywalker", Age: 20}, withoutCreationTime(user))
+	user, err = database.ReadUserByID(ctx, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.User{ID: 3, FirstName: "Leia", FamilyName: "Organa", Age: 20}, withoutCreationTime(user))
+}
+
+func testOrdering(t *testing.T, database db.DB) {
+	ctx := context.Background()
+	firstNames := []string{"Luke", "Obi-Wan", "Leia", "Han", "Chewbacca"}
+	for _, firstName := range firstNames {
+		_, err := database.CreateUser(ctx, &domain.User{FirstName: firstName})
+		assert.NoError(t, err)
+	}
+	users, err := database.ReadUsers(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, len(firstNames), len(users))
+	for i, user := range users {
+		assert.Equal(t, i+1, user.ID)
+		assert.Equal(t, firstNames[i], user.FirstName)
+	}
+}
+
+func testNotFound(t *testing.T, database db.DB) {
+	ctx := context.Background()
+	for _, id := range []int{-1, 0, 1, 42} {
+		user, err := database.ReadUserByID(ctx, id)
+		assert.Equal(t, db.ErrNotFound, err, "id=%v", id)
+		assert.Nil(t, user, "id=%v", id)
+	}
+}
+
+func testConcurrentCreations(t *testing.T, database db.DB) {
+	ctx := context.Background()
+	const numUsers = 50
+	ids := make(chan int, numUsers)
+	var wg sync.WaitGroup
+	for i := 0; i < numUsers; i++ {
+		wg.Add(1)
+		go func(age int) {
+			defer wg.Done()
+			id, err := database.CreateUser(ctx, &domain.User{FirstName: "Clone", Age: age})
+			assert.NoError(t, err)
+			ids <- id
+		}(i)
+	}
+	wg.Wait()
+	close(ids)
+
+	unique := map[int]struct{}{}
+	for id := range ids {
+		assert.True(t, id >= 1 && id <= numUsers, "unexpected ID %v", id)
+		unique[id] = struct{}{}
+	}
+	assert.Equal(t, numUsers, len(unique))
+
+	users, err := database.ReadUsers(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, numUsers, len(users))
+	for i, user := range users {
+		assert.Equal(t, i+1, user.ID)
+	}
+}
+
+func testContextCancellation(t *testing.T, database db.DB) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Error(t, database.Ping(ctx))
+	_, err := database.CreateUser(ctx, &domain.User{FirstName: "Luke"})
+	assert.Error(t, err)
+	_, err = database.ReadUsers(ctx)
+	assert.Error(t, err)
+	_, err = database.ReadUserByID(ctx, 1)
+	assert.Error(t, err)
+	_, err = database.ReadUserByEmail(ctx, "luke@tatooine.org")
+	assert.Error(t, err)
+
+	// Nothing was stored:
+	users, err := database.ReadUsers(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(users))
+}
+
+func testIsolation(t *testing.T, database db.DB) {
+	ctx := context.Background()
+	user := &domain.User{FirstName: "Luke", FamilyName: "Skywalker", Age: 20}
+	id, err := database.CreateUser(ctx, user)
+	assert.NoError(t, err)
+
+	// The provided user is left untouched, and changing it afterwards does not change the stored one:
+	assert.Equal(t, domain.User{FirstName: "Luke", FamilyName: "Skywalker", Age: 20}, *user)
+	user.FirstName = "Darth"
+
+	// Changing returned users does not change the stored ones either:
+	read, err := database.ReadUserByID(ctx, id)
+	assert.NoError(t, err)
+	read.FamilyName = "Vader"
+	users, err := database.ReadUsers(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(users))
+	users[0].Age = 45
+
+	read, err = database.ReadUserByID(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.User{ID: id, FirstName: "Luke", FamilyName: "Skywalker", Age: 20}, withoutCreationTime(read))
+}
+
+func testDeletion(t *testing.T, database db.DB) {
+	deleter, ok := database.(db.Deleter)
+	if !ok {
+		t.Skipf("%T does not support deleting users", database)
+	}
+	ctx := context.Background()
+	for _, firstName := range []string{"Luke", "Obi-Wan"} {
+		_, err := database.CreateUser(ctx, &domain.User{FirstName: firstName})
+		assert.NoError(t, err)
+	}
+	err := deleter.DeleteUser(ctx, 1)
+	if err == db.ErrNotSupported {
+		t.Skipf("%T does not support deleting users", database)
+	}
+	assert.NoError(t, err)
+	assert.Equal(t, db.ErrNotFound, deleter.DeleteUser(ctx, 1))
+	assert.Equal(t, db.ErrNotFound, deleter.DeleteUser(ctx, 42))
+
+	_, err = database.ReadUserByID(ctx, 1)
+	assert.Equal(t, db.ErrNotFound, err)
+	users, err := database.ReadUsers(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(users))
+	assert.Equal(t, domain.User{ID: 2, FirstName: "Obi-Wan"}, withoutCreationTime(users[0]))
+
+	// IDs of deleted users are not reused:
+	id, err := database.CreateUser(ctx, &domain.User{FirstName: "Leia"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, id)
+}
+
+func testCreationTime(t *testing.T, database db.DB) {
+	ctx := context.Background()
+	before := time.Now().Add(-time.Second) // Tolerate some clock skew between this test and the database.
+	clientSupplied := time.Date(1977, time.May, 25, 0, 0, 0, 0, time.UTC)
+	id, err := database.CreateUser(ctx, &domain.User{FirstName: "Luke", CreatedAt: &clientSupplied})
+	assert.NoError(t, err)
+	after := time.Now().Add(time.Second)
+
+	// Client-supplied creation times are ignored, and creation times are read back in UTC:
+	user, err := database.ReadUserByID(ctx, id)
+	assert.NoError(t, err)
+	if assert.NotNil(t, user.CreatedAt) {
+		assert.True(t, user.CreatedAt.After(before) && user.CreatedAt.Before(after), "unexpected creation time %v", user.CreatedAt)
+		assert.Equal(t, time.UTC, user.CreatedAt.Location())
+	}
+	users, err := database.ReadUsers(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(users))
+	if assert.NotNil(t, users[0].CreatedAt) && user.CreatedAt != nil {
+		assert.True(t, user.CreatedAt.Equal(*users[0].CreatedAt))
+	}
+}
+
+func testEmailUniqueness(t *testing.T, database db.DB) {
+	ctx := context.Background()
+	id, err := database.CreateUser(ctx, &domain.User{FirstName: "Luke", Email: "Luke@Tatooine.org"})
+	assert.NoError(t, err)
+
+	// Emails are unique regardless of case:
+	_, err = database.CreateUser(ctx, &domain.User{FirstName: "Darth", Email: "luke@tatooine.org"})
+	assert.Equal(t, db.ErrEmailTaken, err)
+	users, err := database.ReadUsers(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(users))
+
+	// Users without email never conflict:
+	for _, firstName := range []string{"Obi-Wan", "Leia"} {
+		_, err = database.CreateUser(ctx, &domain.User{FirstName: firstName})
+		assert.NoError(t, err)
+	}
+
+	for _, email := range []string{"Luke@Tatooine.org", "LUKE@tatooine.org"} {
+		user, err := database.ReadUserByEmail(ctx, email)
+		assert.NoError(t, err, email)
+		if assert.NotNil(t, user, email) {
+			assert.Equal(t, id, user.ID, email)
+			assert.Equal(t, "Luke@Tatooine.org", user.Email, email) // Stored as provided.
+		}
+	}
+	for _, email := range []string{"leia@alderaan.org", ""} {
+		_, err = database.ReadUserByEmail(ctx, email)
+		assert.Equal(t, db.ErrNotFound, err, email)
+	}
+
+	// Emails of deleted users can be reused:
+	if deleter, ok := database.(db.Deleter); ok && deleter.DeleteUser(ctx, id) == nil {
+		_, err = database.CreateUser(ctx, &domain.User{FirstName: "Luke", Email: "luke@tatooine.org"})
+		assert.NoError(t, err)
+	}
+}
+
+func testSearch(t *testing.T, database db.DB) {
+	searcher, ok := database.(db.Searcher)
+	if !ok {
+		t.Skipf("%T does not support searching users", database)
+	}
+	ctx := context.Background()
+	for _, user := range []domain.User{
+		{FirstName: "Luke", FamilyName: "Skywalker"},
+		{FirstName: "Leia", FamilyName: "Organa"},
+		{FirstName: "Anakin", FamilyName: "Skywalker"},
+		{FirstName: "Han", FamilyName: "Solo"},
+	} {
+		_, err := database.CreateUser(ctx, &user)
+		assert.NoError(t, err)
+	}
+
+	matches, err := searcher.SearchUsers(ctx, "skywalker", nil, 10)
+	if err == db.ErrNotSupported {
+		t.Skipf("%T does not support searching users", database)
+	}
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 3}, matchIDs(matches))
+	assert.True(t, matches[0].Score > matches[1].Score, "shorter names are more similar")
+	for _, match := range matches {
+		assert.True(t, match.Score > 0.5 && match.Score <= 1, "unexpected score %v: full-text matches score above 0.5", match.Score)
+	}
+
+	// Typos still match, fuzzily, regardless of case:
+	matches, err = searcher.SearchUsers(ctx, "SKYWALKR", nil, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 3}, matchIDs(matches))
+	for _, match := range matches {
+		assert.True(t, match.Score < 0.5, "unexpected score %v: fuzzy matches score below 0.5", match.Score)
+	}
+	matches, err = searcher.SearchUsers(ctx, "chewbacca", nil, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{}, matchIDs(matches))
+
+	// Pages start after the provided cursor:
+	matches, err = searcher.SearchUsers(ctx, "skywalker", nil, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1}, matchIDs(matches))
+	matches, err = searcher.SearchUsers(ctx, "skywalker", matches[0].Cursor(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{3}, matchIDs(matches))
+	matches, err = searcher.SearchUsers(ctx, "skywalker", matches[0].Cursor(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{}, matchIDs(matches))
+}
+
+func testStats(t *testing.T, database db.DB) {
+	aggregator, ok := database.(db.Aggregator)
+	if !ok {
+		t.Skipf("%T does not support aggregating users", database)
+	}
+	ctx := context.Background()
+	stats, err := aggregator.UserStats(ctx, time.Now().Add(-time.Hour), 2)
+	if err == db.ErrNotSupported {
+		t.Skipf("%T does not support aggregating users", database)
+	}
+	assert.NoError(t, err)
+	assert.Equal(t, &db.UserStats{Ages: db.AgeStats{Buckets: []db.AgeBucket{}}, TopFamilyNames: []db.NameCount{}}, stats)
+
+	for _, user := range []domain.User{
+		{FirstName: "Luke", FamilyName: "Skywalker", Age: 19},
+		{FirstName: "Leia", FamilyName: "Organa", Age: 19},
+		{FirstName: "Anakin", FamilyName: "Skywalker", Age: 42},
+		{FirstName: "Han", FamilyName: "Solo", Age: 29},
+		{FirstName: "Chewbacca", Age: 200},
+	} {
+		_, err := database.CreateUser(ctx, &user)
+		assert.NoError(t, err)
+	}
+	stats, err = aggregator.UserStats(ctx, time.Now().Add(-time.Hour), 2)
+	assert.NoError(t, err)
+	average := 61.8
+	assert.Equal(t, &db.UserStats{
+		Total:        5,
+		CreatedSince: 5,
+		Ages: db.AgeStats{
+			Min:     intPtr(19),
+			Max:     intPtr(200),
+			Average: &average,
+			Buckets: []db.AgeBucket{{From: 10, Count: 2}, {From: 20, Count: 1}, {From: 40, Count: 1}, {From: 200, Count: 1}},
+		},
+		// Ties are broken by name, and users without family name are not counted:
+		TopFamilyNames: []db.NameCount{{Name: "Skywalker", Count: 2}, {Name: "Organa", Count: 1}},
+	}, stats)
+
+	// Users created before the provided time are not counted as created since:
+	stats, err = aggregator.UserStats(ctx, time.Now().Add(time.Hour), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, stats.Total)
+	assert.Equal(t, 0, stats.CreatedSince)
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func matchIDs(matches []*db.Match) []int {
+	ids := []int{}
+	for _, match := range matches {
+		ids = append(ids, match.User.ID)
+	}
+	return ids
+}
+
+// withoutCreationTime returns a copy of the provided user without its creation time, which tests cannot predict.
+func withoutCreationTime(user *domain.User) domain.User {
+	clone := *user
+	clone.CreatedAt = nil
+	return clone
+}
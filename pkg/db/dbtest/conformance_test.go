@@ -0,0 +1,12 @@
+package dbtest_test
+
+import (
+	"testing"
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db/dbtest"
+)
+
+// TestConformance runs the conformance suite against InMemoryDB, or PostgreSQLDB with the integration build tag.
+func TestConformance(t *testing.T) {
+	dbtest.Conformance(t, dbtest.Setup)
+}
@@ -3,6 +3,7 @@
 package dbtest
 
 import (
+	"database/sql"
 	"testing"
 
 	"github.com/stretchr/testify/assert" // More readable test assertions.
@@ -10,7 +11,7 @@ import (
 	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db"
 )
 
-// Setup sets up a new in-memory database.
+// Setup sets up a new, empty, PostgreSQL database.
 func Setup(t *testing.T) db.DB {
 	// The below values ought to match what is configured
 	// in the Makefile, under the integration-test target:
@@ -22,9 +23,19 @@ func Setup(t *testing.T) db.DB {
 	database, err := db.NewPostgreSQLDB(config)
 	assert.NoError(t, err)
 	assert.NotNil(t, database)
+	truncate(t, config.RawURI)
 	return database
 }
 
+// truncate empties all tables, and restarts IDs from 1, so that each test starts from the same state.
+func truncate(t *testing.T, uri string) {
+	conn, err := sql.Open("postgres", uri)
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Exec("TRUNCATE users, user_events RESTART IDENTITY")
+	assert.NoError(t, err)
+}
+
 // Cleanup cleans up after a test.
 func Cleanup(t *testing.T, db db.DB) {
 	if db != nil {
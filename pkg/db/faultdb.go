@@ -0,0 +1,445 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag" // POSIX/GNU-style CLI arguments.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+)
+
+// Methods of DB faults can be injected in. AllMethods configures faults for all methods at once.
+const (
+	MethodPing            = "Ping"
+	MethodCreateUser      = "CreateUser"
+	MethodReadUsers       = "ReadUsers"
+	MethodReadUserByID    = "ReadUserByID"
+	MethodReadUserByEmail = "ReadUserByEmail"
+	MethodDeleteUser      = "DeleteUser"
+	MethodSearchUsers     = "SearchUsers"
+	MethodUserStats       = "UserStats"
+	AllMethods            = "*"
+)
+
+var methods = []string{MethodPing, MethodCreateUser, MethodReadUsers, MethodReadUserByID, MethodReadUserByEmail, MethodDeleteUser, MethodSearchUsers, MethodUserStats, AllMethods}
+
+// ErrInjectedFault is returned by FaultyDB when failing a call on purpose.
+var ErrInjectedFault = errors.New("injected fault")
+
+// ErrNotSupported is returned by decorators of DB when the decorated DB does not support the requested operation.
+var ErrNotSupported = errors.New("not supported")
+
+// Fault describes the faults injected in calls to a method of DB.
+// Latency is injected first, then calls time out or fail with the configured probabilities.
+type Fault struct {
+	// Latency is the distribution of the latency added to calls, if any.
+	Latency *Latency `json:"latency,omitempty"`
+	// ErrorRate is the probability, between 0 and 1, of calls failing with ErrInjectedFault.
+	ErrorRate float64 `json:"errorRate,omitempty"`
+	// TimeoutRate is the probability, between 0 and 1, of calls hanging until their context is done.
+	TimeoutRate float64 `json:"timeoutRate,omitempty"`
+}
+
+// Faults maps methods of DB, or AllMethods, to the faults to inject in calls to them.
+type Faults map[string]Fault
+
+// Validate checks these faults apply to known methods, and have valid probabilities.
+func (faults Faults) Validate() error {
+	for method, fault := range faults {
+		if !isMethod(method) {
+			return fmt.Errorf("invalid method: expected one of %q but got %q", methods, method)
+		}
+		if fault.ErrorRate < 0 || fault.ErrorRate > 1 {
+			return fmt.Errorf("invalid error rate for %v: expected a probability between 0 and 1 but got %v", method, fault.ErrorRate)
+		}
+		if fault.TimeoutRate < 0 || fault.TimeoutRate > 1 {
+			return fmt.Errorf("invalid timeout rate for %v: expected a probability between 0 and 1 but got %v", method, fault.TimeoutRate)
+		}
+	}
+	return nil
+}
+
+func isMethod(method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// Distributions of injected latencies.
+const (
+	fixed       = "fixed"       // fixed:<duration>
+	uniform     = "uniform"     // uniform:<min>-<max>
+	normal      = "normal"      // normal:<mean>,<standard deviation>
+	exponential = "exponential" // exponential:<mean>
+)
+
+// Latency is a distribution of latencies, e.g. "fixed:50ms", "uniform:10ms-50ms", "normal:50ms,10ms" or "exponential:20ms".
+type Latency struct {
+	distribution string
+	a, b         time.Duration
+}
+
+// ParseLatency parses the provided latency distribution.
+func ParseLatency(spec string) (*Latency, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid latency %q: expected <distribution>:<parameters>", spec)
+	}
+	var args []string
+	switch parts[0] {
+	case fixed, exponential:
+		args = []string{parts[1]}
+	case uniform:
+		args = strings.SplitN(parts[1], "-", 2)
+	case normal:
+		args = strings.SplitN(parts[1], ",", 2)
+	default:
+		return nil, fmt.Errorf("invalid latency %q: expected one of %q, %q, %q or %q distributions", spec, fixed, uniform, normal, exponential)
+	}
+	durations := make([]time.Duration, 2)
+	for i, arg := range args {
+		d, err := time.ParseDuration(arg)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid latency %q: expected non-negative durations", spec)
+		}
+		durations[i] = d
+	}
+	if (parts[0] == uniform || parts[0] == normal) && len(args) != 2 {
+		return nil, fmt.Errorf("invalid latency %q: %v distribution requires two durations", spec, parts[0])
+	}
+	if parts[0] == uniform && durations[1] < durations[0] {
+		return nil, fmt.Errorf("invalid latency %q: maximum is lower than minimum", spec)
+	}
+	return &Latency{distribution: parts[0], a: durations[0], b: durations[1]}, nil
+}
+
+// String formats this latency distribution the way ParseLatency parses it.
+func (l Latency) String() string {
+	switch l.distribution {
+	case uniform:
+		return fmt.Sprintf("%v:%v-%v", l.distribution, l.a, l.b)
+	case normal:
+		return fmt.Sprintf("%v:%v,%v", l.distribution, l.a, l.b)
+	default:
+		return fmt.Sprintf("%v:%v", l.distribution, l.a)
+	}
+}
+
+// MarshalText serialises this latency distribution, e.g. as JSON.
+func (l Latency) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText deserialises the provided latency distribution, e.g. from JSON.
+func (l *Latency) UnmarshalText(text []byte) error {
+	parsed, err := ParseLatency(string(text))
+	if err != nil {
+		return err
+	}
+	*l = *parsed
+	return nil
+}
+
+// Sample draws a latency from this distribution.
+func (l Latency) Sample() time.Duration {
+	return l.sample(rand.Float64, rand.NormFloat64) // math/rand's global source is thread-safe.
+}
+
+// sample draws a latency from this distribution, using the provided sources of random numbers.
+func (l Latency) sample(random func() float64, normRandom func() float64) time.Duration {
+	var d float64
+	switch l.distribution {
+	case uniform:
+		d = float64(l.a) + random()*float64(l.b-l.a)
+	case normal:
+		d = float64(l.a) + normRandom()*float64(l.b)
+	case exponential:
+		d = -math.Log(1-random()) * float64(l.a)
+	default:
+		d = float64(l.a)
+	}
+	if d < 0 {
+		return 0
+	}
+	return time.Duration(d)
+}
+
+// FaultyDB decorates a DB, injecting latency, errors and timeouts in calls to it. This is mainly useful for chaos testing.
+type FaultyDB struct {
+	db         DB
+	faults     Faults
+	random     *rand.Rand
+	mutex      sync.RWMutex // For thread-safe access to the faults.
+	randomLock sync.Mutex   // For thread-safe access to the random numbers generator.
+}
+
+// NewFaultyDB creates a new DB injecting the provided faults in calls to the provided DB.
+func NewFaultyDB(db DB, faults Faults) (*FaultyDB, error) {
+	database := &FaultyDB{
+		db:     db,
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if err := database.SetFaults(faults); err != nil {
+		return nil, err
+	}
+	return database, nil
+}
+
+// Faults returns the faults currently injected.
+func (database *FaultyDB) Faults() Faults {
+	database.mutex.RLock()
+	defer database.mutex.RUnlock()
+	faults := make(Faults, len(database.faults))
+	for method, fault := range database.faults {
+		faults[method] = fault
+	}
+	return faults
+}
+
+// SetFaults replaces the faults injected.
+func (database *FaultyDB) SetFaults(faults Faults) error {
+	if err := faults.Validate(); err != nil {
+		return err
+	}
+	clone := make(Faults, len(faults))
+	for method, fault := range faults {
+		clone[method] = fault
+	}
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	database.faults = clone
+	return nil
+}
+
+func (database *FaultyDB) fault(method string) (Fault, bool) {
+	database.mutex.RLock()
+	defer database.mutex.RUnlock()
+	if fault, ok := database.faults[method]; ok {
+		return fault, true
+	}
+	fault, ok := database.faults[AllMethods]
+	return fault, ok
+}
+
+func (database *FaultyDB) float64() float64 {
+	database.randomLock.Lock()
+	defer database.randomLock.Unlock()
+	return database.random.Float64()
+}
+
+func (database *FaultyDB) normFloat64() float64 {
+	database.randomLock.Lock()
+	defer database.randomLock.Unlock()
+	return database.random.NormFloat64()
+}
+
+// inject injects the faults configured for the provided method, and returns the resulting error, if any.
+func (database *FaultyDB) inject(ctx context.Context, method string) error {
+	fault, ok := database.fault(method)
+	if !ok {
+		return nil
+	}
+	if fault.Latency != nil {
+		timer := time.NewTimer(fault.Latency.sample(database.float64, database.normFloat64))
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if fault.TimeoutRate > 0 && database.float64() < fault.TimeoutRate {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if fault.ErrorRate > 0 && database.float64() < fault.ErrorRate {
+		return fmt.Errorf("%v: %v", method, ErrInjectedFault)
+	}
+	return nil
+}
+
+// Unwrap returns the decorated DB.
+func (database *FaultyDB) Unwrap() DB {
+	return database.db
+}
+
+// Ping ensures this database client can reach the database.
+func (database *FaultyDB) Ping(ctx context.Context) error {
+	if err := database.inject(ctx, MethodPing); err != nil {
+		return err
+	}
+	return database.db.Ping(ctx)
+}
+
+// CreateUser stores the provided user.
+func (database *FaultyDB) CreateUser(ctx context.Context, user *domain.User) (int, error) {
+	if err := database.inject(ctx, MethodCreateUser); err != nil {
+		return -1, err
+	}
+	return database.db.CreateUser(ctx, user)
+}
+
+// ReadUsers returns all stored users.
+func (database *FaultyDB) ReadUsers(ctx context.Context) ([]*domain.User, error) {
+	if err := database.inject(ctx, MethodReadUsers); err != nil {
+		return nil, err
+	}
+	return database.db.ReadUsers(ctx)
+}
+
+// ReadUserByID return the stored user corresponding to the provided ID.
+func (database *FaultyDB) ReadUserByID(ctx context.Context, id int) (*domain.User, error) {
+	if err := database.inject(ctx, MethodReadUserByID); err != nil {
+		return nil, err
+	}
+	return database.db.ReadUserByID(ctx, id)
+}
+
+// ReadUserByEmail return the stored user with the provided email, regardless of case.
+func (database *FaultyDB) ReadUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	if err := database.inject(ctx, MethodReadUserByEmail); err != nil {
+		return nil, err
+	}
+	return database.db.ReadUserByEmail(ctx, email)
+}
+
+// DeleteUser forwards to the decorated DB, if it is a Deleter.
+func (database *FaultyDB) DeleteUser(ctx context.Context, id int) error {
+	deleter, ok := database.db.(Deleter)
+	if !ok {
+		return ErrNotSupported
+	}
+	if err := database.inject(ctx, MethodDeleteUser); err != nil {
+		return err
+	}
+	return deleter.DeleteUser(ctx, id)
+}
+
+// SearchUsers forwards to the decorated DB, if it is a Searcher.
+func (database *FaultyDB) SearchUsers(ctx context.Context, text string, after *SearchCursor, limit int) ([]*Match, error) {
+	searcher, ok := database.db.(Searcher)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	if err := database.inject(ctx, MethodSearchUsers); err != nil {
+		return nil, err
+	}
+	return searcher.SearchUsers(ctx, text, after, limit)
+}
+
+// UserStats forwards to the decorated DB, if it is an Aggregator.
+func (database *FaultyDB) UserStats(ctx context.Context, since time.Time, topFamilyNames int) (*UserStats, error) {
+	aggregator, ok := database.db.(Aggregator)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	if err := database.inject(ctx, MethodUserStats); err != nil {
+		return nil, err
+	}
+	return aggregator.UserStats(ctx, since, topFamilyNames)
+}
+
+// ReplayEvents forwards to the decorated DB, if it is an Outbox.
+func (database *FaultyDB) ReplayEvents(ctx context.Context, fromID int64) (int64, error) {
+	if outbox, ok := database.db.(Outbox); ok {
+		return outbox.ReplayEvents(ctx, fromID)
+	}
+	return 0, ErrNotSupported
+}
+
+// DeliverEvents forwards to the decorated DB, if it is an Outbox.
+func (database *FaultyDB) DeliverEvents(ctx context.Context, limit int, publish func(*domain.Event) error) (int, error) {
+	if outbox, ok := database.db.(Outbox); ok {
+		return outbox.DeliverEvents(ctx, limit, publish)
+	}
+	return 0, ErrNotSupported
+}
+
+// WatchUsers forwards to the decorated DB, if it is a Watcher.
+func (database *FaultyDB) WatchUsers(ctx context.Context, afterEventID int64) (<-chan *domain.UserChange, error) {
+	if watcher, ok := database.db.(Watcher); ok {
+		return watcher.WatchUsers(ctx, afterEventID)
+	}
+	return nil, ErrNotSupported
+}
+
+// Close closes the decorated DB.
+func (database *FaultyDB) Close() error {
+	return database.db.Close()
+}
+
+// FaultsConfig encapsulates the input required to configure the faults injected in calls to the database.
+type FaultsConfig struct {
+	ErrorRates   []string
+	Latencies    []string
+	TimeoutRates []string
+}
+
+const (
+	dbFaultErrorRate   = "db-fault-error-rate"
+	dbFaultLatency     = "db-fault-latency"
+	dbFaultTimeoutRate = "db-fault-timeout-rate"
+)
+
+// RegisterFlags maps the provided CLI arguments to fields in this configuration object.
+func (cfg *FaultsConfig) RegisterFlags(f *flag.FlagSet) {
+	f.StringArrayVar(&cfg.ErrorRates, dbFaultErrorRate, nil, fmt.Sprintf("Probability of calls to a DB method failing, as <method>=<probability>, e.g. %v=0.1. Method can be %q for all methods. Repeatable", MethodCreateUser, AllMethods))
+	f.StringArrayVar(&cfg.Latencies, dbFaultLatency, nil, fmt.Sprintf("Latency added to calls to a DB method, as <method>=<distribution>, e.g. %v=uniform:10ms-50ms, or fixed:<d>, normal:<mean>,<stddev>, exponential:<mean>. Repeatable", MethodReadUsers))
+	f.StringArrayVar(&cfg.TimeoutRates, dbFaultTimeoutRate, nil, fmt.Sprintf("Probability of calls to a DB method hanging until cancelled, as <method>=<probability>, e.g. %v=0.01. Repeatable", MethodPing))
+}
+
+// Faults returns the faults configured.
+func (cfg FaultsConfig) Faults() (Faults, error) {
+	faults := make(Faults)
+	if err := parseFaults(faults, dbFaultErrorRate, cfg.ErrorRates, func(fault *Fault, value string) error {
+		rate, err := strconv.ParseFloat(value, 64)
+		fault.ErrorRate = rate
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if err := parseFaults(faults, dbFaultLatency, cfg.Latencies, func(fault *Fault, value string) error {
+		latency, err := ParseLatency(value)
+		fault.Latency = latency
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if err := parseFaults(faults, dbFaultTimeoutRate, cfg.TimeoutRates, func(fault *Fault, value string) error {
+		rate, err := strconv.ParseFloat(value, 64)
+		fault.TimeoutRate = rate
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if err := faults.Validate(); err != nil {
+		return nil, err
+	}
+	return faults, nil
+}
+
+func parseFaults(faults Faults, flagName string, values []string, set func(*Fault, string) error) error {
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid --%v: expected <method>=<value> but got %q", flagName, value)
+		}
+		fault := faults[parts[0]]
+		if err := set(&fault, parts[1]); err != nil {
+			return fmt.Errorf("invalid --%v: %v", flagName, err)
+		}
+		faults[parts[0]] = fault
+	}
+	return nil
+}
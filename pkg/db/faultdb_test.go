@@ -0,0 +1,97 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"        // POSIX/GNU-style CLI arguments.
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+)
+
+func TestFaultyDBWithoutFaultsShouldForwardCalls(t *testing.T) {
+	database, err := db.NewFaultyDB(db.NewInMemoryDB(), nil)
+	assert.NoError(t, err)
+	id, err := database.CreateUser(context.Background(), &domain.User{FirstName: "Luke"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, id)
+	users, err := database.ReadUsers(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+}
+
+func TestFaultyDBShouldFailCallsAtConfiguredErrorRate(t *testing.T) {
+	database, err := db.NewFaultyDB(db.NewInMemoryDB(), db.Faults{db.MethodCreateUser: {ErrorRate: 1}})
+	assert.NoError(t, err)
+	_, err = database.CreateUser(context.Background(), &domain.User{FirstName: "Luke"})
+	assert.EqualError(t, err, "CreateUser: injected fault")
+	// Other methods are not affected:
+	assert.NoError(t, database.Ping(context.Background()))
+}
+
+func TestFaultyDBLatencyShouldHonourContext(t *testing.T) {
+	latency, err := db.ParseLatency("fixed:1h")
+	assert.NoError(t, err)
+	database, err := db.NewFaultyDB(db.NewInMemoryDB(), db.Faults{db.AllMethods: {Latency: latency}})
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = database.ReadUsers(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestFaultyDBTimeoutShouldHangUntilContextIsDone(t *testing.T) {
+	database, err := db.NewFaultyDB(db.NewInMemoryDB(), db.Faults{db.MethodReadUserByID: {TimeoutRate: 1}})
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = database.ReadUserByID(ctx, 1)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestFaultyDBShouldRejectInvalidFaults(t *testing.T) {
+	database, err := db.NewFaultyDB(db.NewInMemoryDB(), nil)
+	assert.NoError(t, err)
+	assert.EqualError(t, database.SetFaults(db.Faults{"DropTable": {ErrorRate: 1}}), "invalid method: expected one of [\"Ping\" \"CreateUser\" \"ReadUsers\" \"ReadUserByID\" \"ReadUserByEmail\" \"DeleteUser\" \"SearchUsers\" \"UserStats\" \"*\"] but got \"DropTable\"")
+	assert.EqualError(t, database.SetFaults(db.Faults{db.MethodPing: {ErrorRate: 2}}), "invalid error rate for Ping: expected a probability between 0 and 1 but got 2")
+	assert.Empty(t, database.Faults())
+}
+
+func TestParseLatencyShouldSupportAllDistributions(t *testing.T) {
+	for _, spec := range []string{"fixed:50ms", "uniform:10ms-50ms", "normal:50ms,10ms", "exponential:20ms"} {
+		latency, err := db.ParseLatency(spec)
+		assert.NoError(t, err)
+		assert.Equal(t, spec, latency.String())
+	}
+	_, err := db.ParseLatency("uniform:50ms-10ms")
+	assert.EqualError(t, err, "invalid latency \"uniform:50ms-10ms\": maximum is lower than minimum")
+	_, err = db.ParseLatency("pareto:10ms")
+	assert.Error(t, err)
+}
+
+func TestParsingFaultsArgumentsShouldReturnFaults(t *testing.T) {
+	config := db.FaultsConfig{}
+	cli := flag.NewFlagSet("service-test", flag.ContinueOnError)
+	config.RegisterFlags(cli)
+	assert.NoError(t, cli.Parse([]string{
+		"--db-fault-error-rate", "CreateUser=0.1",
+		"--db-fault-latency", "CreateUser=uniform:10ms-50ms",
+		"--db-fault-timeout-rate", "*=0.01",
+	}))
+	faults, err := config.Faults()
+	assert.NoError(t, err)
+	latency, _ := db.ParseLatency("uniform:10ms-50ms")
+	assert.Equal(t, db.Faults{
+		db.MethodCreateUser: {ErrorRate: 0.1, Latency: latency},
+		db.AllMethods:       {TimeoutRate: 0.01},
+	}, faults)
+}
+
+func TestParsingInvalidFaultsArgumentsShouldReturnError(t *testing.T) {
+	config := db.FaultsConfig{ErrorRates: []string{"CreateUser"}}
+	_, err := config.Faults()
+	assert.EqualError(t, err, "invalid --db-fault-error-rate: expected <method>=<value> but got \"CreateUser\"")
+}
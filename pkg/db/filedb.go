@@ -0,0 +1,424 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus" // Better Logging.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+)
+
+// FileDB is an implementation of DB persisting users to a local, append-only, log file.
+// Each write is flushed to disk before returning, the log is periodically compacted,
+// and the state is recovered from the log on startup. This is mainly useful for local development and demos.
+type FileDB struct {
+	path      string
+	file      *os.File
+	users     map[int]*domain.User
+	nextID    int
+	appended  int // Number of records appended since the last compaction.
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	mutex     sync.Mutex // For thread-safe access to the file and users map.
+}
+
+// FileScheme is the URI scheme selecting FileDB, e.g. file:///var/lib/kds/users.log
+const FileScheme = "file"
+
+const (
+	compactIntervalOption  = "compact-interval"
+	defaultCompactInterval = 10 * time.Minute
+)
+
+// Operations recorded in the log.
+const (
+	opNextID = "next_id"
+	opCreate = "create"
+	opDelete = "delete"
+)
+
+type fileRecord struct {
+	Op     string       `json:"op"`
+	NextID int          `json:"nextId,omitempty"`
+	User   *domain.User `json:"user,omitempty"`
+	ID     int          `json:"id,omitempty"` // Of the user deleted.
+}
+
+func init() {
+	Register(FileScheme, func(uri *url.URL, _ *Config) (DB, error) {
+		log.WithField("path", uri.Path).Info("file database: skipping DB migrations")
+		return OpenFileDB(uri.String())
+	})
+}
+
+// OpenFileDB opens the FileDB corresponding to the provided URI, e.g. file:///var/lib/kds/users.log?compact-interval=10m
+func OpenFileDB(rawURI string) (*FileDB, error) {
+	uri, err := url.Parse(rawURI)
+	if err != nil {
+		return nil, err
+	}
+	if uri.Scheme != FileScheme {
+		return nil, fmt.Errorf("invalid URI: expected scheme %q but got %q", FileScheme, uri.Scheme)
+	}
+	// N.B.: file://users.log would otherwise be parsed as the host "users.log", with an empty path:
+	if len(uri.Host) > 0 || !filepath.IsAbs(uri.Path) {
+		return nil, fmt.Errorf("invalid URI: expected an absolute path, e.g. %v:///var/lib/kds/users.log, but got %q", FileScheme, rawURI)
+	}
+	for option := range uri.Query() {
+		if option != compactIntervalOption {
+			return nil, fmt.Errorf("invalid URI: %v:// only supports the %v option, but got %q", FileScheme, compactIntervalOption, option)
+		}
+	}
+	compactInterval := defaultCompactInterval
+	if value := uri.Query().Get(compactIntervalOption); len(value) > 0 {
+		if compactInterval, err = time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("invalid %v: %v", compactIntervalOption, err)
+		}
+	}
+	return NewFileDB(uri.Path, compactInterval)
+}
+
+// NewFileDB opens, or creates, the provided log file, recovers the users stored in it,
+// and compacts it every compactInterval, if positive.
+func NewFileDB(path string, compactInterval time.Duration) (*FileDB, error) {
+	database := &FileDB{
+		path:   path,
+		users:  make(map[int]*domain.User),
+		nextID: 1,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if err := database.recover(); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	database.file = file
+	if compactInterval > 0 {
+		go database.compactEvery(compactInterval)
+	} else {
+		close(database.done)
+	}
+	return database, nil
+}
+
+// recover replays the log. A partially written last record, e.g. following a crash, is discarded.
+func (database *FileDB) recover() error {
+	file, err := os.OpenFile(database.path, os.O_RDWR, 0600)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				log.WithField("path", database.path).WithField("offset", offset).Warn("discarding partially written record")
+				return truncate(file, offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		record := fileRecord{}
+		if err := json.Unmarshal(bytes.TrimSpace(line), &record); err != nil {
+			return fmt.Errorf("corrupted record at offset %v in %v: %v", offset, database.path, err)
+		}
+		database.apply(&record)
+		offset += int64(len(line))
+	}
+}
+
+func truncate(file *os.File, offset int64) error {
+	if err := file.Truncate(offset); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+func (database *FileDB) apply(record *fileRecord) {
+	switch record.Op {
+	case opNextID:
+		database.nextID = maxInt(database.nextID, record.NextID)
+	case opCreate:
+		database.users[record.User.ID] = record.User
+		database.nextID = maxInt(database.nextID, record.User.ID+1)
+	case opDelete:
+		delete(database.users, record.ID)
+	}
+}
+
+func maxInt(x, y int) int {
+	if x < y {
+		return y
+	}
+	return x
+}
+
+// Ping ensures the log file is still open.
+func (database *FileDB) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	if database.file == nil {
+		return errClosed
+	}
+	return nil
+}
+
+// CreateUser stores the provided user, and flushes it to disk.
+func (database *FileDB) CreateUser(ctx context.Context, user *domain.User) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return -1, err
+	}
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	if database.file == nil {
+		return -1, errClosed
+	}
+	if _, ok := findByEmail(database.users, user.Email); ok {
+		return -1, ErrEmailTaken
+	}
+	created := *user
+	created.ID = database.nextID
+	created.CreatedAt = creationTime()
+	if err := database.append(&fileRecord{Op: opCreate, User: &created}); err != nil {
+		return -1, err
+	}
+	database.users[created.ID] = &created
+	database.nextID++
+	return created.ID, nil
+}
+
+// DeleteUser deletes the stored user corresponding to the provided ID, and flushes the deletion to disk.
+func (database *FileDB) DeleteUser(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	if database.file == nil {
+		return errClosed
+	}
+	if _, ok := database.users[id]; !ok {
+		return ErrNotFound
+	}
+	if err := database.append(&fileRecord{Op: opDelete, ID: id}); err != nil {
+		return err
+	}
+	delete(database.users, id)
+	return nil
+}
+
+// append writes the provided record to the log, and flushes it to disk. It should be called while holding the mutex.
+func (database *FileDB) append(record *fileRecord) error {
+	bytes, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := database.file.Write(append(bytes, '\n')); err != nil {
+		return err
+	}
+	if err := database.file.Sync(); err != nil {
+		return err
+	}
+	database.appended++
+	return nil
+}
+
+// ReadUsers returns all stored users.
+func (database *FileDB) ReadUsers(ctx context.Context) ([]*domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	users := make([]*domain.User, 0, len(database.users))
+	for _, user := range database.sortedUsers() {
+		clone := *user
+		users = append(users, &clone)
+	}
+	return users, nil
+}
+
+// sortedUsers returns the stored users, ordered by ID. It should be called while holding the mutex.
+func (database *FileDB) sortedUsers() []*domain.User {
+	users := make([]*domain.User, 0, len(database.users))
+	for _, user := range database.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users
+}
+
+// ReadUserByID return the stored user corresponding to the provided ID.
+func (database *FileDB) ReadUserByID(ctx context.Context, id int) (*domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	if user, ok := database.users[id]; ok {
+		clone := *user
+		return &clone, nil
+	}
+	return nil, ErrNotFound
+}
+
+// ReadUserByEmail return the stored user with the provided email, regardless of case.
+func (database *FileDB) ReadUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	if user, ok := findByEmail(database.users, email); ok {
+		clone := *user
+		return &clone, nil
+	}
+	return nil, ErrNotFound
+}
+
+// SearchUsers returns the stored users whose full name matches the provided text, by decreasing relevance.
+func (database *FileDB) SearchUsers(ctx context.Context, text string, after *SearchCursor, limit int) ([]*Match, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	return searchUsers(toArray(database.users), text, after, limit), nil
+}
+
+// UserStats aggregates statistics about all stored users.
+func (database *FileDB) UserStats(ctx context.Context, since time.Time, topFamilyNames int) (*UserStats, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	return userStats(toArray(database.users), since, topFamilyNames), nil
+}
+
+func (database *FileDB) compactEvery(interval time.Duration) {
+	defer close(database.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-database.stop:
+			return
+		case <-ticker.C:
+			if err := database.Compact(); err != nil {
+				log.WithField("path", database.path).WithField("err", err).Error("failed to compact log")
+			}
+		}
+	}
+}
+
+// Compact rewrites the log with only the records required to recover the current state, i.e. without deleted users,
+// but with the next ID, so that these users' IDs are never reused.
+// The compacted log is written to a temporary file, flushed to disk, and atomically renamed over the log,
+// so that a crash at any point leaves either the old or the new log in place.
+func (database *FileDB) Compact() error {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	if database.file == nil {
+		return errClosed
+	}
+	if database.appended == 0 {
+		return nil // Nothing new since the last compaction.
+	}
+	tmpPath := database.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if err := writeSnapshot(tmp, database.nextID, database.sortedUsers()); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, database.path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := syncDir(filepath.Dir(database.path)); err != nil {
+		return err
+	}
+	// The file we append to was renamed over, hence re-open the log:
+	file, err := os.OpenFile(database.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	database.file.Close()
+	database.file = file
+	database.appended = 0
+	return nil
+}
+
+func writeSnapshot(file *os.File, nextID int, users []*domain.User) error {
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	if err := encoder.Encode(&fileRecord{Op: opNextID, NextID: nextID}); err != nil {
+		return err
+	}
+	for _, user := range users {
+		if err := encoder.Encode(&fileRecord{Op: opCreate, User: user}); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// syncDir flushes the provided directory to disk, so that renames within it are durable.
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// Close stops compacting the log, and closes it.
+func (database *FileDB) Close() error {
+	var err error
+	database.closeOnce.Do(func() {
+		close(database.stop)
+		<-database.done // Wait for any ongoing compaction to complete.
+		database.mutex.Lock()
+		defer database.mutex.Unlock()
+		err = database.file.Close()
+		database.file = nil
+	})
+	return err
+}
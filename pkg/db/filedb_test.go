@@ -0,0 +1,171 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db/dbtest"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+)
+
+func TestFileDBConformance(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir) // Clean-up.
+	i := 0
+	dbtest.Conformance(t, func(t *testing.T) db.DB {
+		i++
+		database, err := db.NewFileDB(filepath.Join(dir, fmt.Sprintf("users-%v.log", i)), 0)
+		assert.NoError(t, err)
+		return database
+	})
+}
+
+func TestFileDBShouldRecoverUsersAndNextIDOnRestart(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir) // Clean-up.
+	uri := "file://" + filepath.Join(dir, "users.log")
+	ctx := context.Background()
+
+	database, err := db.OpenFileDB(uri)
+	assert.NoError(t, err)
+	id, err := database.CreateUser(ctx, &domain.User{FirstName: "Luke", FamilyName: "Skywalker", Age: 20})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, id)
+	assert.NoError(t, database.Close())
+
+	database, err = db.OpenFileDB(uri)
+	assert.NoError(t, err)
+	defer database.Close()
+	user, err := database.ReadUserByID(ctx, 1)
+	assert.NoError(t, err)
+	assert.NotNil(t, user.CreatedAt) // Persisted too.
+	user.CreatedAt = nil
+	assert.Equal(t, domain.User{ID: 1, FirstName: "Luke", FamilyName: "Skywalker", Age: 20}, *user)
+	id, err = database.CreateUser(ctx, &domain.User{FirstName: "Obi-Wan", FamilyName: "Kenobi", Age: 40})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, id)
+}
+
+func TestFileDBShouldDiscardPartiallyWrittenRecord(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir) // Clean-up.
+	path := filepath.Join(dir, "users.log")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("{\"op\":\"create\",\"user\":{\"id\":1,\"firstName\":\"Luke\",\"familyName\":\"Skywalker\",\"age\":20}}\n{\"op\":\"cre"), 0600))
+
+	database, err := db.NewFileDB(path, 0)
+	assert.NoError(t, err)
+	defer database.Close()
+	users, err := database.ReadUsers(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	id, err := database.CreateUser(context.Background(), &domain.User{FirstName: "Obi-Wan"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, id)
+}
+
+func TestFileDBShouldFailOnCorruptedRecord(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir) // Clean-up.
+	path := filepath.Join(dir, "users.log")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("not-json\n{\"op\":\"next_id\",\"nextId\":2}\n"), 0600))
+
+	database, err := db.NewFileDB(path, 0)
+	assert.Error(t, err)
+	assert.Nil(t, database)
+}
+
+func TestFileDBCompactionShouldPreserveState(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir) // Clean-up.
+	path := filepath.Join(dir, "users.log")
+	ctx := context.Background()
+
+	database, err := db.NewFileDB(path, 0)
+	assert.NoError(t, err)
+	for _, firstName := range []string{"Luke", "Obi-Wan", "Yoda"} {
+		_, err := database.CreateUser(ctx, &domain.User{FirstName: firstName})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, database.Compact())
+	_, err = database.CreateUser(ctx, &domain.User{FirstName: "Leia"})
+	assert.NoError(t, err)
+	assert.NoError(t, database.Close())
+
+	database, err = db.NewFileDB(path, 0)
+	assert.NoError(t, err)
+	defer database.Close()
+	users, err := database.ReadUsers(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, users, 4)
+	assert.Equal(t, "Leia", users[3].FirstName)
+	assert.Equal(t, 4, users[3].ID)
+}
+
+func TestFileDBShouldRecoverAndCompactDeletions(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir) // Clean-up.
+	path := filepath.Join(dir, "users.log")
+	ctx := context.Background()
+
+	database, err := db.NewFileDB(path, 0)
+	assert.NoError(t, err)
+	for _, firstName := range []string{"Luke", "Obi-Wan"} {
+		_, err := database.CreateUser(ctx, &domain.User{FirstName: firstName})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, database.DeleteUser(ctx, 2))
+	assert.NoError(t, database.Close())
+
+	database, err = db.NewFileDB(path, 0)
+	assert.NoError(t, err)
+	users, err := database.ReadUsers(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, db.ErrNotFound, database.DeleteUser(ctx, 2))
+	assert.NoError(t, database.Compact())
+	assert.NoError(t, database.Close())
+
+	// Deleted users' IDs are never reused, even after compaction:
+	database, err = db.NewFileDB(path, 0)
+	assert.NoError(t, err)
+	defer database.Close()
+	_, err = database.ReadUserByID(ctx, 2)
+	assert.Equal(t, db.ErrNotFound, err)
+	id, err := database.CreateUser(ctx, &domain.User{FirstName: "Yoda"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, id)
+}
+
+func TestOpenFileDBShouldRejectUnknownOptions(t *testing.T) {
+	database, err := db.OpenFileDB("file:///tmp/users.log?compact-interval=1m&sslmode=disable")
+	assert.EqualError(t, err, "invalid URI: file:// only supports the compact-interval option, but got \"sslmode\"")
+	assert.Nil(t, database)
+}
+
+func TestOpenFileDBShouldRejectRelativePaths(t *testing.T) {
+	for _, uri := range []string{"file://users.log", "file:users.log", "file://host/tmp/users.log"} {
+		database, err := db.OpenFileDB(uri)
+		assert.EqualError(t, err, fmt.Sprintf("invalid URI: expected an absolute path, e.g. file:///var/lib/kds/users.log, but got %q", uri))
+		assert.Nil(t, database)
+	}
+}
+
+func TestOpenFileDBShouldRejectInvalidCompactInterval(t *testing.T) {
+	database, err := db.OpenFileDB("file:///tmp/users.log?compact-interval=often")
+	assert.EqualError(t, err, "invalid compact-interval: time: invalid duration \"often\"")
+	assert.Nil(t, database)
+}
+
+// Utility function to generate a temporary directory.
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir(os.TempDir(), "filedb")
+	assert.NoError(t, err)
+	return dir
+}
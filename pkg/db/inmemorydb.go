@@ -0,0 +1,334 @@
+package db
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus" // Better Logging.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+)
+
+// InMemoryDB is an in-memory implementation of DB. This is mainly useful for testing and demos, as nothing is persisted.
+type InMemoryDB struct {
+	users       map[int]*domain.User
+	nextID      int
+	events      []*inMemoryEvent
+	nextEventID int64
+	watchers    map[chan *domain.UserChange]struct{}
+	mutex       sync.Mutex // For thread-safe access to the users map, events and watchers.
+	relayMutex  sync.Mutex // For events to be delivered by one caller at a time.
+}
+
+type inMemoryEvent struct {
+	event     *domain.Event
+	delivered bool
+}
+
+// MemoryScheme is the URI scheme selecting InMemoryDB, i.e. memory://
+const MemoryScheme = "memory"
+
+func init() {
+	Register(MemoryScheme, func(uri *url.URL, _ *Config) (DB, error) {
+		if err := noOptions(uri); err != nil {
+			return nil, err
+		}
+		log.Info("in-memory database: skipping DB migrations, and nothing will be persisted")
+		return NewInMemoryDB(), nil
+	})
+}
+
+// NewInMemoryDB creates a new in-memory DB.
+func NewInMemoryDB() *InMemoryDB {
+	return &InMemoryDB{
+		users:       make(map[int]*domain.User),
+		nextID:      1,
+		nextEventID: 1,
+		watchers:    make(map[chan *domain.UserChange]struct{}),
+	}
+}
+
+// Ping ensures this database client can reach the database.
+func (database *InMemoryDB) Ping(ctx context.Context) error {
+	return ctx.Err() // Nothing to check or connect to in this specific implementation of db.DB.
+}
+
+// CreateUser stores a copy of the provided user, under a new ID. Like PostgreSQLDB, it ignores the provided user's ID.
+func (database *InMemoryDB) CreateUser(ctx context.Context, user *domain.User) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return -1, err
+	}
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	if _, ok := findByEmail(database.users, user.Email); ok {
+		return -1, ErrEmailTaken
+	}
+	created := *user
+	created.ID = database.nextID
+	created.CreatedAt = creationTime()
+	event, err := domain.NewUserEvent(domain.UserCreated, &created)
+	if err != nil {
+		return -1, err
+	}
+	database.nextID++
+	database.users[created.ID] = &created
+	database.appendEvent(event)
+	change := created
+	database.notify(&domain.UserChange{ID: event.ID, Type: event.Type, User: &change})
+	return created.ID, nil
+}
+
+func (database *InMemoryDB) appendEvent(event *domain.Event) {
+	event.ID = database.nextEventID
+	database.nextEventID++
+	database.events = append(database.events, &inMemoryEvent{event: event})
+}
+
+// ReadUsers returns copies of all stored users, ordered by ID.
+func (database *InMemoryDB) ReadUsers(ctx context.Context) ([]*domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	return toArray(database.users), nil
+}
+
+func toArray(usersMap map[int]*domain.User) []*domain.User {
+	users := make([]*domain.User, len(usersMap))
+	i := 0
+	for _, user := range usersMap {
+		clone := *user
+		users[i] = &clone
+		i++
+	}
+	sort.Sort(ByID(users))
+	return users
+}
+
+// ByID implements sort.Interface for []*domain.User based on the ID field.
+type ByID []*domain.User
+
+func (a ByID) Len() int           { return len(a) }
+func (a ByID) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a ByID) Less(i, j int) bool { return a[i].ID < a[j].ID }
+
+// ReadUserByID return a copy of the stored user corresponding to the provided ID.
+func (database *InMemoryDB) ReadUserByID(ctx context.Context, id int) (*domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	if user, ok := database.users[id]; ok {
+		clone := *user
+		return &clone, nil
+	}
+	return nil, ErrNotFound
+}
+
+// ReadUserByEmail return a copy of the stored user with the provided email, regardless of case.
+func (database *InMemoryDB) ReadUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	if user, ok := findByEmail(database.users, email); ok {
+		clone := *user
+		return &clone, nil
+	}
+	return nil, ErrNotFound
+}
+
+// SearchUsers returns copies of the stored users whose full name matches the provided text, by decreasing relevance.
+func (database *InMemoryDB) SearchUsers(ctx context.Context, text string, after *SearchCursor, limit int) ([]*Match, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	return searchUsers(toArray(database.users), text, after, limit), nil
+}
+
+// UserStats aggregates statistics about all stored users.
+func (database *InMemoryDB) UserStats(ctx context.Context, since time.Time, topFamilyNames int) (*UserStats, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	return userStats(toArray(database.users), since, topFamilyNames), nil
+}
+
+// findByEmail returns the user among the provided ones with the provided email, regardless of case, if any.
+func findByEmail(users map[int]*domain.User, email string) (*domain.User, bool) {
+	if len(email) == 0 {
+		return nil, false // Users without email never conflict.
+	}
+	normalized := domain.NormalizeEmail(email)
+	for _, user := range users {
+		if domain.NormalizeEmail(user.Email) == normalized {
+			return user, true
+		}
+	}
+	return nil, false
+}
+
+// DeleteUser deletes the stored user corresponding to the provided ID.
+func (database *InMemoryDB) DeleteUser(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+
+	user, ok := database.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	event, err := domain.NewUserEvent(domain.UserDeleted, user)
+	if err != nil {
+		return err
+	}
+	delete(database.users, id)
+	database.appendEvent(event)
+	database.notify(&domain.UserChange{ID: event.ID, Type: event.Type, User: user})
+	return nil
+}
+
+// DeliverEvents publishes, oldest first, up to limit pending events, and marks the ones published as delivered.
+func (database *InMemoryDB) DeliverEvents(_ context.Context, limit int, publish func(*domain.Event) error) (int, error) {
+	database.relayMutex.Lock()
+	defer database.relayMutex.Unlock()
+	delivered := 0
+	for _, event := range database.pendingEvents(limit) {
+		if err := publish(event); err != nil {
+			return delivered, err
+		}
+		database.markDelivered(event.ID)
+		delivered++
+	}
+	return delivered, nil
+}
+
+func (database *InMemoryDB) pendingEvents(limit int) []*domain.Event {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	events := []*domain.Event{}
+	for _, e := range database.events {
+		if len(events) >= limit {
+			break
+		}
+		if !e.delivered {
+			events = append(events, e.event)
+		}
+	}
+	return events
+}
+
+func (database *InMemoryDB) markDelivered(id int64) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	if e := database.event(id); e != nil {
+		e.delivered = true
+	}
+}
+
+// ReplayEvents marks all delivered events with an ID greater than or equal to the provided one as pending again.
+func (database *InMemoryDB) ReplayEvents(_ context.Context, fromID int64) (int64, error) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	var replayed int64
+	for _, e := range database.events {
+		if e.event.ID >= fromID && e.delivered {
+			e.delivered = false
+			replayed++
+		}
+	}
+	return replayed, nil
+}
+
+// event returns the event corresponding to the provided ID, or nil if there is none.
+// Events are stored by increasing ID, starting from 1, hence the direct lookup.
+func (database *InMemoryDB) event(id int64) *inMemoryEvent {
+	if id < 1 || id > int64(len(database.events)) {
+		return nil
+	}
+	return database.events[id-1]
+}
+
+// WatchUsers streams changes recorded after the event with the provided ID.
+func (database *InMemoryDB) WatchUsers(ctx context.Context, afterEventID int64) (<-chan *domain.UserChange, error) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	// Snapshot past changes and subscribe to new ones atomically, so that none is missed nor duplicated:
+	if afterEventID == LatestEvent {
+		afterEventID = int64(len(database.events))
+	}
+	past := []*domain.UserChange{}
+	for _, e := range database.events {
+		if e.event.ID > afterEventID {
+			change, err := e.event.UserChange()
+			if err != nil {
+				return nil, err
+			}
+			past = append(past, change)
+		}
+	}
+	watcher := make(chan *domain.UserChange, watcherBufferSize)
+	database.watchers[watcher] = struct{}{}
+
+	changes := make(chan *domain.UserChange)
+	go func() {
+		defer close(changes)
+		defer database.unwatch(watcher)
+		for _, change := range past {
+			if !SendChange(ctx, changes, change) {
+				return
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case change, ok := <-watcher:
+				if !ok || !SendChange(ctx, changes, change) {
+					return
+				}
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// notify sends the provided change to all watchers. It should be called while holding the mutex.
+func (database *InMemoryDB) notify(change *domain.UserChange) {
+	for watcher := range database.watchers {
+		select {
+		case watcher <- change:
+		default:
+			// This watcher is too slow to keep up, disconnect it:
+			delete(database.watchers, watcher)
+			close(watcher)
+		}
+	}
+}
+
+func (database *InMemoryDB) unwatch(watcher chan *domain.UserChange) {
+	database.mutex.Lock()
+	defer database.mutex.Unlock()
+	if _, ok := database.watchers[watcher]; ok {
+		delete(database.watchers, watcher)
+		close(watcher)
+	}
+}
+
+// Close is a no-op, but present so that we implement the DB interface.
+func (database *InMemoryDB) Close() error {
+	return nil
+}
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS user_events (
+  id           BIGSERIAL PRIMARY KEY,
+  type         TEXT NOT NULL,
+  user_id      INTEGER NOT NULL,
+  payload      JSONB NOT NULL,
+  created_at   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  delivered_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS user_events_pending_idx ON user_events (id) WHERE delivered_at IS NULL;
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS users_changes ON user_events;
+DROP FUNCTION IF EXISTS notify_users_changes();
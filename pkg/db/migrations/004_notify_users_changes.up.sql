@@ -0,0 +1,11 @@
+-- Every write to users records an event in user_events within the same transaction,
+-- hence notifying on user_events notifies on all changes to users, identified by their event ID.
+CREATE OR REPLACE FUNCTION notify_users_changes() RETURNS TRIGGER AS $$
+BEGIN
+  PERFORM pg_notify('users_changes', NEW.id::text);
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS users_changes ON user_events;
+CREATE TRIGGER users_changes AFTER INSERT ON user_events FOR EACH ROW EXECUTE PROCEDURE notify_users_changes();
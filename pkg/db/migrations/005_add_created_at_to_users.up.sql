@@ -0,0 +1,3 @@
+-- Users created before this migration are left without a creation time, rather than being given a made-up one.
+ALTER TABLE users ADD COLUMN created_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ALTER COLUMN created_at SET DEFAULT now();
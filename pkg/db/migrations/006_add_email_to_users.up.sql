@@ -0,0 +1,4 @@
+-- Expand only: existing users are left without email, and older versions of the service, which do not know about it,
+-- keep working. Emails are unique regardless of case, but users without email never conflict, as NULLs are distinct.
+ALTER TABLE users ADD COLUMN email TEXT;
+CREATE UNIQUE INDEX users_email_key ON users (lower(email));
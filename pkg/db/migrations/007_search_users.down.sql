@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_name_fts;
+DROP INDEX IF EXISTS users_name_trgm;
+DROP EXTENSION IF EXISTS pg_trgm;
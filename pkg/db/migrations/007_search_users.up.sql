@@ -0,0 +1,6 @@
+-- pg_trgm provides the similarity function and % operator used to search users by name, fuzzily.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- IMPORTANT: these expressions ought to match the ones searched on by PostgreSQLDB, for these indexes to be used.
+CREATE INDEX IF NOT EXISTS users_name_trgm ON users USING GIN ((coalesce(first_name, '') || ' ' || coalesce(family_name, '')) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_name_fts ON users USING GIN (to_tsvector('simple', coalesce(first_name, '') || ' ' || coalesce(family_name, '')));
@@ -0,0 +1,3 @@
+-- Events pending delivery are leased to the relay publishing them until leased_until, so that this relay does not keep
+-- a transaction open while publishing these, and that other replicas do not deliver them concurrently, out of order.
+ALTER TABLE user_events ADD COLUMN leased_until TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS user_events_position_idx;
+ALTER TABLE user_events DROP COLUMN xact_id;
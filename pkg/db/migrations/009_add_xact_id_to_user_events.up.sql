@@ -0,0 +1,6 @@
+-- Events are recorded without any lock serialising writes, hence their IDs, allocated before their transactions commit,
+-- may be committed out of order. xact_id records the ID of the transaction which recorded each event: watchers stream
+-- events by (xact_id, id), and only once all transactions with a lower ID have ended, so that no event committed later
+-- may precede the ones already streamed. Existing events all get the ID of this migration's transaction.
+ALTER TABLE user_events ADD COLUMN xact_id BIGINT NOT NULL DEFAULT txid_current();
+CREATE INDEX IF NOT EXISTS user_events_position_idx ON user_events (xact_id, id);
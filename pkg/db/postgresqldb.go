@@ -3,24 +3,53 @@ package db
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"                  // DB DSL.
 	"github.com/golang-migrate/migrate"                   // DB migrations.
 	"github.com/golang-migrate/migrate/database/postgres" // DB migrations for PostgreSQL.
 	_ "github.com/golang-migrate/migrate/source/file"     // DB migrations for PostgreSQL.
-	_ "github.com/lib/pq"                                 // DB PostgreSQL drivers.
+	"github.com/lib/pq"                                   // DB PostgreSQL drivers.
 	log "github.com/sirupsen/logrus"                      // Better Logging.
 
 	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/filewatch"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
 )
 
 // PostgreSQLDB is a PostgreSQL-compatible implementation of DB.
+// If the database password is read from a file, connections are re-established with the new password whenever it changes.
 type PostgreSQLDB struct {
-	db *sql.DB
+	config       *Config
+	pool         *pool
+	mutex        sync.RWMutex // For thread-safe access to the pool.
+	feed         *changesFeed
+	stopWatching context.CancelFunc
 }
 
 const driverName = "postgres"
 
+func init() {
+	for _, scheme := range []string{"postgres", "postgresql"} {
+		Register(scheme, func(_ *url.URL, config *Config) (DB, error) {
+			return NewPostgreSQLDB(config)
+		})
+	}
+}
+
+// Connection pool options, removed from the URI before passing it to the PostgreSQL driver,
+// e.g. postgres://postgres@localhost:5432/users?sslmode=disable&max-open-conns=10
+const (
+	maxOpenConnsOption    = "max-open-conns"
+	maxIdleConnsOption    = "max-idle-conns"
+	connMaxLifetimeOption = "conn-max-lifetime"
+)
+
 // NewPostgreSQLDB creates a new connection to the configured PostgreSQL DB.
 func NewPostgreSQLDB(config *Config) (*PostgreSQLDB, error) {
 	uri, err := config.URI()
@@ -28,17 +57,85 @@ func NewPostgreSQLDB(config *Config) (*PostgreSQLDB, error) {
 		log.WithField("err", err).Error("failed to get DB URI")
 		return nil, err
 	}
-	db, err := sql.Open(driverName, uri)
+	db, uri, err := openPool(uri)
 	if err != nil {
-		log.WithField("uri", uri).WithField("err", err).Error("failed to open connection")
 		return nil, err
 	}
 	if err := runDBMigrations(db, config.MigrationsDir, config.SchemaVersion, uri); err != nil {
 		return nil, err
 	}
-	return &PostgreSQLDB{
-		db: db,
-	}, nil
+	ctx, cancel := context.WithCancel(context.Background())
+	database := &PostgreSQLDB{
+		config:       config,
+		pool:         &pool{db: db},
+		stopWatching: cancel,
+	}
+	database.feed = newChangesFeed(database, uri)
+	if len(config.passwordFile) > 0 && config.PasswordReloadInterval > 0 {
+		go filewatch.Poll(ctx, config.PasswordReloadInterval, []string{config.passwordFile}, database.reconnect)
+	}
+	return database, nil
+}
+
+// openPool opens a connection pool to the database at the provided URI, and returns it along with the URI stripped of pool options.
+func openPool(uri string) (*sql.DB, string, error) {
+	uri, configurePool, err := poolOptions(uri)
+	if err != nil {
+		log.WithField("err", err).Error("invalid DB connection pool options")
+		return nil, "", err
+	}
+	db, err := sql.Open(driverName, uri)
+	if err != nil {
+		log.WithField("uri", logging.Redact(uri)).WithField("err", err).Error("failed to open connection")
+		return nil, "", err
+	}
+	configurePool(db)
+	return db, uri, nil
+}
+
+// poolOptions removes the connection pool options from the provided URI,
+// and returns it along with a function applying these options to a connection pool.
+func poolOptions(rawURI string) (string, func(*sql.DB), error) {
+	uri, err := url.Parse(rawURI)
+	if err != nil {
+		return "", nil, err
+	}
+	query := uri.Query()
+	var setters []func(*sql.DB)
+	if value := query.Get(maxOpenConnsOption); len(value) > 0 {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid %v: %v", maxOpenConnsOption, err)
+		}
+		setters = append(setters, func(db *sql.DB) { db.SetMaxOpenConns(n) })
+	}
+	if value := query.Get(maxIdleConnsOption); len(value) > 0 {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid %v: %v", maxIdleConnsOption, err)
+		}
+		setters = append(setters, func(db *sql.DB) { db.SetMaxIdleConns(n) })
+	}
+	if value := query.Get(connMaxLifetimeOption); len(value) > 0 {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid %v: %v", connMaxLifetimeOption, err)
+		}
+		setters = append(setters, func(db *sql.DB) { db.SetConnMaxLifetime(d) })
+	}
+	configurePool := func(db *sql.DB) {
+		for _, set := range setters {
+			set(db)
+		}
+	}
+	if len(setters) == 0 {
+		return rawURI, configurePool, nil
+	}
+	query.Del(maxOpenConnsOption)
+	query.Del(maxIdleConnsOption)
+	query.Del(connMaxLifetimeOption)
+	uri.RawQuery = query.Encode()
+	return uri.String(), configurePool, nil
 }
 
 func runDBMigrations(db *sql.DB, migrationsDir string, targetVersion uint, uri string) error {
@@ -88,40 +185,117 @@ const (
 	firstName  = "first_name"
 	familyName = "family_name"
 	age        = "age"
+	email      = "email"
+
+	userEvents  = "user_events"
+	eventType   = "type"
+	userID      = "user_id"
+	payload     = "payload"
+	createdAt   = "created_at"
+	deliveredAt = "delivered_at"
+	leasedUntil = "leased_until"
+	xactID      = "xact_id"
 )
 
 // Ping ensures this database client can reach the database.
-func (db PostgreSQLDB) Ping(ctx context.Context) error {
-	return db.db.PingContext(ctx)
+func (db *PostgreSQLDB) Ping(ctx context.Context) error {
+	pool := db.acquire()
+	defer pool.release()
+	return pool.db.PingContext(ctx)
+}
+
+// CreateUser stores the provided user, and records the corresponding event in the same transaction.
+func (db *PostgreSQLDB) CreateUser(ctx context.Context, user *domain.User) (int, error) {
+	pool := db.acquire()
+	defer pool.release()
+	tx, err := pool.db.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, err
+	}
+	id, err := createUser(ctx, tx, user)
+	if err != nil {
+		rollback(tx)
+		return -1, err
+	}
+	if err := tx.Commit(); err != nil {
+		return -1, err
+	}
+	return id, nil
 }
 
-// CreateUser stores the provided user.
-func (db PostgreSQLDB) CreateUser(ctx context.Context, user *domain.User) (int, error) {
-	var id int
-	err := debugInsert(
-		db.query().
+func rollback(tx *sql.Tx) {
+	if err := tx.Rollback(); err != nil {
+		log.WithField("err", err).Error("failed to roll back transaction")
+	}
+}
+
+func createUser(ctx context.Context, tx *sql.Tx, user *domain.User) (int, error) {
+	created := *user
+	err := debugInsert(ctx,
+		query(tx).
 			Insert(users).
-			Columns(firstName, familyName, age).
-			Values(user.FirstName, user.FamilyName, user.Age).
-			Suffix("RETURNING id")).
+			Columns(firstName, familyName, age, email).
+			Values(user.FirstName, user.FamilyName, user.Age, nullable(user.Email)).
+			Suffix("RETURNING id, "+createdAt)).
 		QueryRowContext(ctx).
-		Scan(&id)
+		Scan(&created.ID, &created.CreatedAt)
+	if isUniqueViolation(err, usersEmailIndex) {
+		return -1, ErrEmailTaken
+	}
 	if err != nil {
 		return -1, err
 	}
-	return id, nil
+	inUTC(&created)
+	if err := insertEvent(ctx, tx, domain.UserCreated, &created); err != nil {
+		return -1, err
+	}
+	return created.ID, nil
 }
 
-func (db PostgreSQLDB) selectUsers() sq.SelectBuilder {
+// usersEmailIndex is the case-insensitive unique index on users' emails.
+// IMPORTANT: make sure this matches migration 006_add_email_to_users under pkg/db/migrations/
+const usersEmailIndex = "users_email_key"
+
+// uniqueViolation is PostgreSQL's error code for violations of unique constraints and indexes.
+const uniqueViolation = "23505"
+
+func isUniqueViolation(err error, index string) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == uniqueViolation && pqErr.Constraint == index
+}
+
+// nullable returns the provided string, or NULL if it is empty.
+func nullable(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: len(value) > 0}
+}
+
+func insertEvent(ctx context.Context, tx *sql.Tx, kind string, user *domain.User) error {
+	event, err := domain.NewUserEvent(kind, user)
+	if err != nil {
+		return err
+	}
+	// N.B.: no lock serialises writes, hence events may be committed out of the order of their IDs, see position.
+	_, err = debugInsert(ctx,
+		query(tx).
+			Insert(userEvents).
+			Columns(eventType, userID, payload).
+			Values(event.Type, event.UserID, string(event.Payload))).
+		ExecContext(ctx)
+	return err
+}
+
+func selectUsers(runner sq.BaseRunner) sq.SelectBuilder {
 	// The order of the below columns ought to match
 	// the order of the fields in scanUser and scanOne:
-	return db.query().Select(id, firstName, familyName, age).From(users)
+	return query(runner).Select(id, firstName, familyName, age, createdAt, email).From(users)
 }
 
 // ReadUsers returns all stored users.
-func (db PostgreSQLDB) ReadUsers(ctx context.Context) ([]*domain.User, error) {
-	rows, err := debugSelect(
-		db.selectUsers().OrderBy("id ASC")).
+func (db *PostgreSQLDB) ReadUsers(ctx context.Context) ([]*domain.User, error) {
+	pool := db.acquire()
+	defer pool.release()
+	rows, err := debugSelect(ctx,
+		selectUsers(pool.db).OrderBy("id ASC")).
 		QueryContext(ctx)
 	if err != nil {
 		return nil, err
@@ -135,9 +309,11 @@ func (db PostgreSQLDB) ReadUsers(ctx context.Context) ([]*domain.User, error) {
 }
 
 // ReadUserByID return the stored user corresponding to the provided ID.
-func (db PostgreSQLDB) ReadUserByID(ctx context.Context, userID int) (*domain.User, error) {
-	user, err := scanUser(debugSelect(
-		db.selectUsers().Where(sq.Eq{id: userID})).
+func (db *PostgreSQLDB) ReadUserByID(ctx context.Context, userID int) (*domain.User, error) {
+	pool := db.acquire()
+	defer pool.release()
+	user, err := scanUser(debugSelect(ctx,
+		selectUsers(pool.db).Where(sq.Eq{id: userID})).
 		QueryRowContext(ctx))
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -149,22 +325,386 @@ func (db PostgreSQLDB) ReadUserByID(ctx context.Context, userID int) (*domain.Us
 	return user, nil
 }
 
-func (db PostgreSQLDB) query() sq.StatementBuilderType {
-	return sq.StatementBuilder.PlaceholderFormat(sq.Dollar).RunWith(db.db)
+// ReadUserByEmail return the stored user with the provided email, regardless of case.
+func (db *PostgreSQLDB) ReadUserByEmail(ctx context.Context, userEmail string) (*domain.User, error) {
+	pool := db.acquire()
+	defer pool.release()
+	// Compare lower-cased emails, as per users_email_key, for this index to be used:
+	user, err := scanUser(debugSelect(ctx,
+		selectUsers(pool.db).Where(sq.Expr("lower("+email+") = lower(?)", userEmail))).
+		QueryRowContext(ctx))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		} else {
+			return nil, err
+		}
+	}
+	return user, nil
 }
 
-func debugInsert(query sq.InsertBuilder) sq.InsertBuilder {
-	sql, args, err := query.ToSql()
-	log.WithField("sql", sql).WithField("args", args).WithField("err", err).Debug("insert query")
+// IMPORTANT: make sure the below expressions match the indexes of migration 007_search_users under pkg/db/migrations/,
+// and the scoring of searchUsers under pkg/db/search.go.
+const (
+	nameExpr     = "(coalesce(first_name, '') || ' ' || coalesce(family_name, ''))"
+	fullTextExpr = "to_tsvector('simple', " + nameExpr + ") @@ plainto_tsquery('simple', ?)"
+	scoreExpr    = "((similarity(" + nameExpr + ", ?) + CASE WHEN " + fullTextExpr + " THEN 1::real ELSE 0::real END) / 2::real)::float8" // In single precision, like similarity.
+)
+
+// SearchUsers returns the stored users whose full name matches the provided text, by decreasing relevance.
+// Names match fuzzily as per pg_trgm's % operator, i.e. with a trigram similarity of at least 0.3 by default, or word for word.
+func (db *PostgreSQLDB) SearchUsers(ctx context.Context, text string, after *SearchCursor, limit int) ([]*Match, error) {
+	pool := db.acquire()
+	defer pool.release()
+	search := selectUsers(pool.db).
+		Column(scoreExpr+" AS score", text, text).
+		Where("("+nameExpr+" % ? OR "+fullTextExpr+")", text, text)
+	if after != nil {
+		search = search.Where("("+scoreExpr+" < ? OR ("+scoreExpr+" = ? AND id > ?))", text, text, after.Score, text, text, after.Score, after.ID)
+	}
+	rows, err := debugSelect(ctx,
+		search.OrderBy("score DESC", "id ASC").Limit(uint64(limit))).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	matches := []*Match{}
+	for rows.Next() {
+		match, err := scanMatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, match)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// UserStats aggregates statistics about all stored users, from a consistent snapshot of the database.
+func (db *PostgreSQLDB) UserStats(ctx context.Context, since time.Time, topFamilyNames int) (*UserStats, error) {
+	pool := db.acquire()
+	defer pool.release()
+	tx, err := pool.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer rollback(tx) // Nothing to commit.
+	return userStatsIn(ctx, tx, since, topFamilyNames)
+}
+
+// IMPORTANT: make sure the below aggregation matches userStats under pkg/db/stats.go.
+func userStatsIn(ctx context.Context, tx *sql.Tx, since time.Time, topFamilyNames int) (*UserStats, error) {
+	stats := &UserStats{Ages: AgeStats{Buckets: []AgeBucket{}}, TopFamilyNames: []NameCount{}}
+	var minAge, maxAge sql.NullInt64
+	var averageAge sql.NullFloat64
+	err := debugSelect(ctx,
+		query(tx).
+			Select("count(*)").
+			Column("count(*) FILTER (WHERE "+createdAt+" >= ?)", since).
+			Column("min("+age+")").
+			Column("max("+age+")").
+			Column("avg("+age+")::float8").
+			From(users)).
+		QueryRowContext(ctx).
+		Scan(&stats.Total, &stats.CreatedSince, &minAge, &maxAge, &averageAge)
+	if err != nil {
+		return nil, err
+	}
+	if minAge.Valid {
+		stats.Ages.Min, stats.Ages.Max = intPtr(int(minAge.Int64)), intPtr(int(maxAge.Int64))
+	}
+	if averageAge.Valid {
+		stats.Ages.Average = &averageAge.Float64
+	}
+
+	rows, err := debugSelect(ctx,
+		query(tx).
+			Select(fmt.Sprintf("(floor(%v / %v.0) * %v)::int AS bucket", age, AgeBucketWidth, AgeBucketWidth), "count(*)").
+			From(users).
+			GroupBy("bucket").
+			OrderBy("bucket ASC")).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		bucket := AgeBucket{}
+		if err := rows.Scan(&bucket.From, &bucket.Count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stats.Ages.Buckets = append(stats.Ages.Buckets, bucket)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Order names byte-wise, regardless of the database's collation, like Go does:
+	rows, err = debugSelect(ctx,
+		query(tx).
+			Select(familyName, "count(*) AS count").
+			From(users).
+			Where(familyName+" <> ''").
+			GroupBy(familyName).
+			OrderBy("count DESC", familyName+" COLLATE \"C\" ASC").
+			Limit(uint64(topFamilyNames))).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		name := NameCount{}
+		if err := rows.Scan(&name.Name, &name.Count); err != nil {
+			return nil, err
+		}
+		stats.TopFamilyNames = append(stats.TopFamilyNames, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// DeleteUser deletes the stored user corresponding to the provided ID, and records the corresponding event in the same transaction.
+func (db *PostgreSQLDB) DeleteUser(ctx context.Context, userID int) error {
+	pool := db.acquire()
+	defer pool.release()
+	tx, err := pool.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := deleteUser(ctx, tx, userID); err != nil {
+		rollback(tx)
+		return err
+	}
+	return tx.Commit()
+}
+
+func deleteUser(ctx context.Context, tx *sql.Tx, userID int) error {
+	// Lock the user until the transaction ends, so that concurrent deletions record a single event:
+	user, err := scanUser(debugSelect(ctx,
+		selectUsers(tx).Where(sq.Eq{id: userID}).Suffix("FOR UPDATE")).
+		QueryRowContext(ctx))
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := debugDelete(ctx,
+		query(tx).
+			Delete(users).
+			Where(sq.Eq{id: userID})).
+		ExecContext(ctx); err != nil {
+		return err
+	}
+	return insertEvent(ctx, tx, domain.UserDeleted, user)
+}
+
+// relayLockKey identifies the advisory lock electing which client leases events to deliver.
+const relayLockKey = 6538
+
+// deliveryLease is how long events are leased to the client delivering these. This client stops publishing events once
+// its lease expires, after which other clients may deliver the remaining ones, so that a crashed client does not block
+// the delivery of events for longer than that.
+const deliveryLease = 5 * time.Minute
+
+// DeliverEvents publishes, oldest first, up to limit pending events, and marks the ones published as delivered.
+// Events are leased to a single client at a time, so that replicas neither deliver the same events nor deliver them out
+// of order, and are published outside of any transaction, as publishing may take a while, e.g. retrying a webhook.
+func (db *PostgreSQLDB) DeliverEvents(ctx context.Context, limit int, publish func(*domain.Event) error) (int, error) {
+	pool := db.acquire()
+	defer pool.release()
+	tx, err := pool.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	deadline := time.Now().Add(deliveryLease)
+	events, err := leaseEvents(ctx, tx, limit)
+	if err != nil {
+		rollback(tx)
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+	published := make([]int64, 0, len(events))
+	var publishErr error
+	for _, event := range events {
+		if time.Now().After(deadline) {
+			break // Another client may now lease the remaining events.
+		}
+		if publishErr = publish(event); publishErr != nil {
+			break
+		}
+		published = append(published, event.ID)
+	}
+	if err := releaseEvents(ctx, pool.db, events, published); err != nil {
+		return 0, err
+	}
+	return len(published), publishErr
+}
+
+// leaseEvents leases up to limit pending events, oldest first, and returns these.
+// It returns no event if another client holds an active lease.
+func leaseEvents(ctx context.Context, tx *sql.Tx, limit int) ([]*domain.Event, error) {
+	// Hold this lock until the transaction ends, or skip this round if another client is already leasing events:
+	var locked bool
+	if err := tx.QueryRowContext(ctx, "SELECT pg_try_advisory_xact_lock($1)", relayLockKey).Scan(&locked); err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, nil
+	}
+	var leased bool
+	if err := debugSelect(ctx,
+		query(tx).
+			Select("count(*) > 0").
+			From(userEvents).
+			Where(sq.Eq{deliveredAt: nil}).
+			Where(leasedUntil+" > now()")).
+		QueryRowContext(ctx).
+		Scan(&leased); err != nil {
+		return nil, err
+	}
+	if leased {
+		return nil, nil // Another client is still delivering events.
+	}
+	rows, err := debugUpdate(ctx,
+		query(tx).
+			Update(userEvents).
+			Set(leasedUntil, sq.Expr("now() + make_interval(secs => ?)", deliveryLease.Seconds())).
+			Where(sq.Expr(id+" IN (SELECT "+id+" FROM "+userEvents+" WHERE "+deliveredAt+" IS NULL ORDER BY "+id+" ASC LIMIT ?)", limit)).
+			Suffix("RETURNING "+id+", "+eventType+", "+userID+", "+payload+", "+createdAt)).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID }) // RETURNING does not preserve the order.
+	return events, nil
+}
+
+// releaseEvents marks, in a short transaction, the published events as delivered, and releases the lease on all the
+// provided events, so that the ones not published are delivered again next time.
+func releaseEvents(ctx context.Context, runner *sql.DB, events []*domain.Event, published []int64) error {
+	leased := make([]int64, 0, len(events))
+	for _, event := range events {
+		leased = append(leased, event.ID)
+	}
+	tx, err := runner.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if len(published) > 0 {
+		if _, err := debugUpdate(ctx,
+			query(tx).
+				Update(userEvents).
+				Set(deliveredAt, sq.Expr("now()")).
+				Where(sq.Eq{id: published})).
+			ExecContext(ctx); err != nil {
+			rollback(tx)
+			return err
+		}
+	}
+	if _, err := debugUpdate(ctx,
+		query(tx).
+			Update(userEvents).
+			Set(leasedUntil, nil).
+			Where(sq.Eq{id: leased})).
+		ExecContext(ctx); err != nil {
+		rollback(tx)
+		return err
+	}
+	return tx.Commit()
+}
+
+func selectEvents(runner sq.BaseRunner) sq.SelectBuilder {
+	// The order of the below columns ought to match
+	// the order of the fields in scanEvents:
+	return query(runner).Select(id, eventType, userID, payload, createdAt).From(userEvents)
+}
+
+func scanEvents(rows *sql.Rows) ([]*domain.Event, error) {
+	events := []*domain.Event{}
+	for rows.Next() {
+		event := &domain.Event{}
+		var bytes []byte
+		if err := rows.Scan(&event.ID, &event.Type, &event.UserID, &bytes, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		event.Payload = bytes
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// ReplayEvents marks all delivered events with an ID greater than or equal to the provided one as pending again.
+func (db *PostgreSQLDB) ReplayEvents(ctx context.Context, fromID int64) (int64, error) {
+	pool := db.acquire()
+	defer pool.release()
+	result, err := debugUpdate(ctx,
+		query(pool.db).
+			Update(userEvents).
+			Set(deliveredAt, nil).
+			Where(sq.GtOrEq{id: fromID}).
+			Where(sq.NotEq{deliveredAt: nil})).
+		ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func query(runner sq.BaseRunner) sq.StatementBuilderType {
+	return sq.StatementBuilder.PlaceholderFormat(sq.Dollar).RunWith(traced(runner))
+}
+
+func debugInsert(ctx context.Context, query sq.InsertBuilder) sq.InsertBuilder {
+	debugQuery(ctx, "insert query", query)
 	return query
 }
 
-func debugSelect(query sq.SelectBuilder) sq.SelectBuilder {
-	sql, args, err := query.ToSql()
-	log.WithField("sql", sql).WithField("args", args).WithField("err", err).Debug("select query")
+func debugUpdate(ctx context.Context, query sq.UpdateBuilder) sq.UpdateBuilder {
+	debugQuery(ctx, "update query", query)
 	return query
 }
 
+func debugDelete(ctx context.Context, query sq.DeleteBuilder) sq.DeleteBuilder {
+	debugQuery(ctx, "delete query", query)
+	return query
+}
+
+func debugSelect(ctx context.Context, query sq.SelectBuilder) sq.SelectBuilder {
+	debugQuery(ctx, "select query", query)
+	return query
+}
+
+// debugQuery logs the provided query, if debug logs are enabled, and sampled as per --log-debug-sample, as every query
+// would otherwise be logged.
+func debugQuery(ctx context.Context, kind string, query sq.Sqlizer) {
+	if !logging.SampleDebug(kind) {
+		return
+	}
+	sql, args, err := query.ToSql()
+	logging.FromContext(ctx).WithField("sql", sql).WithField("args", args).WithField("err", err).Debug(kind)
+}
+
 func scanUsers(rows *sql.Rows) ([]*domain.User, error) {
 	users := []*domain.User{}
 	for rows.Next() {
@@ -183,6 +723,7 @@ func scanUsers(rows *sql.Rows) ([]*domain.User, error) {
 
 func scanOne(rows *sql.Rows) (*domain.User, error) {
 	user := &domain.User{}
+	var userEmail sql.NullString
 	// The order of the below fields ought to match
 	// the order of the columns in selectUsers:
 	if err := rows.Scan(
@@ -190,14 +731,40 @@ func scanOne(rows *sql.Rows) (*domain.User, error) {
 		&user.FirstName,
 		&user.FamilyName,
 		&user.Age,
+		&user.CreatedAt,
+		&userEmail,
 	); err != nil {
 		return nil, err
 	}
+	user.Email = userEmail.String
+	inUTC(user)
 	return user, nil
 }
 
+func scanMatch(rows *sql.Rows) (*Match, error) {
+	match := &Match{User: &domain.User{}}
+	var userEmail sql.NullString
+	// The order of the below fields ought to match
+	// the order of the columns in selectUsers, followed by the score:
+	if err := rows.Scan(
+		&match.User.ID,
+		&match.User.FirstName,
+		&match.User.FamilyName,
+		&match.User.Age,
+		&match.User.CreatedAt,
+		&userEmail,
+		&match.Score,
+	); err != nil {
+		return nil, err
+	}
+	match.User.Email = userEmail.String
+	inUTC(match.User)
+	return match, nil
+}
+
 func scanUser(row sq.RowScanner) (*domain.User, error) {
 	user := &domain.User{}
+	var userEmail sql.NullString
 	// The order of the below fields ought to match
 	// the order of the columns in selectUsers:
 	if err := row.Scan(
@@ -205,13 +772,29 @@ func scanUser(row sq.RowScanner) (*domain.User, error) {
 		&user.FirstName,
 		&user.FamilyName,
 		&user.Age,
+		&user.CreatedAt,
+		&userEmail,
 	); err != nil {
 		return nil, err
 	}
+	user.Email = userEmail.String
+	inUTC(user)
 	return user, nil
 }
 
+// inUTC converts the provided user's creation time, read in the session's time zone, to UTC.
+func inUTC(user *domain.User) {
+	if user.CreatedAt != nil {
+		createdAt := user.CreatedAt.UTC()
+		user.CreatedAt = &createdAt
+	}
+}
+
 // Close closes this connection to the database.
 func (db *PostgreSQLDB) Close() error {
-	return db.db.Close()
+	db.stopWatching()
+	db.feed.close()
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return db.pool.db.Close()
 }
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus" // Better Logging.
+)
+
+// reconnectTimeout bounds how long checking new credentials against the database may take.
+const reconnectTimeout = 10 * time.Second
+
+// pool is a connection pool, counting its users so that, once replaced, it is only closed when none uses it anymore.
+type pool struct {
+	db    *sql.DB
+	users sync.WaitGroup
+}
+
+func (p *pool) release() {
+	p.users.Done()
+}
+
+// acquire returns the current connection pool, which callers should release once done with it.
+func (db *PostgreSQLDB) acquire() *pool {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	db.pool.users.Add(1)
+	return db.pool
+}
+
+// swap replaces the current connection pool, and closes the previous one once queries in flight on it are done.
+func (db *PostgreSQLDB) swap(next *pool) {
+	db.mutex.Lock()
+	previous := db.pool
+	db.pool = next
+	db.mutex.Unlock()
+	go func() {
+		previous.users.Wait()
+		if err := previous.db.Close(); err != nil {
+			log.WithField("err", err).Warn("failed to close previous DB connection pool")
+		}
+	}()
+}
+
+// reconnect reads the database password again, and, if it works, replaces the current connections with ones using it.
+// Otherwise, e.g. if the password was rotated in the secret before being rotated in the database, it returns an error,
+// and the current connections are kept, so that reconnecting can be tried again later.
+func (db *PostgreSQLDB) reconnect() error {
+	logger := log.WithField("passwordFile", db.config.passwordFile)
+	uri, err := db.config.URI()
+	if err != nil {
+		logger.WithField("err", err).Error("failed to read new DB password")
+		return err
+	}
+	next, uri, err := openPool(uri)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), reconnectTimeout)
+	defer cancel()
+	if err := next.PingContext(ctx); err != nil {
+		next.Close()
+		logger.WithField("err", err).Error("failed to connect to DB with new password, keeping current connections")
+		return err
+	}
+	db.swap(&pool{db: next})
+	db.feed.reconnect(uri)
+	logger.Info("rotated DB password: connecting with the new one, and draining connections using the previous one")
+	return nil
+}
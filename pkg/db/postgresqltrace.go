@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel" // DB DSL.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/tracing"
+)
+
+// sqlRunner is implemented by both *sql.DB and *sql.Tx.
+type sqlRunner interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// tracedRunner runs squirrel queries, recording a span for each of them, if the provided context carries one.
+type tracedRunner struct {
+	runner sqlRunner
+}
+
+func traced(runner sq.BaseRunner) sq.BaseRunner {
+	if runner, ok := runner.(sqlRunner); ok {
+		return &tracedRunner{runner: runner}
+	}
+	return runner
+}
+
+// startQuerySpan starts a span for the provided query, recording it without any value, which may be sensitive.
+func startQuerySpan(ctx context.Context, query string) (context.Context, *tracing.Span) {
+	operation := query
+	if i := strings.IndexByte(query, ' '); i > 0 {
+		operation = query[:i]
+	}
+	ctx, span := tracing.Start(ctx, "postgresql "+operation, tracing.KindClient)
+	span.SetAttribute("db.system", "postgresql")
+	span.SetAttribute("db.operation", operation)
+	span.SetAttribute("db.statement", tracing.SanitizeSQL(query))
+	return ctx, span
+}
+
+func (r *tracedRunner) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	defer span.End()
+	result, err := r.runner.ExecContext(ctx, query, args...)
+	span.SetError(err)
+	return result, err
+}
+
+func (r *tracedRunner) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	defer span.End()
+	rows, err := r.runner.QueryContext(ctx, query, args...)
+	span.SetError(err)
+	return rows, err
+}
+
+func (r *tracedRunner) QueryRowContext(ctx context.Context, query string, args ...interface{}) sq.RowScanner {
+	ctx, span := startQuerySpan(ctx, query)
+	return &tracedRow{row: r.runner.QueryRowContext(ctx, query, args...), span: span}
+}
+
+// Exec, Query, and QueryRow are only required for tracedRunner to be a squirrel runner: queries are run with a context.
+
+func (r *tracedRunner) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return r.ExecContext(context.Background(), query, args...)
+}
+
+func (r *tracedRunner) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return r.QueryContext(context.Background(), query, args...)
+}
+
+func (r *tracedRunner) QueryRow(query string, args ...interface{}) sq.RowScanner {
+	return r.QueryRowContext(context.Background(), query, args...)
+}
+
+// tracedRow ends its span once scanned, as rows are only read then.
+type tracedRow struct {
+	row  *sql.Row
+	span *tracing.Span
+}
+
+func (r *tracedRow) Scan(dest ...interface{}) error {
+	defer r.span.End()
+	err := r.row.Scan(dest...)
+	if err != sql.ErrNoRows {
+		r.span.SetError(err)
+	}
+	return err
+}
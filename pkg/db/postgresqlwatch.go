@@ -0,0 +1,411 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sync"
+	"time"
+
+	sq "github.com/Masterminds/squirrel" // DB DSL.
+	"github.com/lib/pq"                  // DB PostgreSQL drivers.
+	log "github.com/sirupsen/logrus"     // Better Logging.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+)
+
+// IMPORTANT: make sure this matches migration 004_notify_users_changes under pkg/db/migrations/
+const usersChannel = "users_changes"
+
+const (
+	minReconnectInterval = 1 * time.Second
+	maxReconnectInterval = 1 * time.Minute
+	// fallbackPollInterval is how often the feed polls for events regardless of notifications, should any be lost.
+	fallbackPollInterval = 30 * time.Second
+	// heldBackPollInterval is how often the feed polls for events committed but held back by older transactions still
+	// in progress, as the end of these transactions is only notified if they recorded an event too.
+	heldBackPollInterval = 100 * time.Millisecond
+	// eventsPageSize is the maximum number of events read at once, e.g. when catching up on past changes.
+	eventsPageSize = 500
+	// watcherBufferSize is the number of changes buffered per watcher.
+	// Watchers falling further behind are disconnected, and are expected to resume.
+	watcherBufferSize = 64
+)
+
+// position locates an event in the feed of changes. No lock serialises writes, hence events' IDs, allocated before
+// their transactions commit, may be committed out of order, and a watcher resuming after an ID could miss the events
+// committed late with a lower one. Events are therefore streamed in the order of the transactions which recorded
+// these, and of their IDs, and only once all older transactions have ended, so that no event may ever precede the
+// ones already streamed.
+// IMPORTANT: make sure this matches migration 009_add_xact_id_to_user_events under pkg/db/migrations/
+type position struct {
+	xactID  int64
+	eventID int64
+}
+
+// after returns whether this position comes after the provided one in the feed.
+func (p position) after(other position) bool {
+	return p.xactID > other.xactID || (p.xactID == other.xactID && p.eventID > other.eventID)
+}
+
+// positionedChange is a change, along with the position in the feed of the event which recorded it.
+type positionedChange struct {
+	*domain.UserChange
+	position position
+}
+
+// positionedEvent is an event, along with its position in the feed.
+type positionedEvent struct {
+	*domain.Event
+	position position
+}
+
+// WatchUsers streams changes recorded after the event with the provided ID, using PostgreSQL's LISTEN/NOTIFY.
+// N.B.: changes are streamed in the order of the transactions which recorded these, see position, hence their IDs do
+// not necessarily increase, and a long-running transaction writing to the database delays the streaming of all changes
+// committed after it started, until it ends.
+func (db *PostgreSQLDB) WatchUsers(ctx context.Context, afterEventID int64) (<-chan *domain.UserChange, error) {
+	watcher, err := db.feed.watch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	changes := make(chan *domain.UserChange)
+	go func() {
+		defer close(changes)
+		defer db.feed.unwatch(watcher)
+
+		// Now that we are subscribed to the feed, catch up on past changes, so that none is missed:
+		last, err := db.catchUp(ctx, afterEventID, changes)
+		if err != nil {
+			if ctx.Err() == nil { // Otherwise, the watcher simply went away.
+				log.WithField("err", err).Error("failed to catch up on users changes")
+			}
+			return
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case change, ok := <-watcher:
+				if !ok {
+					return
+				}
+				if !change.position.after(last) {
+					continue // Already sent while catching up.
+				}
+				if !SendChange(ctx, changes, change.UserChange) {
+					return
+				}
+				last = change.position
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// catchUp sends all changes recorded after the event with the provided ID, page by page, and returns the position of
+// the last one sent, or of the watermark if watching from the latest event.
+func (db *PostgreSQLDB) catchUp(ctx context.Context, afterEventID int64, changes chan<- *domain.UserChange) (position, error) {
+	if afterEventID == LatestEvent {
+		return db.currentPosition(ctx)
+	}
+	last, err := db.positionOf(ctx, afterEventID)
+	if err != nil {
+		return last, err
+	}
+	for {
+		events, err := db.eventsAfter(ctx, last, eventsPageSize)
+		if err != nil {
+			return last, err
+		}
+		for _, event := range events {
+			change, err := event.UserChange()
+			if err != nil {
+				return last, err
+			}
+			if !SendChange(ctx, changes, change) {
+				return last, ctx.Err()
+			}
+			last = event.position
+		}
+		if len(events) < eventsPageSize {
+			return last, nil
+		}
+	}
+}
+
+// positionOf returns the position of the event with the provided ID, or, should there be none, the position of the
+// latest event with a lower ID, or the start of the feed.
+func (db *PostgreSQLDB) positionOf(ctx context.Context, eventID int64) (position, error) {
+	pool := db.acquire()
+	defer pool.release()
+	var p position
+	err := debugSelect(ctx,
+		query(pool.db).
+			Select(xactID, id).
+			From(userEvents).
+			Where(sq.LtOrEq{id: eventID}).
+			OrderBy(id+" DESC").
+			Limit(1)).
+		QueryRowContext(ctx).
+		Scan(&p.xactID, &p.eventID)
+	if err == sql.ErrNoRows {
+		return position{}, nil
+	}
+	return p, err
+}
+
+// watermark is the condition for events to be streamed: all transactions older than the ones which recorded these have
+// ended, i.e. no event committed later may precede these in the feed.
+const watermark = xactID + " < txid_snapshot_xmin(txid_current_snapshot())"
+
+// eventsAfter returns, in the order of the feed, up to limit events after the provided position which are below the watermark.
+func (db *PostgreSQLDB) eventsAfter(ctx context.Context, after position, limit int) ([]*positionedEvent, error) {
+	pool := db.acquire()
+	defer pool.release()
+	rows, err := debugSelect(ctx,
+		query(pool.db).
+			Select(xactID, id, eventType, userID, payload, createdAt).
+			From(userEvents).
+			Where("("+xactID+", "+id+") > (?, ?)", after.xactID, after.eventID).
+			Where(watermark).
+			OrderBy(xactID+" ASC", id+" ASC").
+			Limit(uint64(limit))).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := []*positionedEvent{}
+	for rows.Next() {
+		event := &positionedEvent{Event: &domain.Event{}}
+		var bytes []byte
+		if err := rows.Scan(&event.position.xactID, &event.ID, &event.Type, &event.UserID, &bytes, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		event.position.eventID = event.ID
+		event.Payload = bytes
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// eventsHeldBack returns whether events were committed but are still above the watermark.
+func (db *PostgreSQLDB) eventsHeldBack(ctx context.Context) (bool, error) {
+	pool := db.acquire()
+	defer pool.release()
+	var heldBack bool
+	err := pool.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM "+userEvents+" WHERE NOT ("+watermark+"))").Scan(&heldBack)
+	return heldBack, err
+}
+
+// currentPosition returns the position of the watermark, i.e. after all events below it.
+func (db *PostgreSQLDB) currentPosition(ctx context.Context) (position, error) {
+	pool := db.acquire()
+	defer pool.release()
+	var xmin int64
+	if err := pool.db.QueryRowContext(ctx, "SELECT txid_snapshot_xmin(txid_current_snapshot())").Scan(&xmin); err != nil {
+		return position{}, err
+	}
+	return position{xactID: xmin - 1, eventID: math.MaxInt64}, nil
+}
+
+// changesFeed listens for notifications of changes to users on a single, dedicated, connection,
+// reads the corresponding events once, and fans them out to all watchers.
+type changesFeed struct {
+	db       *PostgreSQLDB
+	uri      string
+	started  bool // Listening starts lazily, upon the first watch.
+	watchers map[chan *positionedChange]struct{}
+	switches chan *pq.Listener // Listeners to switch to, e.g. after the DB password was rotated.
+	stop     chan struct{}
+	closed   bool
+	mutex    sync.Mutex // For thread-safe access to the URI, the state and watchers.
+}
+
+func newChangesFeed(db *PostgreSQLDB, uri string) *changesFeed {
+	return &changesFeed{
+		db:       db,
+		uri:      uri,
+		watchers: make(map[chan *positionedChange]struct{}),
+		switches: make(chan *pq.Listener),
+		stop:     make(chan struct{}),
+	}
+}
+
+// watch subscribes to changes, starting to listen for them if this is the first subscription.
+func (feed *changesFeed) watch(ctx context.Context) (chan *positionedChange, error) {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+	if feed.closed {
+		return nil, errClosed
+	}
+	if !feed.started {
+		if err := feed.start(ctx); err != nil {
+			return nil, err
+		}
+	}
+	watcher := make(chan *positionedChange, watcherBufferSize)
+	feed.watchers[watcher] = struct{}{}
+	return watcher, nil
+}
+
+// start listens for notifications. It should be called while holding the mutex.
+func (feed *changesFeed) start(ctx context.Context) error {
+	listener, err := listen(feed.uri)
+	if err != nil {
+		return err
+	}
+	// Now that we listen for notifications, start from the watermark, so that no event is missed:
+	last, err := feed.db.currentPosition(ctx)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	feed.started = true
+	go feed.run(listener, last)
+	return nil
+}
+
+func listen(uri string) (*pq.Listener, error) {
+	listener := pq.NewListener(uri, minReconnectInterval, maxReconnectInterval, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.WithField("event", event).WithField("err", err).Warn("users changes listener")
+		}
+	})
+	if err := listener.Listen(usersChannel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// reconnect makes the feed listen for notifications on a new connection to the provided URI, e.g. after the DB password was rotated.
+func (feed *changesFeed) reconnect(uri string) {
+	feed.mutex.Lock()
+	feed.uri = uri
+	running := feed.started && !feed.closed
+	feed.mutex.Unlock()
+	if !running {
+		return // The new URI will be used upon the first watch.
+	}
+	listener, err := listen(uri)
+	if err != nil {
+		log.WithField("err", err).Error("failed to listen for users changes on new connection, keeping the current one")
+		return
+	}
+	select {
+	case feed.switches <- listener:
+	case <-feed.stop:
+		listener.Close()
+	}
+}
+
+func (feed *changesFeed) run(listener *pq.Listener, last position) {
+	ticker := time.NewTicker(fallbackPollInterval)
+	defer ticker.Stop()
+	defer func() {
+		if err := listener.Close(); err != nil {
+			log.WithField("err", err).Warn("failed to close users changes listener")
+		}
+	}()
+	var heldBack bool
+	for {
+		var retry <-chan time.Time // Blocks forever unless events are held back.
+		if heldBack {
+			retry = time.After(heldBackPollInterval)
+		}
+		select {
+		case <-feed.stop:
+			return
+		case next := <-feed.switches:
+			if err := listener.Close(); err != nil {
+				log.WithField("err", err).Warn("failed to close previous users changes listener")
+			}
+			listener = next
+			// Notifications may have been missed while switching:
+			last, heldBack = feed.poll(last)
+		case <-listener.Notify:
+			// Notifications only carry the event's ID, and are nil upon reconnection, in which case some may have been lost.
+			// Either way, poll for all events since the last one we fanned out:
+			last, heldBack = feed.poll(last)
+		case <-retry:
+			last, heldBack = feed.poll(last)
+		case <-ticker.C:
+			last, heldBack = feed.poll(last)
+		}
+	}
+}
+
+// poll fans out all changes recorded after the provided position, page by page, and returns the position of the last
+// one, and whether some events are held back by older transactions still in progress, in which case it should poll
+// again soon.
+func (feed *changesFeed) poll(last position) (position, bool) {
+	ctx := context.Background()
+	for {
+		events, err := feed.db.eventsAfter(ctx, last, eventsPageSize)
+		if err != nil {
+			log.WithField("err", err).Error("failed to read users changes")
+			return last, false
+		}
+		for _, event := range events {
+			change, err := event.UserChange()
+			if err != nil {
+				log.WithField("eventID", event.ID).WithField("err", err).Warn("invalid users change")
+			} else {
+				feed.notify(&positionedChange{UserChange: change, position: event.position})
+			}
+			last = event.position
+		}
+		if len(events) < eventsPageSize {
+			break
+		}
+	}
+	heldBack, err := feed.db.eventsHeldBack(ctx)
+	if err != nil {
+		log.WithField("err", err).Error("failed to check for held back users changes")
+	}
+	return last, heldBack
+}
+
+// notify sends the provided change to all watchers.
+func (feed *changesFeed) notify(change *positionedChange) {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+	for watcher := range feed.watchers {
+		select {
+		case watcher <- change:
+		default:
+			// This watcher is too slow to keep up, disconnect it:
+			delete(feed.watchers, watcher)
+			close(watcher)
+		}
+	}
+}
+
+func (feed *changesFeed) unwatch(watcher chan *positionedChange) {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+	if _, ok := feed.watchers[watcher]; ok {
+		delete(feed.watchers, watcher)
+		close(watcher)
+	}
+}
+
+// close stops listening for notifications, and disconnects all watchers.
+func (feed *changesFeed) close() {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+	if feed.closed {
+		return
+	}
+	feed.closed = true
+	close(feed.stop) // Also stops listening.
+	for watcher := range feed.watchers {
+		delete(feed.watchers, watcher)
+		close(watcher)
+	}
+}
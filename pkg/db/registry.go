@@ -0,0 +1,66 @@
+package db
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Opener creates a database client from the provided configuration, whose URI was already parsed.
+// Backend-specific options are passed in the URI's query string.
+type Opener func(uri *url.URL, config *Config) (DB, error)
+
+var (
+	openers      = make(map[string]Opener)
+	openersMutex sync.RWMutex // For thread-safe access to the openers map.
+)
+
+// Register makes a database backend available under the provided URI scheme.
+// Only SQL backends are expected to run DB migrations when opened.
+// Like database/sql.Register, it panics if the scheme is already registered.
+func Register(scheme string, opener Opener) {
+	openersMutex.Lock()
+	defer openersMutex.Unlock()
+	if _, ok := openers[scheme]; ok {
+		panic(fmt.Sprintf("db: Register called twice for scheme %q", scheme))
+	}
+	openers[scheme] = opener
+}
+
+// Schemes returns the URI schemes of all registered database backends, sorted.
+func Schemes() []string {
+	openersMutex.RLock()
+	defer openersMutex.RUnlock()
+	schemes := make([]string, 0, len(openers))
+	for scheme := range openers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Open creates the database client registered for the scheme of the configured URI.
+func Open(config *Config) (DB, error) {
+	uri, err := url.Parse(config.RawURI)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse database URI")
+	}
+	openersMutex.RLock()
+	opener, ok := openers[uri.Scheme]
+	openersMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("invalid database URI: unsupported scheme %q, expected one of %q", uri.Scheme, Schemes())
+	}
+	return opener(uri, config)
+}
+
+// noOptions returns an error if the provided URI has any option, for backends which do not support any.
+func noOptions(uri *url.URL) error {
+	if len(uri.RawQuery) > 0 {
+		return fmt.Errorf("invalid database URI: %v:// does not support any option, but got %q", uri.Scheme, uri.RawQuery)
+	}
+	return nil
+}
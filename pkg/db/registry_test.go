@@ -0,0 +1,50 @@
+package db_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db"
+)
+
+func TestSchemesShouldListAllBackends(t *testing.T) {
+	assert.Equal(t, []string{"file", "memory", "postgres", "postgresql"}, db.Schemes())
+}
+
+func TestOpenMemoryURIShouldReturnInMemoryDB(t *testing.T) {
+	database, err := db.Open(&db.Config{RawURI: "memory://"})
+	assert.NoError(t, err)
+	assert.IsType(t, &db.InMemoryDB{}, database)
+	assert.NoError(t, database.Close())
+}
+
+func TestOpenMemoryURIWithOptionsShouldReturnError(t *testing.T) {
+	database, err := db.Open(&db.Config{RawURI: "memory://?size=10"})
+	assert.EqualError(t, err, "invalid database URI: memory:// does not support any option, but got \"size=10\"")
+	assert.Nil(t, database)
+}
+
+func TestOpenFileURIShouldReturnFileDB(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir) // Clean-up.
+
+	database, err := db.Open(&db.Config{RawURI: "file://" + filepath.Join(dir, "users.log") + "?compact-interval=1m"})
+	assert.NoError(t, err)
+	assert.IsType(t, &db.FileDB{}, database)
+	assert.NoError(t, database.Close())
+}
+
+func TestOpenUnknownSchemeShouldReturnError(t *testing.T) {
+	database, err := db.Open(&db.Config{RawURI: "mysql://localhost:3306/users"})
+	assert.EqualError(t, err, "invalid database URI: unsupported scheme \"mysql\", expected one of [\"file\" \"memory\" \"postgres\" \"postgresql\"]")
+	assert.Nil(t, database)
+}
+
+func TestOpenPostgresURIWithInvalidPoolOptionShouldReturnError(t *testing.T) {
+	database, err := db.Open(&db.Config{RawURI: "postgres://postgres@localhost:5432/users?sslmode=disable&max-open-conns=many"})
+	assert.EqualError(t, err, "invalid max-open-conns: strconv.Atoi: parsing \"many\": invalid syntax")
+	assert.Nil(t, database)
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+)
+
+// Searcher is implemented by databases which can search users by name.
+type Searcher interface {
+	// SearchUsers returns up to limit users whose full name matches the provided text, either fuzzily or word for word,
+	// by decreasing relevance then increasing ID, starting after the provided cursor if any, e.g. the last match of the previous page.
+	SearchUsers(ctx context.Context, text string, after *SearchCursor, limit int) ([]*Match, error)
+}
+
+// Match is an user matching a search, along with its relevance, between 0 and 1.
+type Match struct {
+	User  *domain.User
+	Score float64
+}
+
+// SearchCursor is the position of a match in search results, after which the next page of results starts.
+type SearchCursor struct {
+	Score float64 `json:"score"`
+	ID    int     `json:"id"`
+}
+
+// Cursor returns the position of this match in search results.
+func (m Match) Cursor() *SearchCursor {
+	return &SearchCursor{Score: m.Score, ID: m.User.ID}
+}
+
+// IMPORTANT: the below scoring mirrors the one of PostgreSQLDB, see searchUsers, so that all databases rank users alike:
+// the average of pg_trgm's trigram similarity between the full name and the text, and of 1 if the full name matches
+// the text word for word, as per full-text search with the 'simple' configuration, or 0 otherwise.
+
+// similarityThreshold is the trigram similarity from which names fuzzily match, as per pg_trgm's default for its % operator.
+const similarityThreshold = 0.3
+
+// score returns the relevance of the provided user to the provided text, and whether it matches at all.
+func score(user *domain.User, text string) (float64, bool) {
+	name := fullName(user)
+	similarity := similarity(name, text)
+	var fullText float32
+	if matchesFullText(name, text) {
+		fullText = 1
+	}
+	if similarity < similarityThreshold && fullText == 0 {
+		return 0, false
+	}
+	// Computed with PostgreSQL's single precision, for scores to be identical, and cursors to work alike:
+	return float64((similarity + fullText) / 2), true
+}
+
+func fullName(user *domain.User) string {
+	return user.FirstName + " " + user.FamilyName
+}
+
+// similarity returns the proportion of trigrams shared by the provided strings, as per pg_trgm's similarity function.
+func similarity(x, y string) float32 {
+	xTrigrams, yTrigrams := trigrams(x), trigrams(y)
+	if len(xTrigrams) == 0 || len(yTrigrams) == 0 {
+		return 0
+	}
+	shared := 0
+	for trigram := range xTrigrams {
+		if _, ok := yTrigrams[trigram]; ok {
+			shared++
+		}
+	}
+	return float32(shared) / float32(len(xTrigrams)+len(yTrigrams)-shared)
+}
+
+// trigrams returns the set of trigrams of the provided string's words, lower-cased, and padded with two spaces
+// before and one after, as per pg_trgm, e.g. "Luke" yields "  l", " lu", "luk", "uke" and "ke ".
+func trigrams(s string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, word := range words(s) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = struct{}{}
+		}
+	}
+	return set
+}
+
+// words returns the lower-cased alphanumeric words of the provided string.
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// matchesFullText returns whether all words of the provided text are words of the provided name.
+func matchesFullText(name, text string) bool {
+	textWords := words(text)
+	if len(textWords) == 0 {
+		return false
+	}
+	nameWords := make(map[string]bool)
+	for _, word := range words(name) {
+		nameWords[word] = true
+	}
+	for _, word := range textWords {
+		if !nameWords[word] {
+			return false
+		}
+	}
+	return true
+}
+
+// searchUsers ranks the provided users against the provided text, and returns the requested page of matches.
+func searchUsers(users []*domain.User, text string, after *SearchCursor, limit int) []*Match {
+	matches := []*Match{}
+	for _, user := range users {
+		if score, ok := score(user, text); ok {
+			match := &Match{User: user, Score: score}
+			if after == nil || after.Before(match) {
+				matches = append(matches, match)
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Cursor().Before(matches[j]) })
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// Before returns whether the provided match comes after this cursor in search results.
+func (c SearchCursor) Before(m *Match) bool {
+	return m.Score < c.Score || (m.Score == c.Score && m.User.ID > c.ID)
+}
@@ -0,0 +1,49 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+)
+
+func TestSearchUsersShouldScoreLikePostgreSQL(t *testing.T) {
+	database := db.NewInMemoryDB()
+	ctx := context.Background()
+	for _, user := range []domain.User{
+		{FirstName: "Luke", FamilyName: "Skywalker"},
+		{FirstName: "Obi-Wan", FamilyName: "Kenobi"},
+	} {
+		_, err := database.CreateUser(ctx, &user)
+		assert.NoError(t, err)
+	}
+
+	for _, test := range []struct {
+		text  string
+		score float64
+	}{
+		// "luke skywalker" has 15 trigrams, "skywalkr" has 9, and these share 7: similarity("luke skywalker", "skywalkr") = 7/17.
+		{"skywalkr", float64(float32(float32(7)/float32(17)) / 2)},
+		// "skywalker" has 10 trigrams, all shared: similarity("luke skywalker", "skywalker") = 10/15, and it matches word for word.
+		{"Skywalker", float64((float32(10)/float32(15) + 1) / 2)},
+		// Identical names are as relevant as can be:
+		{"luke skywalker", 1},
+	} {
+		matches, err := database.SearchUsers(ctx, test.text, nil, 10)
+		assert.NoError(t, err)
+		if assert.Equal(t, 1, len(matches), test.text) {
+			assert.Equal(t, 1, matches[0].User.ID, test.text)
+			assert.Equal(t, test.score, matches[0].Score, test.text)
+		}
+	}
+
+	// Words are split on non-alphanumeric characters, e.g. hyphens:
+	matches, err := database.SearchUsers(ctx, "wan", nil, 10)
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(matches)) {
+		assert.Equal(t, 2, matches[0].User.ID)
+	}
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+)
+
+// Aggregator is implemented by databases which can compute statistics about users.
+type Aggregator interface {
+	// UserStats aggregates statistics about all stored users, counts the ones created since the provided time,
+	// and lists up to topFamilyNames most common family names.
+	UserStats(ctx context.Context, since time.Time, topFamilyNames int) (*UserStats, error)
+}
+
+// UserStats are statistics about users, e.g. for dashboards.
+type UserStats struct {
+	Total          int         `json:"total"`
+	CreatedSince   int         `json:"createdSince"` // Users created before creation times were recorded are not counted.
+	Ages           AgeStats    `json:"ages"`
+	TopFamilyNames []NameCount `json:"topFamilyNames"` // By decreasing count, then by name, excluding empty names.
+}
+
+// AgeStats are statistics about users' ages. Min, max and average are nil if there are no users.
+type AgeStats struct {
+	Min     *int        `json:"min"`
+	Max     *int        `json:"max"`
+	Average *float64    `json:"average"`
+	Buckets []AgeBucket `json:"buckets"` // Non-empty buckets only, by increasing age.
+}
+
+// AgeBucketWidth is the number of years covered by each age bucket, e.g. 20 to 29.
+const AgeBucketWidth = 10
+
+// AgeBucket counts users whose age is between From and From+AgeBucketWidth-1.
+type AgeBucket struct {
+	From  int `json:"from"`
+	Count int `json:"count"`
+}
+
+// NameCount counts users sharing a name.
+type NameCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// IMPORTANT: the below aggregation mirrors the SQL of PostgreSQLDB.UserStats, so that all databases compute the same statistics.
+
+// userStats computes statistics about the provided users.
+func userStats(users []*domain.User, since time.Time, topFamilyNames int) *UserStats {
+	stats := &UserStats{Total: len(users), Ages: AgeStats{Buckets: []AgeBucket{}}, TopFamilyNames: []NameCount{}}
+	buckets := make(map[int]int)
+	familyNames := make(map[string]int)
+	sum := 0
+	for _, user := range users {
+		if user.CreatedAt != nil && !user.CreatedAt.Before(since) {
+			stats.CreatedSince++
+		}
+		if stats.Ages.Min == nil || user.Age < *stats.Ages.Min {
+			stats.Ages.Min = intPtr(user.Age)
+		}
+		if stats.Ages.Max == nil || user.Age > *stats.Ages.Max {
+			stats.Ages.Max = intPtr(user.Age)
+		}
+		sum += user.Age
+		buckets[ageBucket(user.Age)]++
+		if len(user.FamilyName) > 0 {
+			familyNames[user.FamilyName]++
+		}
+	}
+	if len(users) > 0 {
+		average := float64(sum) / float64(len(users))
+		stats.Ages.Average = &average
+	}
+	for from, count := range buckets {
+		stats.Ages.Buckets = append(stats.Ages.Buckets, AgeBucket{From: from, Count: count})
+	}
+	sort.Slice(stats.Ages.Buckets, func(i, j int) bool { return stats.Ages.Buckets[i].From < stats.Ages.Buckets[j].From })
+	for name, count := range familyNames {
+		stats.TopFamilyNames = append(stats.TopFamilyNames, NameCount{Name: name, Count: count})
+	}
+	sort.Slice(stats.TopFamilyNames, func(i, j int) bool {
+		x, y := stats.TopFamilyNames[i], stats.TopFamilyNames[j]
+		return x.Count > y.Count || (x.Count == y.Count && x.Name < y.Name)
+	})
+	if len(stats.TopFamilyNames) > topFamilyNames {
+		stats.TopFamilyNames = stats.TopFamilyNames[:topFamilyNames]
+	}
+	return stats
+}
+
+// ageBucket returns the lowest age of the provided age's bucket, rounding down, e.g. 20 for 27, or -10 for -3.
+func ageBucket(age int) int {
+	if age < 0 {
+		return -((-age + AgeBucketWidth - 1) / AgeBucketWidth) * AgeBucketWidth
+	}
+	return age / AgeBucketWidth * AgeBucketWidth
+}
+
+func intPtr(i int) *int {
+	return &i
+}
@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Types of events emitted when users change.
+const (
+	UserCreated = "user.created"
+	UserDeleted = "user.deleted"
+)
+
+// Event records a change to an user, so that it can be published to downstream systems.
+type Event struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	UserID    int             `json:"userId"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// NewUserEvent creates a new event of the provided type, carrying the provided user as its payload.
+func NewUserEvent(eventType string, user *User) (*Event, error) {
+	payload, err := user.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return &Event{
+		Type:      eventType,
+		UserID:    user.ID,
+		Payload:   payload,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// Marshal serialises this event as JSON.
+func (e Event) Marshal() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// UserChange is a change to an user, as streamed to watchers.
+type UserChange struct {
+	ID   int64 // ID of the event which recorded this change, used by watchers to resume from it.
+	Type string
+	User *User
+}
+
+// UserChange returns the change to an user recorded by this event.
+func (e Event) UserChange() (*UserChange, error) {
+	user, err := UnmarshalUser(e.Payload)
+	if err != nil {
+		return nil, err
+	}
+	return &UserChange{
+		ID:   e.ID,
+		Type: e.Type,
+		User: user,
+	}, nil
+}
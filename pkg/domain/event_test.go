@@ -0,0 +1,19 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+)
+
+func TestNewUserEventShouldCarryUserAsPayload(t *testing.T) {
+	user := domain.User{ID: 1, FirstName: "Luke", FamilyName: "Skywalker", Age: 20}
+	event, err := domain.NewUserEvent(domain.UserCreated, &user)
+	assert.NoError(t, err)
+	assert.Equal(t, "user.created", event.Type)
+	assert.Equal(t, 1, event.UserID)
+	assert.Equal(t, "{\"id\":1,\"firstName\":\"Luke\",\"familyName\":\"Skywalker\",\"age\":20}", string(event.Payload))
+	assert.False(t, event.CreatedAt.IsZero())
+}
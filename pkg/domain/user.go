@@ -3,6 +3,9 @@ package domain
 import (
 	"encoding/json"
 	"fmt"
+	"net/mail"
+	"strings"
+	"time"
 )
 
 // User encapsulates data about an user, expose related behaviour, and specifies how to serialise/deserialise the corresponding object.
@@ -11,6 +14,9 @@ type User struct {
 	FirstName  string `json:"firstName"`
 	FamilyName string `json:"familyName"`
 	Age        int    `json:"age"`
+	Email      string `json:"email,omitempty"` // Unique regardless of case, if set.
+	// CreatedAt is set by databases on creation, and is nil for users created before these recorded it.
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
 }
 
 // FullName returns this user's full name.
@@ -18,6 +24,33 @@ func (u User) FullName() string {
 	return fmt.Sprintf("%v %v", u.FirstName, u.FamilyName)
 }
 
+// Validate checks this user's fields are valid.
+func (u User) Validate() error {
+	if u.Age < 0 {
+		return fmt.Errorf("invalid age: expected a non-negative number but got %v", u.Age)
+	}
+	if len(u.Email) > 0 {
+		if err := ValidateEmail(u.Email); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateEmail checks the provided email is a bare address, e.g. luke@tatooine.org, rather than "Luke <luke@tatooine.org>".
+func ValidateEmail(email string) error {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		return fmt.Errorf("invalid email: expected an address like luke@tatooine.org but got %q", email)
+	}
+	return nil
+}
+
+// NormalizeEmail returns the provided email, as compared to others to enforce its uniqueness.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(email)
+}
+
 // Marshal serialises this user as JSON.
 func (u User) Marshal() ([]byte, error) {
 	return json.Marshal(u)
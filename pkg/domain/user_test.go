@@ -1,6 +1,7 @@
 package domain_test
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert" // More readable test assertions.
@@ -46,3 +47,18 @@ func TestUnmarshalInvalidJSONUserShouldReturnError(t *testing.T) {
 	assert.EqualError(t, err, "invalid JSON: doesn't yield a valid user: {\"foo\":\"bar\"}")
 	assert.Nil(t, user)
 }
+
+func TestValidateShouldCheckEmail(t *testing.T) {
+	assert.NoError(t, user.Validate()) // Email is optional.
+	for _, email := range []string{"luke@tatooine.org", "Luke.Skywalker+jedi@rebels.tatooine.org"} {
+		assert.NoError(t, domain.User{Email: email}.Validate(), email)
+	}
+	for _, email := range []string{"luke", "luke@", "@tatooine.org", "luke@tatooine", "Luke <luke@tatooine.org>", " luke@tatooine.org", "luke@tatooine.org, leia@alderaan.org"} {
+		assert.EqualError(t, domain.User{Email: email}.Validate(), fmt.Sprintf("invalid email: expected an address like luke@tatooine.org but got %q", email), email)
+	}
+}
+
+func TestValidateShouldCheckAge(t *testing.T) {
+	assert.NoError(t, domain.User{Age: 0}.Validate())
+	assert.EqualError(t, domain.User{Age: -1, Email: "luke@tatooine.org"}.Validate(), "invalid age: expected a non-negative number but got -1")
+}
@@ -0,0 +1,62 @@
+// Package filewatch detects changes to files, e.g. Kubernetes secrets mounted as volumes, by polling them.
+// Polling, rather than inotify, copes with the symbolic links Kubernetes atomically swaps when updating such volumes.
+package filewatch
+
+import (
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"time"
+
+	log "github.com/sirupsen/logrus" // Better Logging.
+)
+
+// Poll calls onChange every time the content of any of the provided files changes, checking every interval,
+// until the provided context is done. Files which cannot be read are logged, and checked again at the next interval.
+// If onChange returns an error, the change is considered unhandled, and onChange is called again at the next interval.
+func Poll(ctx context.Context, interval time.Duration, paths []string, onChange func() error) {
+	fingerprints := Fingerprints(paths)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := Fingerprints(paths)
+			if current == nil || equal(current, fingerprints) {
+				continue
+			}
+			if err := onChange(); err != nil {
+				continue
+			}
+			fingerprints = current
+		}
+	}
+}
+
+// Fingerprints returns the SHA-256 of the content of each of the provided files, or nil if any cannot be read.
+func Fingerprints(paths []string) [][sha256.Size]byte {
+	fingerprints := make([][sha256.Size]byte, len(paths))
+	for i, path := range paths {
+		bytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.WithField("path", path).WithField("err", err).Warn("failed to read watched file")
+			return nil
+		}
+		fingerprints[i] = sha256.Sum256(bytes)
+	}
+	return fingerprints
+}
+
+func equal(a, b [][sha256.Size]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package filewatch_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/filewatch"
+)
+
+func TestPollShouldCallOnChangeWhenContentChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filewatch")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir) // Clean-up.
+	path := filepath.Join(dir, "secret")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("v1"), 0600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan struct{}, 10)
+	go filewatch.Poll(ctx, 5*time.Millisecond, []string{path}, func() error {
+		changes <- struct{}{}
+		return nil
+	})
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 0, len(changes)) // Unchanged.
+
+	// Kubernetes-style update: write a new file, and atomically rename it over the watched one.
+	assert.NoError(t, ioutil.WriteFile(path+".tmp", []byte("v2"), 0600))
+	assert.NoError(t, os.Rename(path+".tmp", path))
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("change not detected")
+	}
+}
+
+func TestPollShouldCallOnChangeAgainWhenItFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filewatch")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir) // Clean-up.
+	path := filepath.Join(dir, "secret")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("v1"), 0600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := make(chan struct{}, 100)
+	go filewatch.Poll(ctx, 5*time.Millisecond, []string{path}, func() error {
+		calls <- struct{}{}
+		if len(calls) < 3 {
+			return errors.New("not ready yet")
+		}
+		return nil
+	})
+
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, ioutil.WriteFile(path, []byte("v2"), 0600))
+	deadline := time.After(5 * time.Second)
+	for len(calls) < 3 {
+		select {
+		case <-deadline:
+			t.Fatal("failed change not retried")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 3, len(calls)) // No more calls once the change was handled.
+}
+
+func TestFingerprintsShouldReturnNilWhenFileIsMissing(t *testing.T) {
+	assert.Nil(t, filewatch.Fingerprints([]string{"/does/not/exist"}))
+}
@@ -0,0 +1,102 @@
+package loadgen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag" // POSIX/GNU-style CLI arguments.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+)
+
+// Config encapsulates the input required to configure the load generator.
+type Config struct {
+	Target         string
+	Rate           float64
+	Workers        int
+	Duration       time.Duration
+	Mix            string
+	Timeout        time.Duration
+	ReportInterval time.Duration
+	Output         string
+	apiKeyFile     string
+}
+
+const (
+	target         = "target"
+	rate           = "rate"
+	workers        = "workers"
+	duration       = "duration"
+	mix            = "mix"
+	timeout        = "timeout"
+	reportInterval = "report-interval"
+	output         = "output"
+	apiKeyFile     = "api-key-file"
+)
+
+// Supported outputs.
+const (
+	TextOutput = "text"
+	JSONOutput = "json"
+)
+
+// RegisterFlags maps the provided CLI arguments to fields in this configuration object.
+func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
+	f.StringVar(&cfg.Target, target, "http://localhost:8080", "Base URL of the service, or of the traffic router in front of it, to send requests to")
+	f.Float64Var(&cfg.Rate, rate, 10, "Requests per second to send. Requests no worker is free to send on time are not sent, but counted as missed")
+	f.IntVar(&cfg.Workers, workers, 10, "Maximum number of requests in flight")
+	f.DurationVar(&cfg.Duration, duration, 0, "How long to send requests for. Requests are sent until interrupted if 0")
+	f.StringVar(&cfg.Mix, mix, "create=1,list=1,get=8", fmt.Sprintf("Relative weights of the requests sent, as <operation>=<weight>, comma-separated. Operations are %q", Operations))
+	f.DurationVar(&cfg.Timeout, timeout, 5*time.Second, "The maximum duration of each request")
+	f.DurationVar(&cfg.ReportInterval, reportInterval, 5*time.Second, "How often to report on the requests sent since the previous report. Disabled if 0")
+	f.StringVar(&cfg.Output, output, TextOutput, fmt.Sprintf("Format of reports: %q, or %q for one JSON object per line", TextOutput, JSONOutput))
+	f.StringVar(&cfg.apiKeyFile, apiKeyFile, "", "File containing the API key to send requests with, when the service requires authentication")
+}
+
+// Validate checks this configuration, and returns the parsed mix of operations.
+func (cfg Config) Validate() (Mix, error) {
+	if u, err := url.Parse(cfg.Target); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid target: --%v must be an HTTP(S) URL but got %q", target, cfg.Target)
+	}
+	if cfg.Rate <= 0 {
+		return nil, fmt.Errorf("invalid rate: --%v must be positive but got %v", rate, cfg.Rate)
+	}
+	if cfg.Workers <= 0 {
+		return nil, fmt.Errorf("invalid workers: --%v must be positive but got %v", workers, cfg.Workers)
+	}
+	if cfg.Duration < 0 {
+		return nil, fmt.Errorf("invalid duration: --%v must not be negative but got %v", duration, cfg.Duration)
+	}
+	if cfg.Timeout <= 0 {
+		return nil, fmt.Errorf("invalid timeout: --%v must be positive but got %v", timeout, cfg.Timeout)
+	}
+	if cfg.ReportInterval < 0 {
+		return nil, fmt.Errorf("invalid report interval: --%v must not be negative but got %v", reportInterval, cfg.ReportInterval)
+	}
+	if cfg.Output != TextOutput && cfg.Output != JSONOutput {
+		return nil, fmt.Errorf("invalid output: --%v must be one of %q or %q but got %q", output, TextOutput, JSONOutput, cfg.Output)
+	}
+	operations, err := ParseMix(cfg.Mix)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid --%v", mix)
+	}
+	return operations, nil
+}
+
+// APIKey reads the API key from the configured file, or returns an empty key if none is configured.
+func (cfg Config) APIKey() (string, error) {
+	if len(cfg.apiKeyFile) == 0 {
+		return "", nil
+	}
+	bytes, err := ioutil.ReadFile(cfg.apiKeyFile)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read API key file")
+	}
+	apiKey := strings.TrimSpace(string(bytes))
+	logging.AddSecret(apiKey)
+	return apiKey, nil
+}
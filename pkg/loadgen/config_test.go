@@ -0,0 +1,91 @@
+package loadgen_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"        // POSIX/GNU-style CLI arguments.
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/loadgen"
+)
+
+func TestParsingEmptyArgumentsShouldReturnDefaultConfiguration(t *testing.T) {
+	config := parseArgs(t, []string{})
+	assert.Equal(t, "http://localhost:8080", config.Target)
+	assert.Equal(t, 10.0, config.Rate)
+	assert.Equal(t, 10, config.Workers)
+	assert.Equal(t, time.Duration(0), config.Duration)
+	assert.Equal(t, "create=1,list=1,get=8", config.Mix)
+	assert.Equal(t, 5*time.Second, config.Timeout)
+	assert.Equal(t, 5*time.Second, config.ReportInterval)
+	assert.Equal(t, loadgen.TextOutput, config.Output)
+
+	mix, err := config.Validate()
+	assert.NoError(t, err)
+	assert.Equal(t, loadgen.Mix{"create": 1, "list": 1, "get": 8}, mix)
+	apiKey, err := config.APIKey()
+	assert.NoError(t, err)
+	assert.Equal(t, "", apiKey)
+}
+
+func TestParsingArgumentsShouldConfigureLoadGenerator(t *testing.T) {
+	file, err := ioutil.TempFile("", "api-key")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("s3cr3t\n")
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	config := parseArgs(t, []string{
+		"--target", "https://router:8443/",
+		"--rate", "250",
+		"--workers", "50",
+		"--duration", "1m",
+		"--mix", "get=1",
+		"--timeout", "1s",
+		"--report-interval", "0",
+		"--output", "json",
+		"--api-key-file", file.Name(),
+	})
+	mix, err := config.Validate()
+	assert.NoError(t, err)
+	assert.Equal(t, loadgen.Mix{"get": 1}, mix)
+	assert.Equal(t, 250.0, config.Rate)
+	assert.Equal(t, 50, config.Workers)
+	assert.Equal(t, time.Minute, config.Duration)
+	assert.Equal(t, loadgen.JSONOutput, config.Output)
+	apiKey, err := config.APIKey()
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", apiKey)
+}
+
+func TestValidateShouldRejectInvalidArguments(t *testing.T) {
+	for message, args := range map[string][]string{
+		"invalid target: --target must be an HTTP(S) URL but got \"localhost:8080\"":   {"--target", "localhost:8080"},
+		"invalid rate: --rate must be positive but got 0":                              {"--rate", "0"},
+		"invalid workers: --workers must be positive but got -1":                       {"--workers", "-1"},
+		"invalid output: --output must be one of \"text\" or \"json\" but got \"xml\"": {"--output", "xml"},
+		"invalid --mix: invalid mix \"get=0\": at least one weight must be positive":   {"--mix", "get=0"},
+	} {
+		_, err := parseArgs(t, args).Validate()
+		assert.EqualError(t, err, message)
+	}
+}
+
+func TestAPIKeyShouldReturnErrorForMissingFile(t *testing.T) {
+	config := parseArgs(t, []string{"--api-key-file", "/does/not/exist"})
+	_, err := config.APIKey()
+	assert.Error(t, err)
+}
+
+func parseArgs(t *testing.T, args []string) loadgen.Config {
+	config := loadgen.Config{}
+	cli := flag.NewFlagSet("loadgen-test", flag.ContinueOnError)
+	config.RegisterFlags(cli)
+	err := cli.Parse(args)
+	assert.NoError(t, err)
+	return config
+}
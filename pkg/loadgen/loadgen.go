@@ -0,0 +1,153 @@
+// Package loadgen sends a mix of requests to the users API at a target rate, e.g. while switching deployment
+// strategies, and reports on their outcome, broken down by the version which served them.
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Generator sends requests, and records their results.
+type Generator struct {
+	target   string
+	apiKey   string
+	rate     float64
+	workers  int
+	mix      Mix
+	client   *http.Client
+	recorder *Recorder
+
+	ids   []int // IDs of the users created so far, to read them back.
+	mutex sync.Mutex
+}
+
+// NewGenerator creates a generator sending requests to the provided target, as per the provided configuration.
+func NewGenerator(config *Config, mix Mix, apiKey string) *Generator {
+	return &Generator{
+		target:   strings.TrimRight(config.Target, "/"),
+		apiKey:   apiKey,
+		rate:     config.Rate,
+		workers:  config.Workers,
+		mix:      mix,
+		client:   &http.Client{Timeout: config.Timeout},
+		recorder: NewRecorder(),
+	}
+}
+
+// Recorder returns the recorder of this generator's results.
+func (g *Generator) Recorder() *Recorder {
+	return g.recorder
+}
+
+// Run sends requests until the provided context is done, and waits for requests in flight to complete.
+func (g *Generator) Run(ctx context.Context) {
+	operations := make(chan string)
+	var workers sync.WaitGroup
+	for i := 0; i < g.workers; i++ {
+		workers.Add(1)
+		go func(seed int64) {
+			defer workers.Done()
+			random := rand.New(rand.NewSource(seed))
+			for operation := range operations {
+				g.recorder.Record(g.send(operation, random))
+			}
+		}(time.Now().UnixNano() + int64(i))
+	}
+
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / g.rate))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			close(operations)
+			workers.Wait()
+			return
+		case <-ticker.C:
+			select {
+			case operations <- g.mix.Pick(random):
+			default:
+				g.recorder.Miss() // All workers are busy: the target is too slow for this rate and number of workers.
+			}
+		}
+	}
+}
+
+// send sends the provided operation's request, and returns its result.
+func (g *Generator) send(operation string, random *rand.Rand) Result {
+	req, err := g.request(operation, random)
+	if err != nil {
+		return Result{Operation: operation, Err: err}
+	}
+	if len(g.apiKey) > 0 {
+		req.Header.Set("X-API-Key", g.apiKey)
+	}
+	start := time.Now()
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return Result{Operation: operation, Latency: time.Since(start), Err: err}
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(ioutil.Discard, resp.Body) // Includes reading the body in the latency, and lets the connection be reused.
+	result := Result{
+		Operation: operation,
+		Status:    resp.StatusCode,
+		Latency:   time.Since(start),
+		Version:   resp.Header.Get(ServedByHeader),
+		Err:       err,
+	}
+	if operation == Create && resp.StatusCode == http.StatusCreated {
+		g.created(resp.Header.Get("Location"))
+	}
+	return result
+}
+
+func (g *Generator) request(operation string, random *rand.Rand) (*http.Request, error) {
+	switch operation {
+	case Create:
+		n := random.Intn(1000000)
+		body := fmt.Sprintf(`{"firstName":"Load","familyName":"Generator %v","age":%v}`, n, n%100)
+		req, err := http.NewRequest("POST", g.target+"/users", bytes.NewReader([]byte(body)))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	case List:
+		return http.NewRequest("GET", g.target+"/users", nil)
+	case Get:
+		return http.NewRequest("GET", fmt.Sprintf("%v/users/%v", g.target, g.pickID(random)), nil)
+	default:
+		return nil, fmt.Errorf("unknown operation %q", operation)
+	}
+}
+
+// created remembers the ID of the user created at the provided location, e.g. /users/42.
+func (g *Generator) created(location string) {
+	id, err := strconv.Atoi(location[strings.LastIndex(location, "/")+1:])
+	if err != nil {
+		return
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.ids = append(g.ids, id)
+}
+
+// pickID picks the ID of a user created so far, or 1 if none was.
+func (g *Generator) pickID(random *rand.Rand) int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if len(g.ids) == 0 {
+		return 1
+	}
+	return g.ids[random.Intn(len(g.ids))]
+}
@@ -0,0 +1,76 @@
+package loadgen_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/loadgen"
+)
+
+func TestGeneratorShouldSendMixOfRequestsAndReportByServedVersion(t *testing.T) {
+	var mutex sync.Mutex
+	requests := map[string]int{}
+	apiKeys := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		mutex.Lock()
+		requests[req.Method+" "+req.URL.Path]++
+		apiKeys[req.Header.Get("X-API-Key")]++
+		mutex.Unlock()
+		resp.Header().Set(loadgen.ServedByHeader, "v2")
+		if req.Method == "POST" {
+			resp.Header().Set("Location", "/users/7")
+			resp.WriteHeader(http.StatusCreated)
+			return
+		}
+		resp.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	config := parseArgs(t, []string{"--target", server.URL, "--rate", "200", "--workers", "4", "--mix", "create=1,get=1"})
+	mix, err := config.Validate()
+	assert.NoError(t, err)
+	generator := loadgen.NewGenerator(&config, mix, "s3cr3t")
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	generator.Run(ctx)
+
+	report := generator.Recorder().Final()
+	assert.True(t, report.Requests > 10, "expected more than 10 requests but got %v", report.Requests)
+	assert.Equal(t, 0, report.Errors)
+	assert.Len(t, report.Versions, 1)
+	assert.Equal(t, "v2", report.Versions[0].Version)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, report.Requests, apiKeys["s3cr3t"])
+	assert.True(t, requests["POST /users"] > 0)
+	for request := range requests {
+		assert.Contains(t, []string{"POST /users", "GET /users/1", "GET /users/7"}, request)
+	}
+}
+
+func TestGeneratorShouldReportRequestsWithoutResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	config := parseArgs(t, []string{"--target", server.URL, "--rate", "20", "--workers", "1", "--mix", "list=1", "--timeout", "50ms"})
+	mix, err := config.Validate()
+	assert.NoError(t, err)
+	generator := loadgen.NewGenerator(&config, mix, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	generator.Run(ctx)
+
+	report := generator.Recorder().Final()
+	assert.True(t, report.Requests > 0)
+	assert.Equal(t, report.Requests, report.Errors)
+	assert.Equal(t, "(no response)", report.Versions[0].Version)
+}
@@ -0,0 +1,72 @@
+package loadgen
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Operations sent by the load generator.
+const (
+	Create = "create" // POST /users
+	List   = "list"   // GET /users
+	Get    = "get"    // GET /users/{id}, for users previously created, or from ID 1 onwards otherwise.
+)
+
+// Operations lists all operations sent by the load generator.
+var Operations = []string{Create, List, Get}
+
+// Mix is the relative weights of the operations sent, by operation.
+type Mix map[string]int
+
+// ParseMix parses the provided mix of operations, e.g. create=1,list=1,get=8.
+func ParseMix(spec string) (Mix, error) {
+	mix := make(Mix)
+	total := 0
+	for _, part := range strings.Split(spec, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid mix %q: expected <operation>=<weight> but got %q", spec, part)
+		}
+		operation := strings.TrimSpace(kv[0])
+		if !isOperation(operation) {
+			return nil, fmt.Errorf("invalid mix %q: operation must be one of %q but got %q", spec, Operations, operation)
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid mix %q: weight must be a non-negative integer but got %q", spec, kv[1])
+		}
+		mix[operation] += weight
+		total += weight
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("invalid mix %q: at least one weight must be positive", spec)
+	}
+	return mix, nil
+}
+
+func isOperation(operation string) bool {
+	for _, o := range Operations {
+		if o == operation {
+			return true
+		}
+	}
+	return false
+}
+
+// Pick picks an operation at random, as per the mix's weights.
+func (mix Mix) Pick(random *rand.Rand) string {
+	total := 0
+	for _, weight := range mix {
+		total += weight
+	}
+	n := random.Intn(total)
+	for _, operation := range Operations { // Iterate in a fixed order, for picks to be reproducible given a seed.
+		if n < mix[operation] {
+			return operation
+		}
+		n -= mix[operation]
+	}
+	panic("unreachable: weights sum to total")
+}
@@ -0,0 +1,41 @@
+package loadgen_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/loadgen"
+)
+
+func TestParseMixShouldSumWeightsByOperation(t *testing.T) {
+	mix, err := loadgen.ParseMix(" create = 1, get=2 ,get=3")
+	assert.NoError(t, err)
+	assert.Equal(t, loadgen.Mix{"create": 1, "get": 5}, mix)
+}
+
+func TestParseMixShouldRejectInvalidMixes(t *testing.T) {
+	for spec, message := range map[string]string{
+		"get":          "invalid mix \"get\": expected <operation>=<weight> but got \"get\"",
+		"delete=1":     "invalid mix \"delete=1\": operation must be one of [\"create\" \"list\" \"get\"] but got \"delete\"",
+		"get=-1":       "invalid mix \"get=-1\": weight must be a non-negative integer but got \"-1\"",
+		"get=x":        "invalid mix \"get=x\": weight must be a non-negative integer but got \"x\"",
+		"get=0,list=0": "invalid mix \"get=0,list=0\": at least one weight must be positive",
+	} {
+		_, err := loadgen.ParseMix(spec)
+		assert.EqualError(t, err, message)
+	}
+}
+
+func TestPickShouldFollowWeights(t *testing.T) {
+	mix := loadgen.Mix{"create": 1, "list": 0, "get": 3}
+	random := rand.New(rand.NewSource(42))
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		counts[mix.Pick(random)]++
+	}
+	assert.Equal(t, 0, counts["list"])
+	assert.InDelta(t, 1000, counts["create"], 150)
+	assert.InDelta(t, 3000, counts["get"], 150)
+}
@@ -0,0 +1,266 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// ServedByHeader is the header the service reports its version in, to break results down by version, e.g. during a canary release.
+const ServedByHeader = "X-Served-By"
+
+// noResponse is the version requests which got no response, e.g. because of a timeout, are attributed to.
+const noResponse = "(no response)"
+
+// Result is the outcome of a request.
+type Result struct {
+	Operation string
+	Status    int // 0 if no response was received.
+	Latency   time.Duration
+	Version   string // As reported by the X-Served-By header.
+	Err       error
+}
+
+// Failed returns whether this request failed, i.e. got no response, or a 4xx or 5xx one.
+func (r Result) Failed() bool {
+	return r.Err != nil || r.Status >= 400
+}
+
+// Recorder aggregates results, over the whole run, and since the previous live report.
+type Recorder struct {
+	start       time.Time
+	windowStart time.Time
+	total       *window
+	current     *window
+	mutex       sync.Mutex
+}
+
+type window struct {
+	missed   int
+	versions map[string]*versionStats
+}
+
+type versionStats struct {
+	requests   int
+	errors     int
+	statuses   map[string]int
+	operations map[string]int
+	latencies  []time.Duration
+}
+
+func newWindow() *window {
+	return &window{versions: make(map[string]*versionStats)}
+}
+
+// NewRecorder creates a recorder, starting now.
+func NewRecorder() *Recorder {
+	now := time.Now()
+	return &Recorder{
+		start:       now,
+		windowStart: now,
+		total:       newWindow(),
+		current:     newWindow(),
+	}
+}
+
+// Record records the provided result.
+func (recorder *Recorder) Record(result Result) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	recorder.total.record(result)
+	recorder.current.record(result)
+}
+
+// Miss records a request which could not be sent on time, as all workers were busy.
+func (recorder *Recorder) Miss() {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	recorder.total.missed++
+	recorder.current.missed++
+}
+
+func (w *window) record(result Result) {
+	version := result.Version
+	if result.Status == 0 {
+		version = noResponse
+	}
+	stats, ok := w.versions[version]
+	if !ok {
+		stats = &versionStats{statuses: make(map[string]int), operations: make(map[string]int)}
+		w.versions[version] = stats
+	}
+	stats.requests++
+	if result.Failed() {
+		stats.errors++
+	}
+	status := strconv.Itoa(result.Status)
+	if result.Status == 0 {
+		status = "error"
+	}
+	stats.statuses[status]++
+	stats.operations[result.Operation]++
+	stats.latencies = append(stats.latencies, result.Latency)
+}
+
+// Live reports on the results recorded since the previous live report.
+func (recorder *Recorder) Live() *Report {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	now := time.Now()
+	report := recorder.current.report(now.Sub(recorder.windowStart), false)
+	recorder.current = newWindow()
+	recorder.windowStart = now
+	return report
+}
+
+// Final reports on all results recorded.
+func (recorder *Recorder) Final() *Report {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	return recorder.total.report(time.Since(recorder.start), true)
+}
+
+// Report summarises results, overall and by served version.
+type Report struct {
+	Final             bool            `json:"final"`
+	ElapsedSeconds    float64         `json:"elapsedSeconds"`
+	Requests          int             `json:"requests"`
+	Errors            int             `json:"errors"`
+	ErrorRate         float64         `json:"errorRate"`
+	RequestsPerSecond float64         `json:"requestsPerSecond"`
+	Missed            int             `json:"missed"`
+	Versions          []VersionReport `json:"versions"`
+}
+
+// VersionReport summarises the results of requests served by a version.
+type VersionReport struct {
+	Version    string         `json:"version"`
+	Requests   int            `json:"requests"`
+	Errors     int            `json:"errors"`
+	ErrorRate  float64        `json:"errorRate"`
+	Statuses   map[string]int `json:"statuses"`
+	Operations map[string]int `json:"operations"`
+	LatencyMs  Latencies      `json:"latencyMs"`
+}
+
+// Latencies are latency percentiles, in milliseconds.
+type Latencies struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+func (w *window) report(elapsed time.Duration, final bool) *Report {
+	report := &Report{
+		Final:          final,
+		ElapsedSeconds: elapsed.Seconds(),
+		Missed:         w.missed,
+		Versions:       []VersionReport{},
+	}
+	for version, stats := range w.versions {
+		report.Requests += stats.requests
+		report.Errors += stats.errors
+		report.Versions = append(report.Versions, VersionReport{
+			Version:    version,
+			Requests:   stats.requests,
+			Errors:     stats.errors,
+			ErrorRate:  ratio(stats.errors, stats.requests),
+			Statuses:   stats.statuses,
+			Operations: stats.operations,
+			LatencyMs:  percentiles(stats.latencies),
+		})
+	}
+	sort.Slice(report.Versions, func(i, j int) bool { return report.Versions[i].Version < report.Versions[j].Version })
+	report.ErrorRate = ratio(report.Errors, report.Requests)
+	if elapsed > 0 {
+		report.RequestsPerSecond = float64(report.Requests) / elapsed.Seconds()
+	}
+	return report
+}
+
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+func percentiles(latencies []time.Duration) Latencies {
+	if len(latencies) == 0 {
+		return Latencies{}
+	}
+	sorted := make([]time.Duration, len(latencies))
+	copy(sorted, latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p float64) float64 {
+		rank := int(p*float64(len(sorted))+0.5) - 1 // Nearest rank.
+		if rank < 0 {
+			rank = 0
+		}
+		if rank >= len(sorted) {
+			rank = len(sorted) - 1
+		}
+		return milliseconds(sorted[rank])
+	}
+	return Latencies{
+		P50: percentile(0.50),
+		P90: percentile(0.90),
+		P99: percentile(0.99),
+		Max: milliseconds(sorted[len(sorted)-1]),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// WriteJSON writes this report as one line of JSON.
+func (report *Report) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(report)
+}
+
+// WriteText writes this report as a table, one row per served version.
+func (report *Report) WriteText(w io.Writer) error {
+	kind := "live"
+	if report.Final {
+		kind = "final"
+	}
+	if _, err := fmt.Fprintf(w, "[%v] %.1fs: %v requests (%.1f/s), %.2f%% errors, %v missed\n",
+		kind, report.ElapsedSeconds, report.Requests, report.RequestsPerSecond, 100*report.ErrorRate, report.Missed); err != nil {
+		return err
+	}
+	if len(report.Versions) == 0 {
+		return nil
+	}
+	table := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(table, "  VERSION\tREQUESTS\tERRORS\tP50\tP90\tP99\tMAX\tSTATUSES")
+	for _, version := range report.Versions {
+		fmt.Fprintf(table, "  %v\t%v\t%.2f%%\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%v\n",
+			version.Version, version.Requests, 100*version.ErrorRate,
+			version.LatencyMs.P50, version.LatencyMs.P90, version.LatencyMs.P99, version.LatencyMs.Max,
+			formatCounts(version.Statuses))
+	}
+	return table.Flush()
+}
+
+func formatCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	formatted := ""
+	for i, key := range keys {
+		if i > 0 {
+			formatted += " "
+		}
+		formatted += fmt.Sprintf("%v=%v", key, counts[key])
+	}
+	return formatted
+}
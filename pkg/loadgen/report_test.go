@@ -0,0 +1,80 @@
+package loadgen_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/loadgen"
+)
+
+func TestRecorderShouldBreakResultsDownByVersion(t *testing.T) {
+	recorder := loadgen.NewRecorder()
+	for i := 1; i <= 100; i++ {
+		recorder.Record(loadgen.Result{Operation: loadgen.Get, Status: 200, Latency: time.Duration(i) * time.Millisecond, Version: "v1"})
+	}
+	recorder.Record(loadgen.Result{Operation: loadgen.Create, Status: 500, Latency: time.Millisecond, Version: "v2"})
+	recorder.Record(loadgen.Result{Operation: loadgen.Create, Status: 201, Latency: time.Millisecond, Version: "v2"})
+	recorder.Record(loadgen.Result{Operation: loadgen.List, Latency: time.Second, Err: errors.New("timeout")})
+	recorder.Miss()
+
+	report := recorder.Final()
+	assert.True(t, report.Final)
+	assert.Equal(t, 103, report.Requests)
+	assert.Equal(t, 2, report.Errors)
+	assert.Equal(t, 1, report.Missed)
+	assert.Len(t, report.Versions, 3)
+
+	noResponse := report.Versions[0]
+	assert.Equal(t, "(no response)", noResponse.Version)
+	assert.Equal(t, map[string]int{"error": 1}, noResponse.Statuses)
+
+	v1 := report.Versions[1]
+	assert.Equal(t, "v1", v1.Version)
+	assert.Equal(t, 100, v1.Requests)
+	assert.Equal(t, 0.0, v1.ErrorRate)
+	assert.Equal(t, loadgen.Latencies{P50: 50, P90: 90, P99: 99, Max: 100}, v1.LatencyMs)
+	assert.Equal(t, map[string]int{"get": 100}, v1.Operations)
+
+	v2 := report.Versions[2]
+	assert.Equal(t, "v2", v2.Version)
+	assert.Equal(t, 0.5, v2.ErrorRate)
+	assert.Equal(t, map[string]int{"201": 1, "500": 1}, v2.Statuses)
+}
+
+func TestLiveReportsShouldOnlyCoverResultsSinceThePreviousOne(t *testing.T) {
+	recorder := loadgen.NewRecorder()
+	recorder.Record(loadgen.Result{Operation: loadgen.Get, Status: 200, Version: "v1"})
+	assert.Equal(t, 1, recorder.Live().Requests)
+	recorder.Record(loadgen.Result{Operation: loadgen.Get, Status: 200, Version: "v1"})
+	recorder.Record(loadgen.Result{Operation: loadgen.Get, Status: 200, Version: "v1"})
+	live := recorder.Live()
+	assert.False(t, live.Final)
+	assert.Equal(t, 2, live.Requests)
+	assert.Equal(t, 0, recorder.Live().Requests)
+	assert.Equal(t, 3, recorder.Final().Requests)
+}
+
+func TestReportsShouldBeWrittenAsJSONOrText(t *testing.T) {
+	recorder := loadgen.NewRecorder()
+	recorder.Record(loadgen.Result{Operation: loadgen.Get, Status: 404, Latency: 2 * time.Millisecond, Version: "v1.2.0"})
+	report := recorder.Final()
+
+	var buffer bytes.Buffer
+	assert.NoError(t, report.WriteJSON(&buffer))
+	decoded := loadgen.Report{}
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &decoded))
+	assert.Equal(t, 1, decoded.Errors)
+	assert.Equal(t, "v1.2.0", decoded.Versions[0].Version)
+
+	buffer.Reset()
+	assert.NoError(t, report.WriteText(&buffer))
+	assert.Contains(t, buffer.String(), "1 requests")
+	assert.Contains(t, buffer.String(), "100.00% errors")
+	assert.Contains(t, buffer.String(), "v1.2.0")
+	assert.Contains(t, buffer.String(), "404=1")
+}
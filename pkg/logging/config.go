@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus" // Better Logging.
+	flag "github.com/spf13/pflag"    // POSIX/GNU-style CLI arguments.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/version"
+)
+
+// PodNameEnvVar is the environment variable the name of the pod running this process is read from, if set, e.g. via
+// Kubernetes' Downward API, to be added to all logs.
+const PodNameEnvVar = "POD_NAME"
+
+// Config encapsulates the input required to configure logging.
+type Config struct {
+	Format          string
+	Level           string
+	DebugSample     int
+	SensitiveFields []string
+}
+
+const (
+	logFormat      = "log-format"
+	logLevel       = "log-level"
+	logDebugSample = "log-debug-sample"
+	logRedactField = "log-redact-field"
+)
+
+// RegisterFlags maps the provided CLI arguments to fields in this configuration object.
+func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
+	f.StringVar(&cfg.Format, logFormat, FormatText, fmt.Sprintf("Format of logs, one of %q. Timestamps are RFC 3339, with nanoseconds for %v and %v", Formats(), FormatJSON, FormatLogfmt))
+	f.StringVar(&cfg.Level, logLevel, log.InfoLevel.String(), "Level of logs, one of \"debug\", \"info\", \"warning\", \"error\", \"fatal\" or \"panic\". Can be changed at runtime via /admin/log/level")
+	f.IntVar(&cfg.DebugSample, logDebugSample, 1, "Log 1 in every N high-volume debug lines, e.g. SQL queries, counted separately for each kind of line, so that debug logs can be left on without flooding log pipelines. 1 logs all of them")
+	f.StringArrayVar(&cfg.SensitiveFields, logRedactField, nil, "Field whose values are redacted from logs, in addition to passwords, tokens, API keys and Authorization headers. Repeatable")
+}
+
+// Configure sets the format and level of all logs written via the standard logger, adds static fields to these, i.e.
+// the provided service's name, its version, and the pod's name, if known, samples high-volume debug lines, and routes
+// these through a Redactor, so that these never contain secrets. Call RedactStandardLogger first, should anything be
+// logged before the configuration is loaded.
+func (cfg Config) Configure(service string) error {
+	formatter, err := newFormatter(cfg.Format)
+	if err != nil {
+		return errors.Wrapf(err, "invalid --%v", logFormat)
+	}
+	level, err := log.ParseLevel(cfg.Level)
+	if err != nil {
+		return errors.Wrapf(err, "invalid --%v", logLevel)
+	}
+	if cfg.DebugSample < 1 {
+		return fmt.Errorf("invalid --%v: expected a positive number but got %v", logDebugSample, cfg.DebugSample)
+	}
+	fields := log.Fields{"service": service, "version": version.Version}
+	if pod := os.Getenv(PodNameEnvVar); len(pod) > 0 {
+		fields["pod"] = pod
+	}
+	sensitiveFields := append(append([]string{}, DefaultSensitiveFields...), cfg.SensitiveFields...)
+	log.SetFormatter(NewRedactor(withFields(formatter, fields), sensitiveFields...))
+	log.SetLevel(level)
+	debugSampler.setEvery(cfg.DebugSample)
+	return nil
+}
@@ -0,0 +1,91 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	log "github.com/sirupsen/logrus"     // Better Logging.
+	flag "github.com/spf13/pflag"        // POSIX/GNU-style CLI arguments.
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/version"
+)
+
+func TestParsingEmptyArgumentsShouldReturnDefaultConfig(t *testing.T) {
+	config := parseArgs(t, []string{})
+	assert.Equal(t, "text", config.Format)
+	assert.Equal(t, "info", config.Level)
+	assert.Equal(t, 1, config.DebugSample)
+	assert.Empty(t, config.SensitiveFields)
+}
+
+func TestConfigureShouldFormatAndRedactStandardLogger(t *testing.T) {
+	out, restore := captureStandardLogger()
+	defer restore()
+	defer os.Setenv(logging.PodNameEnvVar, os.Getenv(logging.PodNameEnvVar)) // Clean-up.
+	os.Setenv(logging.PodNameEnvVar, "kds-7d4b9c-xk2lp")
+	config := parseArgs(t, []string{"--log-format", "json", "--log-level", "warning", "--log-redact-field", "ssn"})
+	assert.NoError(t, config.Configure("kds-test"))
+	assert.Equal(t, log.WarnLevel, log.GetLevel())
+
+	log.Info("not logged")
+	log.WithField("token", "abc").WithField("X-API-Key", "def").WithField("ssn", "078-05-1120").WithField("service", "overridden").Warn("hello")
+	fields := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &fields))
+	assert.NotEmpty(t, fields["time"])
+	delete(fields, "time")
+	assert.Equal(t, map[string]interface{}{
+		"level":     "warning",
+		"msg":       "hello",
+		"service":   "overridden", // Entries' own fields take precedence over static ones.
+		"version":   version.Version,
+		"pod":       "kds-7d4b9c-xk2lp",
+		"token":     "<redacted>",
+		"X-API-Key": "<redacted>",
+		"ssn":       "<redacted>",
+	}, fields)
+}
+
+func TestConfigureShouldSupportLogfmt(t *testing.T) {
+	out, restore := captureStandardLogger()
+	defer restore()
+	config := parseArgs(t, []string{"--log-format", "logfmt"})
+	assert.NoError(t, config.Configure("kds-test"))
+
+	log.WithField("empty", "").Info("hello")
+	assert.Regexp(t, "^time=\"[^\"]+\" level=info msg=hello empty=\"\" service=kds-test version=\\S+\n$", out.String())
+}
+
+func TestConfigureShouldReturnErrorWhenInvalid(t *testing.T) {
+	_, restore := captureStandardLogger()
+	defer restore()
+	assert.EqualError(t, parseArgs(t, []string{"--log-format", "xml"}).Configure("kds-test"), "invalid --log-format: expected one of [\"text\" \"json\" \"logfmt\"] but got \"xml\"")
+	assert.EqualError(t, parseArgs(t, []string{"--log-level", "verbose"}).Configure("kds-test"), "invalid --log-level: not a valid logrus Level: \"verbose\"")
+	assert.EqualError(t, parseArgs(t, []string{"--log-debug-sample", "0"}).Configure("kds-test"), "invalid --log-debug-sample: expected a positive number but got 0")
+}
+
+// Utility function to redirect the standard logger to a buffer, returned along with a function to restore it.
+func captureStandardLogger() (*bytes.Buffer, func()) {
+	var out bytes.Buffer
+	logger := log.StandardLogger()
+	formatter, level, writer := logger.Formatter, log.GetLevel(), logger.Out
+	log.SetOutput(&out)
+	return &out, func() {
+		log.SetFormatter(formatter)
+		log.SetLevel(level)
+		log.SetOutput(writer)
+	}
+}
+
+// Utility function to create a Config object, register CLI arguments, and parse them.
+func parseArgs(t *testing.T, args []string) *logging.Config {
+	config := logging.Config{}
+	cli := flag.NewFlagSet("service-test", flag.ContinueOnError)
+	config.RegisterFlags(cli)
+	err := cli.Parse(args)
+	assert.NoError(t, err)
+	return &config
+}
@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus" // Better Logging.
+)
+
+// Supported formats of logs.
+const (
+	FormatText   = "text"   // For humans, e.g. in a terminal, coloured if it is one.
+	FormatJSON   = "json"   // For log aggregators, one JSON object per line.
+	FormatLogfmt = "logfmt" // For log aggregators, key=value pairs, never coloured.
+)
+
+// Formats returns the supported formats of logs.
+func Formats() []string {
+	return []string{FormatText, FormatJSON, FormatLogfmt}
+}
+
+func newFormatter(format string) (log.Formatter, error) {
+	switch format {
+	case FormatText:
+		return &log.TextFormatter{FullTimestamp: true, TimestampFormat: time.RFC3339}, nil
+	case FormatJSON:
+		return &log.JSONFormatter{TimestampFormat: time.RFC3339Nano}, nil
+	case FormatLogfmt:
+		return &log.TextFormatter{DisableColors: true, FullTimestamp: true, TimestampFormat: time.RFC3339Nano, QuoteEmptyFields: true}, nil
+	default:
+		return nil, fmt.Errorf("expected one of %q but got %q", Formats(), format)
+	}
+}
+
+// fieldsFormatter adds static fields, e.g. the service's name, to all log entries, before formatting these with the
+// provided formatter. Entries' own fields take precedence.
+type fieldsFormatter struct {
+	formatter log.Formatter
+	fields    log.Fields
+}
+
+func withFields(formatter log.Formatter, fields log.Fields) log.Formatter {
+	return &fieldsFormatter{formatter: formatter, fields: fields}
+}
+
+// Format adds the static fields to a copy of the provided entry, not to modify fields shared with other entries, and formats it.
+func (f *fieldsFormatter) Format(entry *log.Entry) ([]byte, error) {
+	withFields := *entry
+	withFields.Data = make(log.Fields, len(entry.Data)+len(f.fields))
+	for key, value := range f.fields {
+		withFields.Data[key] = value
+	}
+	for key, value := range entry.Data {
+		withFields.Data[key] = value
+	}
+	return f.formatter.Format(&withFields)
+}
@@ -0,0 +1,24 @@
+// Package logging carries request-scoped loggers in contexts, so that all logs about a request can be correlated,
+// e.g. by its ID, from the HTTP handler serving it down to the database queries it runs.
+package logging
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus" // Better Logging.
+)
+
+type contextKey struct{}
+
+// NewContext returns a copy of the provided context carrying the provided logger.
+func NewContext(ctx context.Context, logger *log.Entry) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by the provided context, or the standard logger if none.
+func FromContext(ctx context.Context) *log.Entry {
+	if logger, ok := ctx.Value(contextKey{}).(*log.Entry); ok {
+		return logger
+	}
+	return log.NewEntry(log.StandardLogger())
+}
@@ -0,0 +1,24 @@
+package logging_test
+
+import (
+	"context"
+	"testing"
+
+	log "github.com/sirupsen/logrus"     // Better Logging.
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+)
+
+func TestFromContextShouldReturnLoggerCarriedByContext(t *testing.T) {
+	logger := log.WithField("requestId", "42")
+	ctx := logging.NewContext(context.Background(), logger)
+	assert.Equal(t, logger, logging.FromContext(ctx))
+}
+
+func TestFromContextShouldDefaultToStandardLogger(t *testing.T) {
+	logger := logging.FromContext(context.Background())
+	assert.NotNil(t, logger)
+	assert.Equal(t, log.StandardLogger(), logger.Logger)
+	assert.Empty(t, logger.Data)
+}
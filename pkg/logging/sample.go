@@ -0,0 +1,41 @@
+package logging
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus" // Better Logging.
+)
+
+// sampler lets 1 in every n occurrences of each kind of log line through, counting occurrences per kind, so that
+// frequent lines do not crowd rare ones out.
+type sampler struct {
+	every  int
+	counts map[string]int
+	mutex  sync.Mutex // For thread-safe access to every and counts.
+}
+
+// debugSampler samples high-volume debug lines, as per --log-debug-sample.
+var debugSampler = &sampler{every: 1, counts: make(map[string]int)}
+
+func (s *sampler) setEvery(every int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.every = every
+	s.counts = make(map[string]int)
+}
+
+// sample returns whether this occurrence of the provided kind of line should be logged: the first one, and then 1 in every n.
+func (s *sampler) sample(kind string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	count := s.counts[kind]
+	s.counts[kind] = (count + 1) % s.every
+	return count == 0
+}
+
+// SampleDebug returns whether the provided kind of high-volume debug line, e.g. "select query", should be logged this
+// time: debug logs are enabled, and this occurrence is sampled. Callers should skip the line, and the work to build
+// it, otherwise.
+func SampleDebug(kind string) bool {
+	return log.GetLevel() >= log.DebugLevel && debugSampler.sample(kind)
+}
@@ -0,0 +1,36 @@
+package logging_test
+
+import (
+	"testing"
+
+	log "github.com/sirupsen/logrus"     // Better Logging.
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+)
+
+func TestSampleDebugShouldLogOneInEveryN(t *testing.T) {
+	_, restore := captureStandardLogger()
+	defer restore()
+	assert.NoError(t, parseArgs(t, []string{"--log-level", "debug", "--log-debug-sample", "3"}).Configure("kds-test"))
+
+	var sampled []bool
+	for i := 0; i < 7; i++ {
+		sampled = append(sampled, logging.SampleDebug("select query"))
+	}
+	assert.Equal(t, []bool{true, false, false, true, false, false, true}, sampled)
+	// Each kind of line is counted separately, so that frequent ones do not crowd rare ones out:
+	assert.True(t, logging.SampleDebug("insert query"))
+	assert.False(t, logging.SampleDebug("insert query"))
+}
+
+func TestSampleDebugShouldLogNothingUnlessDebugIsEnabled(t *testing.T) {
+	_, restore := captureStandardLogger()
+	defer restore()
+	assert.NoError(t, parseArgs(t, []string{"--log-level", "info"}).Configure("kds-test"))
+	assert.False(t, logging.SampleDebug("select query"))
+
+	log.SetLevel(log.DebugLevel) // E.g. via /admin/log/level.
+	assert.True(t, logging.SampleDebug("select query"))
+	assert.True(t, logging.SampleDebug("select query")) // All lines are logged by default.
+}
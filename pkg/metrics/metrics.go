@@ -0,0 +1,236 @@
+// Package metrics exposes counters and gauges in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus" // Better Logging.
+)
+
+const (
+	counterType = "counter"
+	gaugeType   = "gauge"
+)
+
+// Registry holds metrics, and serves them over HTTP in the Prometheus text exposition format.
+type Registry struct {
+	metrics []metric
+	names   map[string]struct{}
+	mutex   sync.Mutex // For thread-safe access to the metrics.
+}
+
+type metric interface {
+	write(buffer *bytes.Buffer)
+}
+
+// NewRegistry creates a new, empty, Registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]struct{})}
+}
+
+func (registry *Registry) register(name string, m metric) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if _, ok := registry.names[name]; ok {
+		panic(fmt.Sprintf("metrics: %v registered twice", name))
+	}
+	registry.names[name] = struct{}{}
+	registry.metrics = append(registry.metrics, m)
+}
+
+// Counter registers, and returns, a new counter with the provided label names.
+func (registry *Registry) Counter(name, help string, labels ...string) *Counter {
+	counter := &Counter{newVec(name, help, counterType, labels)}
+	registry.register(name, counter)
+	return counter
+}
+
+// Gauge registers, and returns, a new gauge with the provided label names.
+func (registry *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	gauge := &Gauge{newVec(name, help, gaugeType, labels)}
+	registry.register(name, gauge)
+	return gauge
+}
+
+// CounterFunc registers a counter whose value is read from the provided function, on each scrape.
+func (registry *Registry) CounterFunc(name, help string, value func() float64) {
+	registry.register(name, &funcMetric{name, help, counterType, value})
+}
+
+// GaugeFunc registers a gauge whose value is read from the provided function, on each scrape.
+func (registry *Registry) GaugeFunc(name, help string, value func() float64) {
+	registry.register(name, &funcMetric{name, help, gaugeType, value})
+}
+
+// ServeHTTP writes all metrics, in the Prometheus text exposition format.
+func (registry *Registry) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	registry.mutex.Lock()
+	metrics := make([]metric, len(registry.metrics))
+	copy(metrics, registry.metrics)
+	registry.mutex.Unlock()
+
+	var buffer bytes.Buffer
+	for _, m := range metrics {
+		m.write(&buffer)
+	}
+	resp.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	resp.WriteHeader(http.StatusOK)
+	if _, err := resp.Write(buffer.Bytes()); err != nil {
+		log.WithField("err", err).Error("failed to write metrics")
+	}
+}
+
+// Counter is a metric which only goes up, optionally partitioned by labels.
+type Counter struct {
+	*vec
+}
+
+// Inc increments by 1 the counter for the provided label values.
+func (counter *Counter) Inc(labelValues ...string) {
+	counter.add(1, labelValues)
+}
+
+// Add adds the provided, positive, delta to the counter for the provided label values.
+func (counter *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("metrics: counter %v cannot decrease", counter.name))
+	}
+	counter.add(delta, labelValues)
+}
+
+// Value returns the current value of the counter for the provided label values.
+func (counter *Counter) Value(labelValues ...string) float64 {
+	return counter.value(labelValues)
+}
+
+// Gauge is a metric which can go up and down, optionally partitioned by labels.
+type Gauge struct {
+	*vec
+}
+
+// Set sets the gauge for the provided label values.
+func (gauge *Gauge) Set(value float64, labelValues ...string) {
+	gauge.set(value, labelValues)
+}
+
+// Add adds the provided delta, which may be negative, to the gauge for the provided label values.
+func (gauge *Gauge) Add(delta float64, labelValues ...string) {
+	gauge.add(delta, labelValues)
+}
+
+// Value returns the current value of the gauge for the provided label values.
+func (gauge *Gauge) Value(labelValues ...string) float64 {
+	return gauge.value(labelValues)
+}
+
+// vec holds the values of a metric, for each combination of label values.
+type vec struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	values map[string]float64 // Keyed by formatted label pairs, e.g. {route="users"}.
+	mutex  sync.Mutex         // For thread-safe access to the values.
+}
+
+func newVec(name, help, kind string, labels []string) *vec {
+	return &vec{name: name, help: help, kind: kind, labels: labels, values: make(map[string]float64)}
+}
+
+func (v *vec) key(labelValues []string) string {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %v expects labels %q but got values %q", v.name, v.labels, labelValues))
+	}
+	return formatLabels(v.labels, labelValues)
+}
+
+func (v *vec) add(delta float64, labelValues []string) {
+	key := v.key(labelValues)
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.values[key] += delta
+}
+
+func (v *vec) set(value float64, labelValues []string) {
+	key := v.key(labelValues)
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.values[key] = value
+}
+
+func (v *vec) value(labelValues []string) float64 {
+	key := v.key(labelValues)
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.values[key]
+}
+
+func (v *vec) write(buffer *bytes.Buffer) {
+	writeHeader(buffer, v.name, v.help, v.kind)
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if len(v.labels) == 0 {
+		writeSample(buffer, v.name, "", v.values[""])
+		return
+	}
+	keys := make([]string, 0, len(v.values))
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		writeSample(buffer, v.name, key, v.values[key])
+	}
+}
+
+type funcMetric struct {
+	name  string
+	help  string
+	kind  string
+	value func() float64
+}
+
+func (m *funcMetric) write(buffer *bytes.Buffer) {
+	writeHeader(buffer, m.name, m.help, m.kind)
+	writeSample(buffer, m.name, "", m.value())
+}
+
+func writeHeader(buffer *bytes.Buffer, name, help, kind string) {
+	fmt.Fprintf(buffer, "# HELP %v %v\n", name, strings.Replace(help, "\n", " ", -1))
+	fmt.Fprintf(buffer, "# TYPE %v %v\n", name, kind)
+}
+
+func writeSample(buffer *bytes.Buffer, name, labels string, value float64) {
+	fmt.Fprintf(buffer, "%v%v %v\n", name, labels, formatValue(value))
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + strconv.Quote(values[i])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, +1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,50 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/metrics"
+)
+
+func TestRegistryShouldServeMetricsInPrometheusTextFormat(t *testing.T) {
+	registry := metrics.NewRegistry()
+	requests := registry.Counter("http_requests_total", "Number of HTTP requests.", "route", "code")
+	inFlight := registry.Gauge("http_requests_in_flight", "Number of HTTP requests being served.")
+	registry.GaugeFunc("answer", "The answer.", func() float64 { return 42 })
+
+	requests.Inc("users", "200")
+	requests.Add(2, "users", "200")
+	requests.Inc("healthz", "204")
+	inFlight.Add(3)
+	inFlight.Add(-1)
+	assert.Equal(t, float64(3), requests.Value("users", "200"))
+	assert.Equal(t, float64(2), inFlight.Value())
+
+	resp := httptest.NewRecorder()
+	registry.ServeHTTP(resp, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "text/plain; version=0.0.4", resp.Header().Get("Content-Type"))
+	assert.Equal(t, `# HELP http_requests_total Number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{route="healthz",code="204"} 1
+http_requests_total{route="users",code="200"} 3
+# HELP http_requests_in_flight Number of HTTP requests being served.
+# TYPE http_requests_in_flight gauge
+http_requests_in_flight 2
+# HELP answer The answer.
+# TYPE answer gauge
+answer 42
+`, resp.Body.String())
+}
+
+func TestRegistryShouldRejectDuplicatesAndWrongLabels(t *testing.T) {
+	registry := metrics.NewRegistry()
+	counter := registry.Counter("requests_total", "Number of requests.", "route")
+	assert.Panics(t, func() { registry.Gauge("requests_total", "Duplicate.") })
+	assert.Panics(t, func() { counter.Inc() })
+	assert.Panics(t, func() { counter.Add(-1, "users") })
+}
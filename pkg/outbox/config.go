@@ -0,0 +1,98 @@
+package outbox
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag" // POSIX/GNU-style CLI arguments.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/conf"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+)
+
+// Config encapsulates the input required to configure the relay of events to downstream systems.
+type Config struct {
+	Sink              string
+	WebhookURL        string
+	webhookSecretFile string
+	WebhookMaxRetries int
+	WebhookTimeout    time.Duration
+	File              string
+	PollInterval      time.Duration
+	BatchSize         int
+}
+
+const (
+	sink              = "outbox-sink"
+	webhookURL        = "outbox-webhook-url"
+	webhookSecretFile = "outbox-webhook-secret-file"
+	webhookMaxRetries = "outbox-webhook-max-retries"
+	webhookTimeout    = "outbox-webhook-timeout"
+	file              = "outbox-file"
+	pollInterval      = "outbox-poll-interval"
+	batchSize         = "outbox-batch-size"
+)
+
+// Supported sinks.
+const (
+	WebhookSinkName = "webhook"
+	FileSinkName    = "file"
+)
+
+// RegisterFlags maps the provided CLI arguments to fields in this configuration object.
+func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
+	f.StringVar(&cfg.Sink, sink, "", fmt.Sprintf("Sink to publish user events to: %q, %q, or empty to disable the relay of events", WebhookSinkName, FileSinkName))
+	f.StringVar(&cfg.WebhookURL, webhookURL, "", fmt.Sprintf("URL to POST user events to, when --%v=%v", sink, WebhookSinkName))
+	conf.MarkSecret(f, webhookURL) // May contain credentials.
+	f.StringVar(&cfg.webhookSecretFile, webhookSecretFile, "", "File containing the secret used to sign user events with HMAC-SHA256. Events are not signed if empty")
+	f.IntVar(&cfg.WebhookMaxRetries, webhookMaxRetries, 5, "Maximum number of retries when POSTing an user event fails")
+	f.DurationVar(&cfg.WebhookTimeout, webhookTimeout, 5*time.Second, "The maximum duration of each attempt to POST an user event")
+	f.StringVar(&cfg.File, file, "", fmt.Sprintf("File to append user events to, as newline-delimited JSON, when --%v=%v", sink, FileSinkName))
+	f.DurationVar(&cfg.PollInterval, pollInterval, 1*time.Second, "How often to check for user events pending delivery")
+	f.IntVar(&cfg.BatchSize, batchSize, 100, "Maximum number of user events to deliver per poll")
+}
+
+// NewSink creates the configured sink, or returns nil if the relay of events is disabled.
+func (cfg Config) NewSink() (Sink, error) {
+	if len(cfg.Sink) == 0 {
+		return nil, nil
+	}
+	if cfg.PollInterval <= 0 {
+		return nil, fmt.Errorf("invalid poll interval: --%v must be positive but got %v", pollInterval, cfg.PollInterval)
+	}
+	if cfg.BatchSize <= 0 {
+		return nil, fmt.Errorf("invalid batch size: --%v must be positive but got %v", batchSize, cfg.BatchSize)
+	}
+	switch cfg.Sink {
+	case WebhookSinkName:
+		if len(cfg.WebhookURL) == 0 {
+			return nil, fmt.Errorf("invalid webhook: --%v=%v requires --%v", sink, WebhookSinkName, webhookURL)
+		}
+		secret, err := cfg.webhookSecret()
+		if err != nil {
+			return nil, err
+		}
+		return NewWebhookSink(cfg.WebhookURL, secret, cfg.WebhookMaxRetries, cfg.WebhookTimeout), nil
+	case FileSinkName:
+		if len(cfg.File) == 0 {
+			return nil, fmt.Errorf("invalid file: --%v=%v requires --%v", sink, FileSinkName, file)
+		}
+		return NewFileSink(cfg.File)
+	default:
+		return nil, fmt.Errorf("invalid sink: --%v must be one of %q or %q but got %q", sink, WebhookSinkName, FileSinkName, cfg.Sink)
+	}
+}
+
+func (cfg Config) webhookSecret() ([]byte, error) {
+	if len(cfg.webhookSecretFile) == 0 {
+		return nil, nil
+	}
+	secret, err := ioutil.ReadFile(cfg.webhookSecretFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read webhook secret file")
+	}
+	logging.AddSecret(string(secret))
+	return secret, nil
+}
@@ -0,0 +1,85 @@
+package outbox_test
+
+import (
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"        // POSIX/GNU-style CLI arguments.
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/outbox"
+)
+
+func TestParsingEmptyArgumentsShouldReturnDefaultConfig(t *testing.T) {
+	config := parseArgs(t, []string{})
+	assert.NotNil(t, config)
+	assert.Equal(t, "", config.Sink)
+	assert.Equal(t, 5, config.WebhookMaxRetries)
+	assert.Equal(t, 5*time.Second, config.WebhookTimeout)
+	assert.Equal(t, 1*time.Second, config.PollInterval)
+	assert.Equal(t, 100, config.BatchSize)
+
+	sink, err := config.NewSink()
+	assert.NoError(t, err)
+	assert.Nil(t, sink)
+}
+
+func TestParsingArgumentsShouldOverrideDefaultConfig(t *testing.T) {
+	config := parseArgs(t, []string{
+		"--outbox-sink", "webhook",
+		"--outbox-webhook-url", "http://localhost:1337/events",
+		"--outbox-webhook-max-retries", "3",
+		"--outbox-webhook-timeout", "10s",
+		"--outbox-poll-interval", "2s",
+		"--outbox-batch-size", "42",
+	})
+	assert.NotNil(t, config)
+	assert.Equal(t, "webhook", config.Sink)
+	assert.Equal(t, "http://localhost:1337/events", config.WebhookURL)
+	assert.Equal(t, 3, config.WebhookMaxRetries)
+	assert.Equal(t, 10*time.Second, config.WebhookTimeout)
+	assert.Equal(t, 2*time.Second, config.PollInterval)
+	assert.Equal(t, 42, config.BatchSize)
+
+	sink, err := config.NewSink()
+	assert.NoError(t, err)
+	assert.IsType(t, &outbox.WebhookSink{}, sink)
+}
+
+func TestWebhookSinkWithoutURLShouldReturnError(t *testing.T) {
+	config := parseArgs(t, []string{"--outbox-sink", "webhook"})
+	sink, err := config.NewSink()
+	assert.EqualError(t, err, "invalid webhook: --outbox-sink=webhook requires --outbox-webhook-url")
+	assert.Nil(t, sink)
+}
+
+func TestNonPositivePollIntervalShouldReturnError(t *testing.T) {
+	config := parseArgs(t, []string{"--outbox-sink", "file", "--outbox-file", "events.ndjson", "--outbox-poll-interval", "0s"})
+	sink, err := config.NewSink()
+	assert.EqualError(t, err, "invalid poll interval: --outbox-poll-interval must be positive but got 0s")
+	assert.Nil(t, sink)
+}
+
+func TestNonPositiveBatchSizeShouldReturnError(t *testing.T) {
+	config := parseArgs(t, []string{"--outbox-sink", "file", "--outbox-file", "events.ndjson", "--outbox-batch-size", "-1"})
+	sink, err := config.NewSink()
+	assert.EqualError(t, err, "invalid batch size: --outbox-batch-size must be positive but got -1")
+	assert.Nil(t, sink)
+}
+
+func TestUnknownSinkShouldReturnError(t *testing.T) {
+	config := parseArgs(t, []string{"--outbox-sink", "kafka"})
+	sink, err := config.NewSink()
+	assert.EqualError(t, err, "invalid sink: --outbox-sink must be one of \"webhook\" or \"file\" but got \"kafka\"")
+	assert.Nil(t, sink)
+}
+
+// Utility function to create a Config object, register CLI arguments, and parse them.
+func parseArgs(t *testing.T, args []string) *outbox.Config {
+	config := outbox.Config{}
+	cli := flag.NewFlagSet("service-test", flag.ContinueOnError)
+	config.RegisterFlags(cli)
+	err := cli.Parse(args)
+	assert.NoError(t, err)
+	return &config
+}
@@ -0,0 +1,66 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus" // Better Logging.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+)
+
+// Relay periodically publishes pending user events to a sink, and marks them as delivered.
+// Events are marked as delivered only once published, so that delivery is at-least-once:
+// should the process crash in between, the events are published again on the next run.
+type Relay struct {
+	outbox       db.Outbox
+	sink         Sink
+	pollInterval time.Duration
+	batchSize    int
+}
+
+// NewRelay creates a new relay of events from the provided outbox to the provided sink.
+func NewRelay(outbox db.Outbox, sink Sink, config *Config) *Relay {
+	return &Relay{
+		outbox:       outbox,
+		sink:         sink,
+		pollInterval: config.PollInterval,
+		batchSize:    config.BatchSize,
+	}
+}
+
+// Run relays events until the provided context is cancelled.
+func (relay *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(relay.pollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			// Keep going while there are full batches of events to deliver:
+			delivered, err := relay.RelayPending(ctx)
+			if err != nil {
+				log.WithField("err", err).Error("failed to relay events")
+			}
+			if err != nil || delivered < relay.batchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending publishes one batch of pending events, in order, and returns how many of them were delivered.
+// It stops at the first event which fails to be published, so that events are not delivered out of order.
+func (relay *Relay) RelayPending(ctx context.Context) (int, error) {
+	delivered, err := relay.outbox.DeliverEvents(ctx, relay.batchSize, func(event *domain.Event) error {
+		return relay.sink.Publish(ctx, event)
+	})
+	if delivered > 0 {
+		log.WithField("count", delivered).Debug("relayed events")
+	}
+	return delivered, err
+}
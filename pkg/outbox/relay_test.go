@@ -0,0 +1,104 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db/dbtest"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/outbox"
+)
+
+func TestRelayShouldAppendEventsToFileAndMarkThemDelivered(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "outbox")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir) // Clean-up.
+	path := filepath.Join(dir, "events.ndjson")
+
+	sink, err := outbox.NewFileSink(path)
+	assert.NoError(t, err)
+	defer sink.Close()
+
+	ctx := context.Background()
+	database := dbtest.NewInMemoryDB()
+	createUsers(t, database, "Luke", "Obi-Wan")
+
+	relay := outbox.NewRelay(database, sink, &outbox.Config{BatchSize: 10})
+	delivered, err := relay.RelayPending(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, delivered)
+
+	lines := readLines(t, path)
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "\"id\":1,\"type\":\"user.created\",\"userId\":1")
+	assert.Contains(t, lines[1], "\"id\":2,\"type\":\"user.created\",\"userId\":2")
+
+	// Nothing left to deliver:
+	delivered, err = relay.RelayPending(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, delivered)
+
+	// Replaying from the second event delivers it again:
+	replayed, err := database.ReplayEvents(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), replayed)
+	delivered, err = relay.RelayPending(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Len(t, readLines(t, path), 3)
+}
+
+func TestRelayShouldStopAtFirstFailureAndRetryLater(t *testing.T) {
+	ctx := context.Background()
+	database := dbtest.NewInMemoryDB()
+	createUsers(t, database, "Luke", "Obi-Wan", "Yoda")
+
+	sink := &flakySink{failOn: 2}
+	relay := outbox.NewRelay(database, sink, &outbox.Config{BatchSize: 10})
+	delivered, err := relay.RelayPending(ctx)
+	assert.EqualError(t, err, "sink unavailable")
+	assert.Equal(t, 1, delivered)
+
+	sink.failOn = 0
+	delivered, err = relay.RelayPending(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, delivered)
+	assert.Equal(t, []int64{1, 2, 3}, sink.published)
+}
+
+type flakySink struct {
+	failOn    int64
+	published []int64
+}
+
+func (sink *flakySink) Publish(_ context.Context, event *domain.Event) error {
+	if event.ID == sink.failOn {
+		return errors.New("sink unavailable")
+	}
+	sink.published = append(sink.published, event.ID)
+	return nil
+}
+
+func (sink *flakySink) Close() error {
+	return nil
+}
+
+func createUsers(t *testing.T, database *dbtest.InMemoryDB, firstNames ...string) {
+	for _, firstName := range firstNames {
+		_, err := database.CreateUser(context.Background(), &domain.User{FirstName: firstName})
+		assert.NoError(t, err)
+	}
+}
+
+func readLines(t *testing.T, path string) []string {
+	bytes, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	return strings.Split(strings.TrimSuffix(string(bytes), "\n"), "\n")
+}
@@ -0,0 +1,54 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+)
+
+// Sink is the interface for a downstream system user events are published to.
+type Sink interface {
+	// Publish publishes the provided event. Events may be published more than once, hence sinks ought to be idempotent.
+	Publish(ctx context.Context, event *domain.Event) error
+	// Close releases any resource held by this sink.
+	Close() error
+}
+
+// FileSink appends user events to a file, as newline-delimited JSON.
+type FileSink struct {
+	file  *os.File
+	mutex sync.Mutex // For thread-safe appends to the file.
+}
+
+// NewFileSink opens, or creates, the provided file, in order to append events to it.
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{
+		file: file,
+	}, nil
+}
+
+// Publish appends the provided event to the file, and flushes it to disk.
+func (sink *FileSink) Publish(_ context.Context, event *domain.Event) error {
+	bytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if _, err := sink.file.Write(append(bytes, '\n')); err != nil {
+		return err
+	}
+	return sink.file.Sync()
+}
+
+// Close closes the underlying file.
+func (sink *FileSink) Close() error {
+	return sink.file.Close()
+}
@@ -0,0 +1,112 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus" // Better Logging.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+)
+
+// Headers set on each request sent by WebhookSink.
+const (
+	EventIDHeader   = "X-KDS-Event-ID"
+	EventTypeHeader = "X-KDS-Event-Type"
+	TimestampHeader = "X-KDS-Timestamp"
+	SignatureHeader = "X-KDS-Signature"
+)
+
+const initialBackoff = 500 * time.Millisecond
+
+// WebhookSink POSTs user events to an HTTP endpoint, signing them with HMAC-SHA256 if a secret is provided.
+type WebhookSink struct {
+	url        string
+	secret     []byte
+	maxRetries int
+	backoff    time.Duration
+	client     *http.Client
+}
+
+// NewWebhookSink creates a new sink POSTing user events to the provided URL.
+func NewWebhookSink(url string, secret []byte, maxRetries int, timeout time.Duration) *WebhookSink {
+	return &WebhookSink{
+		url:        url,
+		secret:     secret,
+		maxRetries: maxRetries,
+		backoff:    initialBackoff,
+		client:     &http.Client{Timeout: timeout},
+	}
+}
+
+// Publish POSTs the provided event, retrying with exponential backoff on network errors and non-2xx responses.
+func (sink *WebhookSink) Publish(ctx context.Context, event *domain.Event) error {
+	body, err := event.Marshal()
+	if err != nil {
+		return err
+	}
+	logger := log.WithField("url", sink.url).WithField("eventID", event.ID)
+	backoff := sink.backoff
+	for attempt := 0; ; attempt++ {
+		err = sink.post(ctx, event, body)
+		if err == nil {
+			return nil
+		}
+		if attempt >= sink.maxRetries {
+			return err
+		}
+		logger.WithField("err", err).WithField("attempt", attempt+1).Warn("failed to publish event, retrying...")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+}
+
+func (sink *WebhookSink) post(ctx context.Context, event *domain.Event, body []byte) error {
+	req, err := http.NewRequest("POST", sink.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventIDHeader, strconv.FormatInt(event.ID, 10))
+	req.Header.Set(EventTypeHeader, event.Type)
+	req.Header.Set(TimestampHeader, timestamp)
+	if len(sink.secret) > 0 {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(sink.secret, timestamp, body))
+	}
+	resp, err := sink.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status: %v", resp.Status)
+	}
+	return nil
+}
+
+// Sign computes the hex-encoded HMAC-SHA256 of "<timestamp>.<body>", keyed with the provided secret.
+// Receivers should recompute it and compare it to the X-KDS-Signature header, and reject stale timestamps to prevent replays.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Close is a no-op, but present so that we implement the Sink interface.
+func (sink *WebhookSink) Close() error {
+	return nil
+}
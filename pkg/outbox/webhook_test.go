@@ -0,0 +1,61 @@
+package outbox_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/outbox"
+)
+
+func TestWebhookSinkShouldSignEventsAndRetryOnFailure(t *testing.T) {
+	secret := []byte("s3cr3t")
+	attempts := 0
+	webhook := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		attempts++
+		if attempts == 1 {
+			resp.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, err := ioutil.ReadAll(req.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "1", req.Header.Get(outbox.EventIDHeader))
+		assert.Equal(t, "user.created", req.Header.Get(outbox.EventTypeHeader))
+		assert.Equal(t, "sha256="+outbox.Sign(secret, req.Header.Get(outbox.TimestampHeader), body), req.Header.Get(outbox.SignatureHeader))
+		resp.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhook.Close()
+
+	sink := outbox.NewWebhookSink(webhook.URL, secret, 1, time.Second)
+	err := sink.Publish(context.Background(), userCreated(t, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestWebhookSinkShouldGiveUpAfterMaxRetries(t *testing.T) {
+	attempts := 0
+	webhook := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		attempts++
+		resp.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer webhook.Close()
+
+	sink := outbox.NewWebhookSink(webhook.URL, nil, 0, time.Second)
+	err := sink.Publish(context.Background(), userCreated(t, 1))
+	assert.EqualError(t, err, "unexpected response status: 500 Internal Server Error")
+	assert.Equal(t, 1, attempts)
+}
+
+// Utility function to create a "user.created" event with the provided ID.
+func userCreated(t *testing.T, id int64) *domain.Event {
+	event, err := domain.NewUserEvent(domain.UserCreated, &domain.User{ID: int(id), FirstName: "Luke", FamilyName: "Skywalker", Age: 20})
+	assert.NoError(t, err)
+	event.ID = id
+	return event
+}
@@ -0,0 +1,94 @@
+package router
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gorilla/mux" // Better HTTP API.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/server"
+)
+
+// RegisterRoutes registers the router's own endpoints, under /router, and routes all other requests to backends.
+// Endpoints to read backends' status and shift weights are only registered if an admin token is provided.
+func (router *Router) RegisterRoutes(r *mux.Router, adminToken string) {
+	r.Use(server.LogRequests)
+	own := r.PathPrefix("/router").Subrouter()
+	own.HandleFunc("/healthz", router.HealthzHandler).Methods("GET").Name("router_healthz")
+	own.Handle("/metrics", router.registry).Methods("GET").Name("router_metrics")
+	if len(adminToken) > 0 {
+		own.Handle("/backends", authenticate(adminToken, router.ReadBackendsHandler)).Methods("GET").Name("router_backends")
+		own.Handle("/weights", authenticate(adminToken, router.UpdateWeightsHandler)).Methods("PUT").Name("router_weights")
+	}
+	r.PathPrefix("/").Handler(router).Name("proxy")
+}
+
+// authenticate only lets requests bearing the admin token through.
+func authenticate(token string, handler http.HandlerFunc) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), expected) != 1 {
+			logging.FromContext(req.Context()).Warn("unauthorised admin request")
+			resp.Header().Set("WWW-Authenticate", "Bearer")
+			resp.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler(resp, req)
+	})
+}
+
+// HealthzHandler responds with 204 No Content if at least one backend is healthy, or 503 Service Unavailable otherwise.
+func (router *Router) HealthzHandler(resp http.ResponseWriter, req *http.Request) {
+	for _, b := range router.Backends() {
+		if b.Healthy {
+			resp.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	writeError(resp, "no healthy backend", http.StatusServiceUnavailable)
+}
+
+// ReadBackendsHandler returns the status of all backends.
+func (router *Router) ReadBackendsHandler(resp http.ResponseWriter, req *http.Request) {
+	writeJSON(resp, req, router.Backends())
+}
+
+// UpdateWeightsHandler shifts the percentage of requests routed to backends, e.g. {"stable":50,"canary":50}, and
+// returns the status of all backends.
+func (router *Router) UpdateWeightsHandler(resp http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	bytes, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		logger.WithField("err", err).Error("failed to read request's body")
+		writeError(resp, "failed to read request's body", http.StatusInternalServerError)
+		return
+	}
+	percentages := make(map[string]int)
+	if err := json.Unmarshal(bytes, &percentages); err != nil {
+		writeError(resp, "failed to deserialise weights: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := router.SetWeights(percentages); err != nil {
+		writeError(resp, "invalid weights: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	logger.WithField("weights", string(bytes)).Info("updated weights")
+	writeJSON(resp, req, router.Backends())
+}
+
+func writeJSON(resp http.ResponseWriter, req *http.Request, value interface{}) {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		logging.FromContext(req.Context()).WithField("err", err).Error("failed to serialise response as JSON")
+		writeError(resp, "failed to serialise response as JSON", http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(http.StatusOK)
+	if _, err := resp.Write(bytes); err != nil {
+		logging.FromContext(req.Context()).WithField("err", err).Error("failed to write response")
+	}
+}
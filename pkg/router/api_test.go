@@ -0,0 +1,50 @@
+package router_test
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+)
+
+const token = "s3cr3t"
+
+func TestAdminEndpointsShouldRequireToken(t *testing.T) {
+	_, r := newRouter(t, "--backend", "stable=http://kds-v1:8080")
+	resp := serve(r, withToken(get(t, "/router/backends"), "not-the-token"))
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Equal(t, "Bearer", resp.Header().Get("WWW-Authenticate"))
+}
+
+func TestAdminEndpointsShouldReadBackendsAndShiftWeights(t *testing.T) {
+	_, r := newRouter(t, "--backend", "stable=http://kds-v1:8080", "--backend", "canary=http://kds-v2:8080")
+
+	resp := serve(r, withToken(get(t, "/router/backends"), token))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "[{\"name\":\"stable\",\"url\":\"http://kds-v1:8080\",\"weight\":100,\"healthy\":true,\"canary\":false},{\"name\":\"canary\",\"url\":\"http://kds-v2:8080\",\"weight\":0,\"healthy\":true,\"canary\":true}]", resp.Body.String())
+
+	resp = serve(r, withToken(put(t, "/router/weights", "{\"stable\":80,\"canary\":20}"), token))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "[{\"name\":\"stable\",\"url\":\"http://kds-v1:8080\",\"weight\":80,\"healthy\":true,\"canary\":false},{\"name\":\"canary\",\"url\":\"http://kds-v2:8080\",\"weight\":20,\"healthy\":true,\"canary\":true}]", resp.Body.String())
+
+	resp = serve(r, withToken(put(t, "/router/weights", "{\"canary\":30}"), token))
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Body.String(), "invalid weights: must add up to 100 but add up to 110")
+
+	resp = serve(r, get(t, "/router/metrics"))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), "router_backend_weight{backend=\"canary\"} 20\n")
+	assert.Contains(t, resp.Body.String(), "router_backend_healthy{backend=\"stable\"} 1\n")
+}
+
+func withToken(req *http.Request, token string) *http.Request {
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func put(t *testing.T, uri, body string) *http.Request {
+	req, err := http.NewRequest("PUT", uri, bytes.NewReader([]byte(body)))
+	assert.NoError(t, err)
+	return req
+}
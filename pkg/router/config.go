@@ -0,0 +1,198 @@
+package router
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag" // POSIX/GNU-style CLI arguments.
+)
+
+// Config encapsulates the input required to configure the router.
+type Config struct {
+	Port               int
+	Backends           []string
+	Weights            string
+	Canary             string
+	StickyCookie       string
+	BackendTimeout     time.Duration
+	HealthPath         string
+	HealthInterval     time.Duration
+	HealthTimeout      time.Duration
+	UnhealthyThreshold int
+	HealthyThreshold   int
+}
+
+const (
+	port               = "port"
+	backends           = "backend"
+	weights            = "weights"
+	canary             = "canary"
+	stickyCookie       = "sticky-cookie"
+	backendTimeout     = "backend-timeout"
+	healthPath         = "health-path"
+	healthInterval     = "health-interval"
+	healthTimeout      = "health-timeout"
+	unhealthyThreshold = "unhealthy-threshold"
+	healthyThreshold   = "healthy-threshold"
+)
+
+// RegisterFlags maps the provided CLI arguments to fields in this configuration object.
+func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
+	f.IntVar(&cfg.Port, port, 8080, "Port to route requests from")
+	f.StringArrayVar(&cfg.Backends, backends, nil, "Backend to route requests to, as <name>=<URL>, e.g. stable=http://kds-v1:8080. Repeatable, at least once")
+	f.StringVar(&cfg.Weights, weights, "", "Percentage of requests routed to each backend, as <name>=<percentage>, comma-separated, e.g. stable=90,canary=10. Percentages must add up to 100. All requests are routed to the first backend if empty")
+	f.StringVar(&cfg.Canary, canary, "", fmt.Sprintf("Backend requests are routed to, or away from, by the %v header or the %v cookie, set to %q or %q. Defaults to the last backend", CanaryHeader, CanaryCookie, Always, Never))
+	f.StringVar(&cfg.StickyCookie, stickyCookie, "kds-backend", "Cookie recording the backend clients were routed to, for their next requests to be routed to the same backend, as long as it is healthy and weighted. Sticky sessions are disabled if empty")
+	f.DurationVar(&cfg.BackendTimeout, backendTimeout, 10*time.Second, "The maximum duration to wait for a backend's response headers")
+	f.StringVar(&cfg.HealthPath, healthPath, "/healthz", "Path of backends' health check, which must respond with a 2xx status for backends to be healthy")
+	f.DurationVar(&cfg.HealthInterval, healthInterval, 2*time.Second, "How often backends' health is checked")
+	f.DurationVar(&cfg.HealthTimeout, healthTimeout, 1*time.Second, "The maximum duration of each health check")
+	f.IntVar(&cfg.UnhealthyThreshold, unhealthyThreshold, 3, "Number of consecutive failed health checks after which a backend is ejected, i.e. no longer routed to")
+	f.IntVar(&cfg.HealthyThreshold, healthyThreshold, 2, "Number of consecutive successful health checks after which an ejected backend is routed to again")
+}
+
+// Routing describes the backends to route requests to, and how.
+type Routing struct {
+	Backends           []BackendConfig
+	Canary             string
+	StickyCookie       string
+	BackendTimeout     time.Duration
+	HealthPath         string
+	HealthInterval     time.Duration
+	HealthTimeout      time.Duration
+	UnhealthyThreshold int
+	HealthyThreshold   int
+}
+
+// BackendConfig describes a backend to route requests to.
+type BackendConfig struct {
+	Name   string
+	URL    *url.URL
+	Weight int // Percentage of requests routed to this backend.
+}
+
+// Routing validates this configuration, and returns the corresponding routing.
+func (cfg Config) Routing() (Routing, error) {
+	routing := Routing{
+		StickyCookie:       cfg.StickyCookie,
+		BackendTimeout:     cfg.BackendTimeout,
+		HealthPath:         cfg.HealthPath,
+		HealthInterval:     cfg.HealthInterval,
+		HealthTimeout:      cfg.HealthTimeout,
+		UnhealthyThreshold: cfg.UnhealthyThreshold,
+		HealthyThreshold:   cfg.HealthyThreshold,
+	}
+	if len(cfg.Backends) == 0 {
+		return Routing{}, fmt.Errorf("invalid backends: --%v must be provided at least once", backends)
+	}
+	names := make(map[string]int)
+	for i, spec := range cfg.Backends {
+		kv := strings.SplitN(spec, "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 {
+			return Routing{}, fmt.Errorf("invalid backend: --%v must be <name>=<URL> but got %q", backends, spec)
+		}
+		if _, ok := names[kv[0]]; ok {
+			return Routing{}, fmt.Errorf("invalid backend: --%v %q is provided more than once", backends, kv[0])
+		}
+		u, err := url.Parse(kv[1])
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			return Routing{}, fmt.Errorf("invalid backend: --%v %q must have an HTTP(S) URL but got %q", backends, kv[0], kv[1])
+		}
+		names[kv[0]] = i
+		routing.Backends = append(routing.Backends, BackendConfig{Name: kv[0], URL: u})
+	}
+
+	percentages, err := ParseWeights(cfg.Weights)
+	if err != nil {
+		return Routing{}, fmt.Errorf("invalid weights: --%v %v", weights, err)
+	}
+	if len(percentages) == 0 {
+		percentages = map[string]int{routing.Backends[0].Name: 100}
+	}
+	if err := ValidateWeights(routing.Backends, percentages); err != nil {
+		return Routing{}, fmt.Errorf("invalid weights: --%v %v", weights, err)
+	}
+	for i := range routing.Backends {
+		routing.Backends[i].Weight = percentages[routing.Backends[i].Name]
+	}
+
+	routing.Canary = cfg.Canary
+	if len(routing.Canary) == 0 {
+		routing.Canary = routing.Backends[len(routing.Backends)-1].Name
+	}
+	if _, ok := names[routing.Canary]; !ok {
+		return Routing{}, fmt.Errorf("invalid canary: --%v must be one of the backends but got %q", canary, routing.Canary)
+	}
+
+	if cfg.BackendTimeout <= 0 {
+		return Routing{}, fmt.Errorf("invalid backend timeout: --%v must be positive but got %v", backendTimeout, cfg.BackendTimeout)
+	}
+	if !strings.HasPrefix(cfg.HealthPath, "/") {
+		return Routing{}, fmt.Errorf("invalid health path: --%v must start with / but got %q", healthPath, cfg.HealthPath)
+	}
+	if cfg.HealthInterval <= 0 {
+		return Routing{}, fmt.Errorf("invalid health interval: --%v must be positive but got %v", healthInterval, cfg.HealthInterval)
+	}
+	if cfg.HealthTimeout <= 0 {
+		return Routing{}, fmt.Errorf("invalid health timeout: --%v must be positive but got %v", healthTimeout, cfg.HealthTimeout)
+	}
+	if cfg.UnhealthyThreshold <= 0 {
+		return Routing{}, fmt.Errorf("invalid unhealthy threshold: --%v must be positive but got %v", unhealthyThreshold, cfg.UnhealthyThreshold)
+	}
+	if cfg.HealthyThreshold <= 0 {
+		return Routing{}, fmt.Errorf("invalid healthy threshold: --%v must be positive but got %v", healthyThreshold, cfg.HealthyThreshold)
+	}
+	return routing, nil
+}
+
+// ParseWeights parses the provided weights, e.g. stable=90,canary=10, into percentages by backend.
+func ParseWeights(spec string) (map[string]int, error) {
+	percentages := make(map[string]int)
+	if len(strings.TrimSpace(spec)) == 0 {
+		return percentages, nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("must be <name>=<percentage> but got %q", part)
+		}
+		percentage, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("must have integer percentages but got %q", part)
+		}
+		percentages[strings.TrimSpace(kv[0])] = percentage
+	}
+	return percentages, nil
+}
+
+// ValidateWeights checks that the provided percentages are for known backends, between 0 and 100, and add up to 100.
+func ValidateWeights(backends []BackendConfig, percentages map[string]int) error {
+	known := make(map[string]bool, len(backends))
+	for _, backend := range backends {
+		known[backend.Name] = true
+	}
+	names := make([]string, 0, len(percentages))
+	for name := range percentages {
+		names = append(names, name)
+	}
+	sort.Strings(names) // For errors to be deterministic.
+	total := 0
+	for _, name := range names {
+		percentage := percentages[name]
+		if !known[name] {
+			return fmt.Errorf("must be for known backends but got %q", name)
+		}
+		if percentage < 0 || percentage > 100 {
+			return fmt.Errorf("must be between 0 and 100 but got %v for %q", percentage, name)
+		}
+		total += percentage
+	}
+	if total != 100 {
+		return fmt.Errorf("must add up to 100 but add up to %v", total)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package router_test
+
+import (
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"        // POSIX/GNU-style CLI arguments.
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/router"
+)
+
+func TestParsingEmptyArgumentsShouldRequireBackends(t *testing.T) {
+	config := parseArgs(t, []string{})
+	assert.Equal(t, 8080, config.Port)
+	assert.Equal(t, "kds-backend", config.StickyCookie)
+	assert.Equal(t, 10*time.Second, config.BackendTimeout)
+	assert.Equal(t, "/healthz", config.HealthPath)
+	assert.Equal(t, 2*time.Second, config.HealthInterval)
+	assert.Equal(t, 1*time.Second, config.HealthTimeout)
+	assert.Equal(t, 3, config.UnhealthyThreshold)
+	assert.Equal(t, 2, config.HealthyThreshold)
+
+	_, err := config.Routing()
+	assert.EqualError(t, err, "invalid backends: --backend must be provided at least once")
+}
+
+func TestRoutingShouldDefaultToAllRequestsToFirstBackendAndLastBackendAsCanary(t *testing.T) {
+	config := parseArgs(t, []string{"--backend", "blue=http://kds-blue:8080", "--backend", "green=http://kds-green:8080"})
+	routing, err := config.Routing()
+	assert.NoError(t, err)
+	assert.Len(t, routing.Backends, 2)
+	assert.Equal(t, "blue", routing.Backends[0].Name)
+	assert.Equal(t, "http://kds-blue:8080", routing.Backends[0].URL.String())
+	assert.Equal(t, 100, routing.Backends[0].Weight)
+	assert.Equal(t, "green", routing.Backends[1].Name)
+	assert.Equal(t, 0, routing.Backends[1].Weight)
+	assert.Equal(t, "green", routing.Canary)
+}
+
+func TestRoutingShouldApplyWeightsAndCanary(t *testing.T) {
+	config := parseArgs(t, []string{
+		"--backend", "canary=http://kds-v2:8080",
+		"--backend", "stable=http://kds-v1:8080",
+		"--weights", "stable=90, canary=10",
+		"--canary", "canary",
+		"--sticky-cookie", "",
+	})
+	routing, err := config.Routing()
+	assert.NoError(t, err)
+	assert.Equal(t, 10, routing.Backends[0].Weight)
+	assert.Equal(t, 90, routing.Backends[1].Weight)
+	assert.Equal(t, "canary", routing.Canary)
+	assert.Equal(t, "", routing.StickyCookie)
+}
+
+func TestRoutingShouldRejectInvalidArguments(t *testing.T) {
+	backends := []string{"--backend", "stable=http://kds-v1:8080", "--backend", "canary=http://kds-v2:8080"}
+	for message, args := range map[string][]string{
+		"invalid backend: --backend must be <name>=<URL> but got \"http://kds-v1:8080\"":         {"--backend", "http://kds-v1:8080"},
+		"invalid backend: --backend \"stable\" must have an HTTP(S) URL but got \"kds-v1:8080\"": {"--backend", "stable=kds-v1:8080"},
+		"invalid backend: --backend \"stable\" is provided more than once":                       append(backends, "--backend", "stable=http://kds-v3:8080"),
+		"invalid weights: --weights must add up to 100 but add up to 110":                        append(backends, "--weights", "stable=100,canary=10"),
+		"invalid weights: --weights must be for known backends but got \"v3\"":                   append(backends, "--weights", "stable=100,v3=0"),
+		"invalid weights: --weights must be between 0 and 100 but got -10 for \"canary\"":        append(backends, "--weights", "stable=90,canary=-10"),
+		"invalid weights: --weights must be <name>=<percentage> but got \"stable\"":              append(backends, "--weights", "stable"),
+		"invalid canary: --canary must be one of the backends but got \"v3\"":                    append(backends, "--canary", "v3"),
+		"invalid health path: --health-path must start with / but got \"healthz\"":               append(backends, "--health-path", "healthz"),
+		"invalid unhealthy threshold: --unhealthy-threshold must be positive but got 0":          append(backends, "--unhealthy-threshold", "0"),
+	} {
+		_, err := parseArgs(t, args).Routing()
+		assert.EqualError(t, err, message)
+	}
+}
+
+func parseArgs(t *testing.T, args []string) router.Config {
+	config := router.Config{}
+	cli := flag.NewFlagSet("router-test", flag.ContinueOnError)
+	config.RegisterFlags(cli)
+	err := cli.Parse(args)
+	assert.NoError(t, err)
+	return config
+}
@@ -0,0 +1,86 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus" // Better Logging.
+)
+
+// CheckHealth checks the health of all backends periodically, until the provided context is done.
+// Backends failing consecutive health checks are ejected, i.e. no longer routed to, until they pass consecutive ones.
+func (router *Router) CheckHealth(ctx context.Context) {
+	ticker := time.NewTicker(router.routing.HealthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			router.checkHealth(ctx)
+		}
+	}
+}
+
+func (router *Router) checkHealth(ctx context.Context) {
+	var checks sync.WaitGroup
+	for _, b := range router.backends {
+		checks.Add(1)
+		go func(b *backend) {
+			defer checks.Done()
+			router.recordHealth(b, router.probe(ctx, b))
+		}(b)
+	}
+	checks.Wait()
+}
+
+// probe calls the provided backend's health check, and returns an error if it did not respond with a 2xx status.
+func (router *Router) probe(ctx context.Context, b *backend) error {
+	req, err := http.NewRequest("GET", strings.TrimRight(b.url.String(), "/")+router.routing.HealthPath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := router.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body) // For the connection to be reused.
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unhealthy: %v", resp.Status)
+	}
+	return nil
+}
+
+// recordHealth ejects, or reinstates, the provided backend, once the configured number of consecutive health checks
+// failed, or succeeded.
+func (router *Router) recordHealth(b *backend, err error) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+	logger := log.WithField("backend", b.name).WithField("url", b.url.String())
+	if err == nil {
+		b.failures = 0
+		b.successes++
+		if !b.healthy && b.successes >= router.routing.HealthyThreshold {
+			b.healthy = true
+			router.healthy.Set(1, b.name)
+			logger.Info("backend is healthy again: routing requests to it")
+		}
+		return
+	}
+	b.successes = 0
+	b.failures++
+	logger.WithField("failures", b.failures).WithField("err", err).Debug("failed health check")
+	if b.healthy && b.failures >= router.routing.UnhealthyThreshold {
+		b.healthy = false
+		router.healthy.Set(0, b.name)
+		router.ejections.Inc(b.name)
+		logger.WithField("err", err).Warn("ejected unhealthy backend: no longer routing requests to it")
+	}
+}
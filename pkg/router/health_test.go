@@ -0,0 +1,67 @@
+package router_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/router"
+)
+
+func TestCheckHealthShouldEjectAndReinstateBackends(t *testing.T) {
+	var canaryHealthy int32 = 1
+	stable := newBackend(t, "v1")
+	defer stable.Close()
+	canary := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if atomic.LoadInt32(&canaryHealthy) == 0 {
+			resp.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		resp.Header().Set("X-Served-By", "v2")
+		resp.WriteHeader(http.StatusNoContent)
+	}))
+	defer canary.Close()
+	proxy, r := newRouter(t, "--backend", "stable="+stable.URL, "--backend", "canary="+canary.URL, "--weights", "stable=0,canary=100",
+		"--health-interval", "10ms", "--unhealthy-threshold", "2", "--healthy-threshold", "2")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go proxy.CheckHealth(ctx)
+
+	assert.Equal(t, "v2", serve(r, get(t, "/version")).Header().Get("X-Served-By"))
+
+	// Requests fail over to other healthy backends, regardless of weights, once the canary is ejected:
+	atomic.StoreInt32(&canaryHealthy, 0)
+	assert.True(t, eventually(func() bool { return !proxy.Backends()[1].Healthy }))
+	resp := serve(r, get(t, "/version"))
+	assert.Equal(t, "v1", resp.Header().Get("X-Served-By"))
+	req := get(t, "/version")
+	req.Header.Set(router.CanaryHeader, router.Always)
+	assert.Equal(t, "v1", serve(r, req).Header().Get("X-Served-By"))
+
+	atomic.StoreInt32(&canaryHealthy, 1)
+	assert.True(t, eventually(func() bool { return proxy.Backends()[1].Healthy }))
+	assert.Equal(t, "v2", serve(r, get(t, "/version")).Header().Get("X-Served-By"))
+
+	// Requests are rejected when no backend is healthy:
+	stable.Close()
+	canary.Close()
+	assert.True(t, eventually(func() bool { return !proxy.Backends()[0].Healthy && !proxy.Backends()[1].Healthy }))
+	resp = serve(r, get(t, "/version"))
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Contains(t, resp.Body.String(), "\"error\":\"no healthy backend\"")
+	assert.Equal(t, http.StatusServiceUnavailable, serve(r, get(t, "/router/healthz")).Code)
+}
+
+func eventually(condition func() bool) bool {
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if condition() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,280 @@
+// Package router splits traffic between several versions of the service, e.g. to demonstrate canary and blue/green
+// releases without a service mesh: requests are routed to backends as per percentage weights, which can be shifted at
+// runtime, unless overridden by a header or a cookie, or by a sticky session, and unhealthy backends are ejected.
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	stdlog "log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/metrics"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/server"
+)
+
+// Headers and cookies overriding how requests are routed.
+const (
+	// CanaryHeader routes requests to the canary backend if set to "always", or away from it if set to "never".
+	CanaryHeader = "X-Canary"
+	// CanaryCookie routes requests like CanaryHeader, e.g. for browsers. The header takes precedence over the cookie.
+	CanaryCookie = "kds-canary"
+	// Always routes requests to the canary backend, as long as it is healthy.
+	Always = "always"
+	// Never routes requests away from the canary backend.
+	Never = "never"
+	// BackendHeader reports the backend requests were routed to, in responses.
+	BackendHeader = "X-Routed-To"
+)
+
+// Reasons requests were routed to a backend, as reported by metrics.
+const (
+	viaHeader   = "header"
+	viaCookie   = "cookie"
+	viaSticky   = "sticky"
+	viaWeights  = "weighted"
+	viaFailover = "failover" // No weighted backend is healthy.
+)
+
+// Router routes requests to backends.
+type Router struct {
+	routing  Routing
+	backends []*backend
+	canary   *backend
+	client   *http.Client // For health checks.
+	registry *metrics.Registry
+	mutex    sync.RWMutex // For thread-safe access to backends' weight and health.
+
+	requests  *metrics.Counter
+	decisions *metrics.Counter
+	ejections *metrics.Counter
+	weights   *metrics.Gauge
+	healthy   *metrics.Gauge
+}
+
+type backend struct {
+	name      string
+	url       *url.URL
+	weight    int
+	healthy   bool
+	successes int // Consecutive successful health checks.
+	failures  int // Consecutive failed health checks.
+	proxy     *httputil.ReverseProxy
+}
+
+// New creates a router as per the provided routing, registering its metrics to the provided registry.
+// Backends are deemed healthy until health checks fail.
+func New(routing Routing, registry *metrics.Registry) *Router {
+	router := &Router{
+		routing:   routing,
+		client:    &http.Client{Timeout: routing.HealthTimeout},
+		registry:  registry,
+		requests:  registry.Counter("router_requests_total", "Number of requests proxied, by backend and status code, or \"error\" if the backend did not respond.", "backend", "code"),
+		decisions: registry.Counter("router_routing_decisions_total", "Number of requests routed, by backend and reason: weighted, sticky, header, cookie, or failover.", "backend", "reason"),
+		ejections: registry.Counter("router_backend_ejections_total", "Number of times backends were ejected for failing health checks.", "backend"),
+		weights:   registry.Gauge("router_backend_weight", "Percentage of requests routed to each backend.", "backend"),
+		healthy:   registry.Gauge("router_backend_healthy", "Whether each backend is healthy (1) or ejected (0).", "backend"),
+	}
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConnsPerHost:   100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: routing.BackendTimeout,
+	}
+	for _, config := range routing.Backends {
+		b := &backend{name: config.Name, url: config.URL, weight: config.Weight, healthy: true}
+		b.proxy = httputil.NewSingleHostReverseProxy(config.URL)
+		b.proxy.Transport = &countingTransport{backend: b.name, requests: router.requests, next: transport}
+		b.proxy.FlushInterval = 100 * time.Millisecond       // For streams, e.g. /users/watch, to reach clients as they go.
+		b.proxy.ErrorLog = stdlog.New(ioutil.Discard, "", 0) // Errors are logged by countingTransport.
+		router.backends = append(router.backends, b)
+		if b.name == routing.Canary {
+			router.canary = b
+		}
+		router.weights.Set(float64(b.weight), b.name)
+		router.healthy.Set(1, b.name)
+	}
+	return router
+}
+
+// ServeHTTP routes the provided request to a backend, or responds with 503 Service Unavailable if no backend is healthy.
+func (router *Router) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	b, reason := router.route(req)
+	if b == nil {
+		logger.Warn("no healthy backend to route request to")
+		writeError(resp, "no healthy backend", http.StatusServiceUnavailable)
+		return
+	}
+	router.decisions.Inc(b.name, reason)
+	if len(router.routing.StickyCookie) > 0 && (reason == viaWeights || reason == viaFailover) {
+		http.SetCookie(resp, &http.Cookie{Name: router.routing.StickyCookie, Value: b.name, Path: "/", HttpOnly: true})
+	}
+	resp.Header().Set(BackendHeader, b.name)
+	// Let the backend log, and echo, the request ID set by server.LogRequests, for logs to be correlated:
+	if requestID := resp.Header().Get(server.RequestIDHeader); len(requestID) > 0 {
+		req.Header.Set(server.RequestIDHeader, requestID)
+		resp.Header().Del(server.RequestIDHeader)
+	}
+	b.proxy.ServeHTTP(resp, req)
+}
+
+// route picks the backend to route the provided request to, and returns why, or nil if no backend is healthy.
+func (router *Router) route(req *http.Request) (*backend, string) {
+	override, reason := req.Header.Get(CanaryHeader), viaHeader
+	if len(override) == 0 {
+		if cookie, err := req.Cookie(CanaryCookie); err == nil {
+			override, reason = cookie.Value, viaCookie
+		}
+	}
+
+	router.mutex.RLock()
+	defer router.mutex.RUnlock()
+	var excluded *backend
+	switch strings.ToLower(override) {
+	case Always:
+		if router.canary.healthy {
+			return router.canary, reason
+		}
+	case Never:
+		excluded = router.canary
+	}
+	if len(router.routing.StickyCookie) > 0 {
+		if cookie, err := req.Cookie(router.routing.StickyCookie); err == nil {
+			for _, b := range router.backends {
+				if b.name == cookie.Value && b != excluded && b.healthy && b.weight > 0 {
+					return b, viaSticky
+				}
+			}
+		}
+	}
+	if b := router.pick(excluded, true); b != nil {
+		return b, viaWeights
+	}
+	if b := router.pick(excluded, false); b != nil {
+		return b, viaFailover
+	}
+	return nil, ""
+}
+
+// pick picks a healthy backend at random, as per backends' weights if weighted, or uniformly otherwise.
+func (router *Router) pick(excluded *backend, weighted bool) *backend {
+	weight := func(b *backend) int {
+		switch {
+		case b == excluded || !b.healthy:
+			return 0
+		case weighted:
+			return b.weight
+		default:
+			return 1
+		}
+	}
+	total := 0
+	for _, b := range router.backends {
+		total += weight(b)
+	}
+	if total == 0 {
+		return nil
+	}
+	n := rand.Intn(total)
+	for _, b := range router.backends {
+		if n < weight(b) {
+			return b
+		}
+		n -= weight(b)
+	}
+	return nil
+}
+
+// BackendStatus describes a backend, and how requests are currently routed to it.
+type BackendStatus struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	Weight  int    `json:"weight"`
+	Healthy bool   `json:"healthy"`
+	Canary  bool   `json:"canary"`
+}
+
+// Backends returns the status of all backends, in the order they were configured in.
+func (router *Router) Backends() []BackendStatus {
+	router.mutex.RLock()
+	defer router.mutex.RUnlock()
+	statuses := make([]BackendStatus, 0, len(router.backends))
+	for _, b := range router.backends {
+		statuses = append(statuses, BackendStatus{
+			Name:    b.name,
+			URL:     b.url.String(),
+			Weight:  b.weight,
+			Healthy: b.healthy,
+			Canary:  b == router.canary,
+		})
+	}
+	return statuses
+}
+
+// SetWeights updates the percentage of requests routed to the provided backends. Backends not provided keep their
+// current weight, and all weights must still add up to 100.
+func (router *Router) SetWeights(percentages map[string]int) error {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+	updated := make(map[string]int, len(router.backends))
+	for _, b := range router.backends {
+		updated[b.name] = b.weight
+	}
+	for name, percentage := range percentages {
+		if _, ok := updated[name]; !ok {
+			return fmt.Errorf("must be for known backends but got %q", name)
+		}
+		updated[name] = percentage
+	}
+	if err := ValidateWeights(router.routing.Backends, updated); err != nil {
+		return err
+	}
+	for _, b := range router.backends {
+		b.weight = updated[b.name]
+		router.weights.Set(float64(b.weight), b.name)
+	}
+	return nil
+}
+
+// countingTransport counts requests proxied to a backend, by status code, and logs these which failed.
+type countingTransport struct {
+	backend  string
+	requests *metrics.Counter
+	next     http.RoundTripper
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.requests.Inc(t.backend, "error")
+		logging.FromContext(req.Context()).WithField("backend", t.backend).WithField("err", err).Warn("failed to proxy request")
+		return nil, err
+	}
+	t.requests.Inc(t.backend, strconv.Itoa(resp.StatusCode))
+	return resp, nil
+}
+
+// writeError responds with the provided status and message, along with the request's ID, like the service does.
+func writeError(resp http.ResponseWriter, message string, status int) {
+	bytes, _ := json.Marshal(server.Error{Error: message, RequestID: resp.Header().Get(server.RequestIDHeader)}) // Cannot fail.
+	resp.Header().Set("Content-Type", "application/json")
+	resp.Header().Set("X-Content-Type-Options", "nosniff")
+	resp.WriteHeader(status)
+	resp.Write(bytes)
+}
@@ -0,0 +1,146 @@
+package router_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"             // Better HTTP API.
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/metrics"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/router"
+)
+
+func TestRouterShouldSplitRequestsAsPerWeights(t *testing.T) {
+	stable, canary := newBackend(t, "v1"), newBackend(t, "v2")
+	defer stable.Close()
+	defer canary.Close()
+	_, r := newRouter(t, "--backend", "stable="+stable.URL, "--backend", "canary="+canary.URL, "--weights", "stable=75,canary=25", "--sticky-cookie", "")
+
+	served := map[string]int{}
+	for i := 0; i < 400; i++ {
+		resp := serve(r, get(t, "/version"))
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, resp.Header().Get("X-Served-By"), map[string]string{"stable": "v1", "canary": "v2"}[resp.Header().Get(router.BackendHeader)])
+		served[resp.Header().Get("X-Served-By")]++
+	}
+	assert.InDelta(t, 300, served["v1"], 50)
+	assert.InDelta(t, 100, served["v2"], 50)
+}
+
+func TestRouterShouldRouteToOrAwayFromCanaryAsPerHeaderOrCookie(t *testing.T) {
+	stable, canary := newBackend(t, "v1"), newBackend(t, "v2")
+	defer stable.Close()
+	defer canary.Close()
+	_, r := newRouter(t, "--backend", "stable="+stable.URL, "--backend", "canary="+canary.URL, "--weights", "stable=50,canary=50")
+
+	for i := 0; i < 20; i++ {
+		req := get(t, "/version")
+		req.Header.Set(router.CanaryHeader, "always")
+		assert.Equal(t, "v2", serve(r, req).Header().Get("X-Served-By"))
+
+		req = get(t, "/version")
+		req.AddCookie(&http.Cookie{Name: router.CanaryCookie, Value: "never"})
+		assert.Equal(t, "v1", serve(r, req).Header().Get("X-Served-By"))
+
+		req = get(t, "/version")
+		req.Header.Set(router.CanaryHeader, "Never")
+		req.AddCookie(&http.Cookie{Name: router.CanaryCookie, Value: "always"}) // The header takes precedence.
+		assert.Equal(t, "v1", serve(r, req).Header().Get("X-Served-By"))
+	}
+}
+
+func TestRouterShouldKeepClientsOnTheSameBackendWithStickyCookie(t *testing.T) {
+	stable, canary := newBackend(t, "v1"), newBackend(t, "v2")
+	defer stable.Close()
+	defer canary.Close()
+	proxy, r := newRouter(t, "--backend", "stable="+stable.URL, "--backend", "canary="+canary.URL, "--weights", "stable=50,canary=50")
+
+	resp := serve(r, get(t, "/version"))
+	cookies := resp.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	assert.Equal(t, "kds-backend", cookies[0].Name)
+	backend := resp.Header().Get(router.BackendHeader)
+	assert.Equal(t, backend, cookies[0].Value)
+	for i := 0; i < 20; i++ {
+		req := get(t, "/version")
+		req.AddCookie(cookies[0])
+		resp := serve(r, req)
+		assert.Equal(t, backend, resp.Header().Get(router.BackendHeader))
+		assert.Empty(t, resp.Result().Cookies()) // Already sticky.
+	}
+
+	// Clients no longer stick to backends no requests are routed to anymore, e.g. after a rollback:
+	other := map[string]string{"stable": "canary", "canary": "stable"}[backend]
+	assert.NoError(t, proxy.SetWeights(map[string]int{backend: 0, other: 100}))
+	req := get(t, "/version")
+	req.AddCookie(cookies[0])
+	resp = serve(r, req)
+	assert.Equal(t, other, resp.Header().Get(router.BackendHeader))
+	assert.Equal(t, other, resp.Result().Cookies()[0].Value)
+}
+
+func TestSetWeightsShouldValidateWeights(t *testing.T) {
+	proxy, _ := newRouter(t, "--backend", "stable=http://kds-v1:8080", "--backend", "canary=http://kds-v2:8080")
+	assert.EqualError(t, proxy.SetWeights(map[string]int{"canary": 10}), "must add up to 100 but add up to 110")
+	assert.EqualError(t, proxy.SetWeights(map[string]int{"v3": 0}), "must be for known backends but got \"v3\"")
+	assert.NoError(t, proxy.SetWeights(map[string]int{"stable": 90, "canary": 10}))
+	assert.Equal(t, []router.BackendStatus{
+		{Name: "stable", URL: "http://kds-v1:8080", Weight: 90, Healthy: true, Canary: false},
+		{Name: "canary", URL: "http://kds-v2:8080", Weight: 10, Healthy: true, Canary: true},
+	}, proxy.Backends())
+}
+
+func TestRouterShouldForwardRequestIDAndReportUnreachableBackends(t *testing.T) {
+	stable := newBackend(t, "v1")
+	defer stable.Close()
+	_, r := newRouter(t, "--backend", "stable="+stable.URL)
+
+	req := get(t, "/version")
+	req.Header.Set("X-Request-ID", "42")
+	resp := serve(r, req)
+	assert.Equal(t, []string{"42"}, resp.Header()["X-Request-Id"]) // Echoed once, by the backend.
+	assert.Equal(t, "42", resp.Header().Get("X-Echoed-Request-ID"))
+
+	stable.Close()
+	resp = serve(r, get(t, "/version"))
+	assert.Equal(t, http.StatusBadGateway, resp.Code)
+}
+
+// newBackend creates a backend reporting the provided version, like the service does.
+func newBackend(t *testing.T, version string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("X-Served-By", version)
+		if requestID := req.Header.Get("X-Request-ID"); len(requestID) > 0 {
+			resp.Header().Set("X-Request-ID", requestID)
+			resp.Header().Set("X-Echoed-Request-ID", requestID)
+		}
+		if req.URL.Path == "/healthz" {
+			resp.WriteHeader(http.StatusNoContent)
+			return
+		}
+		resp.Write([]byte("{\"version\":\"" + version + "\"}"))
+	}))
+}
+
+func newRouter(t *testing.T, args ...string) (*router.Router, *mux.Router) {
+	routing, err := parseArgs(t, args).Routing()
+	assert.NoError(t, err)
+	proxy := router.New(routing, metrics.NewRegistry())
+	r := mux.NewRouter()
+	proxy.RegisterRoutes(r, token)
+	return proxy, r
+}
+
+func get(t *testing.T, uri string) *http.Request {
+	req, err := http.NewRequest("GET", uri, nil)
+	assert.NoError(t, err)
+	return req
+}
+
+func serve(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	return resp
+}
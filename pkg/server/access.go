@@ -0,0 +1,111 @@
+package server
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/mux"         // Better HTTP API.
+	log "github.com/sirupsen/logrus" // Better Logging.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/version"
+)
+
+// RequestIDHeader identifies requests, so that logs about them can be correlated, across services too.
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID matches the request IDs accepted from clients, to avoid forging log lines or bloating these.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// LogRequests identifies each request by the ID provided by the client in the X-Request-ID header, or by a new one,
+// echoes this ID in the response, makes a logger with this ID available via logging.FromContext, and logs one line
+// per request, once served.
+func LogRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		requestID := req.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		resp.Header().Set(RequestIDHeader, requestID)
+		logger := log.WithField("requestId", requestID).WithField("method", req.Method).WithField("path", req.URL.Path)
+		logged := &loggedResponse{ResponseWriter: resp}
+		defer func() {
+			if current := mux.CurrentRoute(req); current != nil {
+				logger = logger.WithField("route", current.GetName())
+			}
+			logger = logger.
+				WithField("status", logged.Status()).
+				WithField("bytes", logged.bytes).
+				WithField("durationMs", float64(time.Since(start))/float64(time.Millisecond)).
+				WithField("remoteAddr", req.RemoteAddr).
+				WithField("version", version.Version)
+			if err := recover(); err != nil {
+				logger.WithField("err", err).Warn("aborted request")
+				panic(err)
+			}
+			logger.Info("served request")
+		}()
+		next.ServeHTTP(logged, req.WithContext(logging.NewContext(req.Context(), logger)))
+	})
+}
+
+func newRequestID() string {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano()) // Unique enough, should the system's randomness be unavailable.
+	}
+	return hex.EncodeToString(bytes)
+}
+
+// loggedResponse records the status and size of a response, for it to be logged.
+// It also is a http.Flusher and a http.Hijacker, if the response it wraps is, for streams and injected faults to work.
+type loggedResponse struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+// Status returns the status of the response, which defaults to 200 OK, as per http.ResponseWriter.
+func (r *loggedResponse) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+func (r *loggedResponse) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *loggedResponse) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+func (r *loggedResponse) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *loggedResponse) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not support hijacking", r.ResponseWriter)
+	}
+	return hijacker.Hijack()
+}
@@ -0,0 +1,85 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"             // Better HTTP API.
+	log "github.com/sirupsen/logrus"     // Better Logging.
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/server"
+)
+
+// recorder is a logrus hook recording all log entries.
+type recorder struct {
+	entries []*log.Entry
+}
+
+func (r *recorder) Levels() []log.Level         { return log.AllLevels }
+func (r *recorder) Fire(entry *log.Entry) error { r.entries = append(r.entries, entry); return nil }
+
+func recordLogs() (*recorder, func()) {
+	hooks := log.StandardLogger().Hooks
+	recorder := &recorder{}
+	log.StandardLogger().Hooks = make(log.LevelHooks)
+	log.AddHook(recorder)
+	return recorder, func() { log.StandardLogger().Hooks = hooks }
+}
+
+func loggedRouter() *mux.Router {
+	router := mux.NewRouter()
+	router.Use(server.LogRequests)
+	router.HandleFunc("/teapot", func(resp http.ResponseWriter, req *http.Request) {
+		logging.FromContext(req.Context()).Info("brewing")
+		resp.WriteHeader(http.StatusTeapot)
+		resp.Write([]byte("short and stout"))
+	}).Name("teapot")
+	return router
+}
+
+func TestLogRequestsShouldEchoValidRequestIDs(t *testing.T) {
+	req := httptest.NewRequest("GET", "/teapot", nil)
+	req.Header.Set(server.RequestIDHeader, "abc-123")
+	resp := httptest.NewRecorder()
+	loggedRouter().ServeHTTP(resp, req)
+	assert.Equal(t, "abc-123", resp.Header().Get(server.RequestIDHeader))
+}
+
+func TestLogRequestsShouldGenerateRequestIDsWhenMissingOrInvalid(t *testing.T) {
+	for _, requestID := range []string{"", "forged\nlog line", string(make([]byte, 129))} {
+		req := httptest.NewRequest("GET", "/teapot", nil)
+		req.Header.Set(server.RequestIDHeader, requestID)
+		resp := httptest.NewRecorder()
+		loggedRouter().ServeHTTP(resp, req)
+		assert.Regexp(t, "^[0-9a-f]{32}$", resp.Header().Get(server.RequestIDHeader))
+	}
+}
+
+func TestLogRequestsShouldLogOneLinePerRequestAndCorrelateHandlersLogs(t *testing.T) {
+	recorder, restore := recordLogs()
+	defer restore()
+
+	req := httptest.NewRequest("GET", "/teapot", nil)
+	req.Header.Set(server.RequestIDHeader, "abc-123")
+	req.RemoteAddr = "10.0.0.1:1337"
+	resp := httptest.NewRecorder()
+	loggedRouter().ServeHTTP(resp, req)
+
+	assert.Equal(t, 2, len(recorder.entries))
+	handlerLog, accessLog := recorder.entries[0], recorder.entries[1]
+	assert.Equal(t, "brewing", handlerLog.Message)
+	assert.Equal(t, "abc-123", handlerLog.Data["requestId"])
+	assert.Equal(t, "served request", accessLog.Message)
+	assert.Equal(t, "abc-123", accessLog.Data["requestId"])
+	assert.Equal(t, "GET", accessLog.Data["method"])
+	assert.Equal(t, "/teapot", accessLog.Data["path"])
+	assert.Equal(t, "teapot", accessLog.Data["route"])
+	assert.Equal(t, http.StatusTeapot, accessLog.Data["status"])
+	assert.Equal(t, len("short and stout"), accessLog.Data["bytes"])
+	assert.Equal(t, "10.0.0.1:1337", accessLog.Data["remoteAddr"])
+	assert.Equal(t, "unknown", accessLog.Data["version"])
+	assert.Contains(t, accessLog.Data, "durationMs")
+}
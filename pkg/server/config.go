@@ -1,6 +1,8 @@
 package server
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	flag "github.com/spf13/pflag" // POSIX/GNU-style CLI arguments.
@@ -12,6 +14,27 @@ type Config struct {
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
+	Faults       []string
+	FaultProfile string
+
+	RateLimit         string
+	RouteRateLimits   []string
+	MaxInFlight       int
+	RetryAfter        time.Duration
+	TrustForwardedFor bool
+
+	TLSCertFile       string
+	TLSKeyFile        string
+	TLSClientCAFile   string
+	TLSMinVersion     string
+	TLSReloadInterval time.Duration
+	PlaintextPort     int
+	AdminPort         int
+
+	V1DeprecationDate string
+	V1SunsetDate      string
+
+	StatsCacheTTL time.Duration
 }
 
 const (
@@ -19,6 +42,27 @@ const (
 	readTimeout  = "http-read-timeout"
 	writeTimeout = "http-write-timeout"
 	idleTimeout  = "http-idle-timeout"
+	httpFault    = "http-fault"
+	faultProfile = "http-fault-profile"
+
+	rateLimit         = "http-rate-limit"
+	routeRateLimit    = "http-route-rate-limit"
+	maxInFlight       = "http-max-in-flight"
+	retryAfter        = "http-retry-after"
+	trustForwardedFor = "http-trust-forwarded-for"
+
+	tlsCertFile       = "tls-cert-file"
+	tlsKeyFile        = "tls-key-file"
+	tlsClientCAFile   = "tls-client-ca-file"
+	tlsMinVersion     = "tls-min-version"
+	tlsReloadInterval = "tls-reload-interval"
+	plaintextPort     = "http-plaintext-port"
+	adminPort         = "admin-port"
+
+	v1DeprecationDate = "api-v1-deprecation-date"
+	v1SunsetDate      = "api-v1-sunset-date"
+
+	statsCacheTTL = "http-stats-cache-ttl"
 )
 
 // RegisterFlags maps the provided CLI arguments to fields in this configuration object.
@@ -27,4 +71,135 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.DurationVar(&cfg.ReadTimeout, readTimeout, 15*time.Second, "The maximum duration for reading the entire request, including the body.")
 	f.DurationVar(&cfg.WriteTimeout, writeTimeout, 15*time.Second, "The maximum duration before timing out writes of the response.")
 	f.DurationVar(&cfg.IdleTimeout, idleTimeout, 60*time.Second, "The maximum amount of time to wait for the next request when keep-alives are enabled.")
+	f.StringArrayVar(&cfg.Faults, httpFault, nil, fmt.Sprintf("Fault injected in HTTP responses, e.g. route=users,status=503,percentage=10,header=X-Canary:always. Keys: route (name, or %q), header, percentage, status, latency, truncate, drop. Repeatable", AllRoutes))
+	f.StringVar(&cfg.FaultProfile, faultProfile, "", "Name of the HTTP faults profile, e.g. bad-release, reported by /version and /healthz")
+	f.StringVar(&cfg.RateLimit, rateLimit, "0", fmt.Sprintf("Requests per second allowed for each client, identified by its valid %v header, when authentication is enabled, or IP, as <rate> or <rate>:<burst>, e.g. 10:20. 0 disables rate limiting", APIKeyHeader))
+	f.StringArrayVar(&cfg.RouteRateLimits, routeRateLimit, nil, fmt.Sprintf("Requests per second allowed for each client on a route, as <route>=<rate>[:<burst>], e.g. users=1:5, overriding --%v. Repeatable", rateLimit))
+	f.IntVar(&cfg.MaxInFlight, maxInFlight, 0, "Maximum number of requests served concurrently, beyond which requests are rejected with 503 Service Unavailable. 0 means unlimited")
+	f.DurationVar(&cfg.RetryAfter, retryAfter, 1*time.Second, "Delay suggested to clients, via Retry-After, when requests are rejected because too many are in flight")
+	f.BoolVar(&cfg.TrustForwardedFor, trustForwardedFor, false, "Identify clients by X-Forwarded-For, e.g. when behind a reverse proxy")
+	f.StringVar(&cfg.TLSCertFile, tlsCertFile, "", "PEM-encoded certificate to serve HTTPS with, on --http-port. Reloaded when changed. HTTPS is disabled if empty")
+	f.StringVar(&cfg.TLSKeyFile, tlsKeyFile, "", "PEM-encoded private key of --tls-cert-file. Reloaded when changed")
+	f.StringVar(&cfg.TLSClientCAFile, tlsClientCAFile, "", "PEM-encoded CA certificates clients' certificates must be signed by, for mutual TLS. Reloaded when changed. Clients are not required to present certificates if empty")
+	f.StringVar(&cfg.TLSMinVersion, tlsMinVersion, "1.2", "Minimum TLS version accepted: 1.0, 1.1, 1.2 or 1.3")
+	f.DurationVar(&cfg.TLSReloadInterval, tlsReloadInterval, 10*time.Second, "How often TLS files are checked for changes")
+	f.IntVar(&cfg.PlaintextPort, plaintextPort, 0, "Port to serve health checks on, over plain HTTP, e.g. for Kubernetes probes when serving HTTPS. Disabled if 0")
+	f.IntVar(&cfg.AdminPort, adminPort, 0, "Port to serve admin endpoints on, over plain HTTP, e.g. to profile the service via kubectl port-forward without exposing these. Served on --http-port if 0")
+	f.StringVar(&cfg.V1DeprecationDate, v1DeprecationDate, "", "Date since which v1 of the API is deprecated, as YYYY-MM-DD or RFC 3339, advertised in v1 responses' Deprecation header. Not deprecated if empty")
+	f.StringVar(&cfg.V1SunsetDate, v1SunsetDate, "", "Date v1 of the API will stop being served, as YYYY-MM-DD or RFC 3339, advertised in v1 responses' Sunset header. Not advertised if empty")
+	f.DurationVar(&cfg.StatsCacheTTL, statsCacheTTL, 0, "Duration statistics served by /users/stats are cached for, e.g. 5s for dashboards polling every second. 0 disables caching")
+}
+
+// TLSEnabled returns whether HTTPS is enabled.
+func (cfg Config) TLSEnabled() bool {
+	return len(cfg.TLSCertFile) > 0 || len(cfg.TLSKeyFile) > 0
+}
+
+// CertReloader loads the configured TLS files, or returns nil if HTTPS is disabled.
+func (cfg Config) CertReloader() (*CertReloader, error) {
+	if !cfg.TLSEnabled() {
+		if len(cfg.TLSClientCAFile) > 0 {
+			return nil, fmt.Errorf("invalid --%v: requires --%v and --%v", tlsClientCAFile, tlsCertFile, tlsKeyFile)
+		}
+		return nil, nil
+	}
+	if len(cfg.TLSCertFile) == 0 || len(cfg.TLSKeyFile) == 0 {
+		return nil, fmt.Errorf("invalid TLS configuration: both --%v and --%v are required", tlsCertFile, tlsKeyFile)
+	}
+	minVersion, ok := tlsVersions[cfg.TLSMinVersion]
+	if !ok {
+		return nil, fmt.Errorf("invalid --%v: expected 1.0, 1.1, 1.2 or 1.3 but got %q", tlsMinVersion, cfg.TLSMinVersion)
+	}
+	if cfg.TLSReloadInterval <= 0 {
+		return nil, fmt.Errorf("invalid --%v: expected a positive duration but got %v", tlsReloadInterval, cfg.TLSReloadInterval)
+	}
+	return NewCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile, minVersion)
+}
+
+// Limits returns the rate and concurrency limits configured.
+func (cfg Config) Limits() (Limits, error) {
+	perClient, err := ParseLimit(cfg.RateLimit)
+	if err != nil {
+		return Limits{}, fmt.Errorf("invalid --%v: %v", rateLimit, err)
+	}
+	limits := Limits{
+		PerClient:         perClient,
+		PerRoute:          make(map[string]Limit),
+		MaxInFlight:       cfg.MaxInFlight,
+		RetryAfter:        cfg.RetryAfter,
+		TrustForwardedFor: cfg.TrustForwardedFor,
+	}
+	for _, spec := range cfg.RouteRateLimits {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 {
+			return Limits{}, fmt.Errorf("invalid --%v: expected <route>=<rate>[:<burst>] but got %q", routeRateLimit, spec)
+		}
+		limit, err := ParseLimit(parts[1])
+		if err != nil {
+			return Limits{}, fmt.Errorf("invalid --%v: %v", routeRateLimit, err)
+		}
+		limits.PerRoute[parts[0]] = limit
+	}
+	if cfg.MaxInFlight < 0 {
+		return Limits{}, fmt.Errorf("invalid --%v: expected a positive number but got %v", maxInFlight, cfg.MaxInFlight)
+	}
+	return limits, nil
+}
+
+// Profile returns the HTTP faults profile configured.
+func (cfg Config) Profile() (FaultProfile, error) {
+	profile := FaultProfile{Name: cfg.FaultProfile, Faults: []HTTPFault{}}
+	for _, spec := range cfg.Faults {
+		fault, err := ParseHTTPFault(spec)
+		if err != nil {
+			return profile, fmt.Errorf("invalid --%v: %v", httpFault, err)
+		}
+		profile.Faults = append(profile.Faults, fault)
+	}
+	if err := profile.Validate(); err != nil {
+		return profile, fmt.Errorf("invalid --%v: %v", httpFault, err)
+	}
+	return profile, nil
+}
+
+// StatsCache returns the cache of statistics configured, or nil if caching is disabled.
+func (cfg Config) StatsCache() (*StatsCache, error) {
+	if cfg.StatsCacheTTL == 0 {
+		return nil, nil
+	}
+	if cfg.StatsCacheTTL < 0 {
+		return nil, fmt.Errorf("invalid --%v: expected a positive duration but got %v", statsCacheTTL, cfg.StatsCacheTTL)
+	}
+	return NewStatsCache(cfg.StatsCacheTTL)
+}
+
+// V1Deprecation returns the schedule of v1's retirement configured.
+func (cfg Config) V1Deprecation() (Deprecation, error) {
+	date, err := parseDate(cfg.V1DeprecationDate)
+	if err != nil {
+		return Deprecation{}, fmt.Errorf("invalid --%v: %v", v1DeprecationDate, err)
+	}
+	sunset, err := parseDate(cfg.V1SunsetDate)
+	if err != nil {
+		return Deprecation{}, fmt.Errorf("invalid --%v: %v", v1SunsetDate, err)
+	}
+	if !date.IsZero() && !sunset.IsZero() && sunset.Before(date) {
+		return Deprecation{}, fmt.Errorf("invalid --%v: expected a date after --%v (%v) but got %v", v1SunsetDate, v1DeprecationDate, cfg.V1DeprecationDate, cfg.V1SunsetDate)
+	}
+	return Deprecation{Date: date, Sunset: sunset}, nil
+}
+
+// parseDate parses the provided date, as YYYY-MM-DD, i.e. midnight UTC, or RFC 3339, or returns the zero time if empty.
+func parseDate(date string) (time.Time, error) {
+	if len(date) == 0 {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", date); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected YYYY-MM-DD or RFC 3339, e.g. 2006-01-02T15:04:05Z, but got %q", date)
+	}
+	return t, nil
 }
@@ -17,6 +17,9 @@ func TestParsingEmptyArgumentsShouldReturnDefaultConfig(t *testing.T) {
 	assert.Equal(t, 15*time.Second, config.ReadTimeout)
 	assert.Equal(t, 15*time.Second, config.WriteTimeout)
 	assert.Equal(t, 60*time.Second, config.IdleTimeout)
+	profile, err := config.Profile()
+	assert.NoError(t, err)
+	assert.False(t, profile.Active())
 }
 
 func TestParsingArgumentsShouldOverrideDefaultConfig(t *testing.T) {
@@ -25,12 +28,99 @@ func TestParsingArgumentsShouldOverrideDefaultConfig(t *testing.T) {
 		"--http-read-timeout", "10s",
 		"--http-write-timeout", "20s",
 		"--http-idle-timeout", "30s",
+		"--admin-port", "9090",
 	})
 	assert.NotNil(t, config)
 	assert.Equal(t, 1337, config.Port)
 	assert.Equal(t, 10*time.Second, config.ReadTimeout)
 	assert.Equal(t, 20*time.Second, config.WriteTimeout)
 	assert.Equal(t, 30*time.Second, config.IdleTimeout)
+	assert.Equal(t, 9090, config.AdminPort)
+}
+
+func TestParsingLimitsArgumentsShouldReturnLimits(t *testing.T) {
+	limits, err := parseArgs(t, []string{}).Limits()
+	assert.NoError(t, err)
+	assert.False(t, limits.PerClient.Enabled())
+	assert.Equal(t, 0, limits.MaxInFlight)
+	assert.Equal(t, 1*time.Second, limits.RetryAfter)
+
+	limits, err = parseArgs(t, []string{
+		"--http-rate-limit", "10:20",
+		"--http-route-rate-limit", "users=1:5",
+		"--http-max-in-flight", "100",
+		"--http-retry-after", "5s",
+		"--http-trust-forwarded-for",
+	}).Limits()
+	assert.NoError(t, err)
+	assert.Equal(t, server.Limits{
+		PerClient:         server.Limit{Rate: 10, Burst: 20},
+		PerRoute:          map[string]server.Limit{"users": {Rate: 1, Burst: 5}},
+		MaxInFlight:       100,
+		RetryAfter:        5 * time.Second,
+		TrustForwardedFor: true,
+	}, limits)
+
+	_, err = parseArgs(t, []string{"--http-route-rate-limit", "users"}).Limits()
+	assert.EqualError(t, err, "invalid --http-route-rate-limit: expected <route>=<rate>[:<burst>] but got \"users\"")
+}
+
+func TestParsingHTTPFaultsShouldReturnProfile(t *testing.T) {
+	config := parseArgs(t, []string{
+		"--http-fault", "route=users,status=503,percentage=10,header=X-Canary:always",
+		"--http-fault", "route=*,latency=fixed:100ms,truncate=true",
+		"--http-fault-profile", "bad-release",
+	})
+	profile, err := config.Profile()
+	assert.NoError(t, err)
+	assert.Equal(t, "bad-release", profile.Name)
+	assert.Equal(t, 2, len(profile.Faults))
+	assert.Equal(t, server.HTTPFault{Route: "users", Header: "X-Canary:always", Percentage: 10, Status: 503}, profile.Faults[0])
+	assert.Equal(t, "*", profile.Faults[1].Route)
+	assert.Equal(t, 100*time.Millisecond, profile.Faults[1].Latency.Sample())
+	assert.True(t, profile.Faults[1].Truncate)
+	assert.Equal(t, float64(100), profile.Faults[1].Percentage)
+}
+
+func TestParsingInvalidHTTPFaultsShouldReturnError(t *testing.T) {
+	for _, spec := range []string{"route=users,status", "route=users,unknown=1", "route=users,percentage=101", "status=503", "route=users,status=42"} {
+		config := parseArgs(t, []string{"--http-fault", spec})
+		_, err := config.Profile()
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestParsingV1DeprecationArgumentsShouldReturnDeprecation(t *testing.T) {
+	deprecation, err := parseArgs(t, []string{}).V1Deprecation()
+	assert.NoError(t, err)
+	assert.False(t, deprecation.Active())
+
+	deprecation, err = parseArgs(t, []string{
+		"--api-v1-deprecation-date", "2026-01-01",
+		"--api-v1-sunset-date", "2026-06-30T12:00:00+02:00",
+	}).V1Deprecation()
+	assert.NoError(t, err)
+	assert.True(t, deprecation.Active())
+	assert.Equal(t, time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC), deprecation.Date)
+	assert.True(t, time.Date(2026, time.June, 30, 10, 0, 0, 0, time.UTC).Equal(deprecation.Sunset))
+
+	_, err = parseArgs(t, []string{"--api-v1-deprecation-date", "01/01/2026"}).V1Deprecation()
+	assert.EqualError(t, err, "invalid --api-v1-deprecation-date: expected YYYY-MM-DD or RFC 3339, e.g. 2006-01-02T15:04:05Z, but got \"01/01/2026\"")
+	_, err = parseArgs(t, []string{"--api-v1-deprecation-date", "2026-06-30", "--api-v1-sunset-date", "2026-01-01"}).V1Deprecation()
+	assert.EqualError(t, err, "invalid --api-v1-sunset-date: expected a date after --api-v1-deprecation-date (2026-06-30) but got 2026-01-01")
+}
+
+func TestParsingStatsCacheArgumentsShouldReturnCache(t *testing.T) {
+	cache, err := parseArgs(t, []string{}).StatsCache()
+	assert.NoError(t, err)
+	assert.Nil(t, cache)
+
+	cache, err = parseArgs(t, []string{"--http-stats-cache-ttl", "5s"}).StatsCache()
+	assert.NoError(t, err)
+	assert.NotNil(t, cache)
+
+	_, err = parseArgs(t, []string{"--http-stats-cache-ttl", "-1s"}).StatsCache()
+	assert.EqualError(t, err, "invalid --http-stats-cache-ttl: expected a positive duration but got -1s")
 }
 
 // Utility function to create a Config object, register CLI arguments, and parse them.
@@ -0,0 +1,250 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"         // Better HTTP API.
+	log "github.com/sirupsen/logrus" // Better Logging.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+)
+
+// AllRoutes makes an HTTPFault apply to all routes.
+const AllRoutes = "*"
+
+// HTTPFault describes a fault injected in responses to the requests it matches.
+type HTTPFault struct {
+	// Route is the name of the route this fault applies to, or AllRoutes.
+	Route string `json:"route"`
+	// Header optionally restricts this fault to requests with this header, as <name>:<value>, e.g. X-Canary:always.
+	Header string `json:"header,omitempty"`
+	// Percentage of the matching requests this fault is injected in, between 0 and 100.
+	Percentage float64 `json:"percentage"`
+	// Latency added before handling requests, if any.
+	Latency *db.Latency `json:"latency,omitempty"`
+	// Status, if any, is returned instead of handling requests.
+	Status int `json:"status,omitempty"`
+	// Truncate cuts responses' bodies in half, and aborts the connection.
+	Truncate bool `json:"truncate,omitempty"`
+	// Drop closes the connection without responding.
+	Drop bool `json:"drop,omitempty"`
+}
+
+// FaultProfile is a named set of faults, e.g. simulating a bad release. The first fault matching a request applies.
+type FaultProfile struct {
+	Name   string      `json:"name,omitempty"`
+	Faults []HTTPFault `json:"faults"`
+}
+
+// Active returns whether this profile injects any fault.
+func (profile FaultProfile) Active() bool {
+	return len(profile.Faults) > 0
+}
+
+// Validate checks these faults have valid percentages and statuses.
+func (profile FaultProfile) Validate() error {
+	for _, fault := range profile.Faults {
+		if len(fault.Route) == 0 {
+			return fmt.Errorf("invalid fault: missing route")
+		}
+		if fault.Percentage < 0 || fault.Percentage > 100 {
+			return fmt.Errorf("invalid fault for route %v: expected a percentage between 0 and 100 but got %v", fault.Route, fault.Percentage)
+		}
+		if fault.Status != 0 && (fault.Status < 100 || fault.Status > 599) {
+			return fmt.Errorf("invalid fault for route %v: invalid status %v", fault.Route, fault.Status)
+		}
+		if len(fault.Header) > 0 && !strings.Contains(fault.Header, ":") {
+			return fmt.Errorf("invalid fault for route %v: expected header as <name>:<value> but got %q", fault.Route, fault.Header)
+		}
+	}
+	return nil
+}
+
+// ParseHTTPFault parses the provided fault, as comma-separated <key>=<value> pairs,
+// e.g. route=users,status=503,percentage=10,header=X-Canary:always,latency=fixed:100ms,truncate=true,drop=true
+func ParseHTTPFault(spec string) (HTTPFault, error) {
+	fault := HTTPFault{Percentage: 100}
+	for _, pair := range strings.Split(spec, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return fault, fmt.Errorf("invalid fault %q: expected <key>=<value> but got %q", spec, pair)
+		}
+		var err error
+		switch key, value := parts[0], parts[1]; key {
+		case "route":
+			fault.Route = value
+		case "header":
+			fault.Header = value
+		case "percentage":
+			fault.Percentage, err = strconv.ParseFloat(value, 64)
+		case "latency":
+			fault.Latency, err = db.ParseLatency(value)
+		case "status":
+			fault.Status, err = strconv.Atoi(value)
+		case "truncate":
+			fault.Truncate, err = strconv.ParseBool(value)
+		case "drop":
+			fault.Drop, err = strconv.ParseBool(value)
+		default:
+			err = fmt.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return fault, fmt.Errorf("invalid fault %q: %v", spec, err)
+		}
+	}
+	return fault, nil
+}
+
+// FaultInjector injects faults in HTTP responses, according to its current profile.
+type FaultInjector struct {
+	profile    FaultProfile
+	random     *rand.Rand
+	mutex      sync.RWMutex // For thread-safe access to the profile.
+	randomLock sync.Mutex   // For thread-safe access to the random numbers generator.
+}
+
+// NewFaultInjector creates a new FaultInjector with the provided profile.
+func NewFaultInjector(profile FaultProfile) (*FaultInjector, error) {
+	injector := &FaultInjector{
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if err := injector.SetProfile(profile); err != nil {
+		return nil, err
+	}
+	return injector, nil
+}
+
+// Profile returns the current fault profile.
+func (injector *FaultInjector) Profile() FaultProfile {
+	injector.mutex.RLock()
+	defer injector.mutex.RUnlock()
+	return injector.profile
+}
+
+// SetProfile replaces the current fault profile.
+func (injector *FaultInjector) SetProfile(profile FaultProfile) error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+	faults := make([]HTTPFault, len(profile.Faults))
+	copy(faults, profile.Faults)
+	injector.mutex.Lock()
+	defer injector.mutex.Unlock()
+	injector.profile = FaultProfile{Name: profile.Name, Faults: faults}
+	return nil
+}
+
+func (injector *FaultInjector) percent() float64 {
+	injector.randomLock.Lock()
+	defer injector.randomLock.Unlock()
+	return injector.random.Float64() * 100
+}
+
+// match returns the first fault matching the provided request, if any.
+func (injector *FaultInjector) match(req *http.Request) (*HTTPFault, bool) {
+	name := ""
+	if route := mux.CurrentRoute(req); route != nil {
+		name = route.GetName()
+	}
+	if isAdminRoute(name) {
+		return nil, false
+	}
+	injector.mutex.RLock()
+	defer injector.mutex.RUnlock()
+	for i := range injector.profile.Faults {
+		fault := injector.profile.Faults[i]
+		if fault.Route != AllRoutes && fault.Route != name {
+			continue
+		}
+		if len(fault.Header) > 0 {
+			parts := strings.SplitN(fault.Header, ":", 2)
+			if req.Header.Get(strings.TrimSpace(parts[0])) != strings.TrimSpace(parts[1]) {
+				continue
+			}
+		}
+		if injector.percent() >= fault.Percentage {
+			return nil, false
+		}
+		return &fault, true
+	}
+	return nil, false
+}
+
+// Middleware injects faults in responses to the requests matching the current profile.
+func (injector *FaultInjector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		fault, ok := injector.match(req)
+		if !ok {
+			next.ServeHTTP(resp, req)
+			return
+		}
+		logger := logging.FromContext(req.Context()).WithField("fault", fmt.Sprintf("%+v", *fault))
+		if logging.SampleDebug("injecting fault") {
+			logger.Debug("injecting fault")
+		}
+		if fault.Latency != nil {
+			timer := time.NewTimer(fault.Latency.Sample())
+			select {
+			case <-req.Context().Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+		switch {
+		case fault.Drop:
+			drop(resp, logger)
+		case fault.Status != 0:
+			writeErrorBody(resp, "injected fault", fault.Status)
+		case fault.Truncate:
+			truncate(resp, req, next)
+		default:
+			next.ServeHTTP(resp, req)
+		}
+	})
+}
+
+// drop closes the connection without responding.
+func drop(resp http.ResponseWriter, logger *log.Entry) {
+	if hijacker, ok := resp.(http.Hijacker); ok {
+		if conn, _, err := hijacker.Hijack(); err == nil {
+			conn.Close()
+			return
+		}
+		logger.Warn("failed to hijack connection")
+	}
+	panic(http.ErrAbortHandler) // Aborts the response without logging a stack trace.
+}
+
+// truncate handles the request, writes the first half of the response's body, and aborts the connection.
+func truncate(resp http.ResponseWriter, req *http.Request, next http.Handler) {
+	buffer := &bufferedResponse{header: resp.Header(), status: http.StatusOK}
+	next.ServeHTTP(buffer, req)
+	body := buffer.body.Bytes()
+	resp.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	resp.WriteHeader(buffer.status)
+	resp.Write(body[:len(body)/2])
+	if flusher, ok := resp.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	panic(http.ErrAbortHandler) // Aborts the response without logging a stack trace.
+}
+
+// bufferedResponse captures a response, so that it can be altered before being written.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *bufferedResponse) Header() http.Header         { return r.header }
+func (r *bufferedResponse) Write(b []byte) (int, error) { return r.body.Write(b) }
+func (r *bufferedResponse) WriteHeader(status int)      { r.status = status }
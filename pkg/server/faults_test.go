@@ -0,0 +1,125 @@
+package server_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"             // Better HTTP API.
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db/dbtest"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/server"
+)
+
+func TestFaultInjectorShouldReturnStatusForMatchingRoutesAndHeaders(t *testing.T) {
+	router := newFaultyRouter(t, server.FaultProfile{
+		Name:   "bad-release",
+		Faults: []server.HTTPFault{{Route: "users", Header: "X-Canary:always", Percentage: 100, Status: http.StatusServiceUnavailable}},
+	})
+
+	resp := serveRouter(router, get(t, "/users"))
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req := get(t, "/users")
+	req.Header.Set("X-Canary", "always")
+	resp = serveRouter(router, req)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+
+	req = get(t, "/healthz")
+	req.Header.Set("X-Canary", "always")
+	resp = serveRouter(router, req)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	assert.Equal(t, "bad-release", resp.Header().Get("X-Fault-Profile"))
+}
+
+func TestFaultInjectorShouldNeverFailAdminRoutes(t *testing.T) {
+	router := newFaultyRouter(t, server.FaultProfile{
+		Faults: []server.HTTPFault{{Route: server.AllRoutes, Percentage: 100, Status: http.StatusInternalServerError}},
+	})
+	router.HandleFunc("/admin/ping", func(resp http.ResponseWriter, req *http.Request) {}).Name(server.AdminRoutePrefix + "ping")
+
+	resp := serveRouter(router, get(t, "/users"))
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	resp = serveRouter(router, get(t, "/admin/ping"))
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestFaultInjectorShouldHonourPercentage(t *testing.T) {
+	router := newFaultyRouter(t, server.FaultProfile{
+		Faults: []server.HTTPFault{{Route: server.AllRoutes, Percentage: 0, Status: http.StatusInternalServerError}},
+	})
+	for i := 0; i < 100; i++ {
+		resp := serveRouter(router, get(t, "/users"))
+		assert.Equal(t, http.StatusOK, resp.Code)
+	}
+}
+
+func TestFaultInjectorShouldAddLatency(t *testing.T) {
+	latency, err := db.ParseLatency("fixed:50ms")
+	assert.NoError(t, err)
+	router := newFaultyRouter(t, server.FaultProfile{
+		Faults: []server.HTTPFault{{Route: "users", Percentage: 100, Latency: latency}},
+	})
+	start := time.Now()
+	resp := serveRouter(router, get(t, "/users"))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+}
+
+func TestFaultInjectorShouldTruncateAndDropResponses(t *testing.T) {
+	for _, fault := range []server.HTTPFault{
+		{Route: "routes", Percentage: 100, Truncate: true},
+		{Route: "routes", Percentage: 100, Drop: true},
+	} {
+		router := newFaultyRouter(t, server.FaultProfile{Faults: []server.HTTPFault{fault}})
+		httpServer := httptest.NewServer(router)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		req, err := http.NewRequest("GET", httpServer.URL+"/", nil)
+		assert.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err == nil {
+			_, err = ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		assert.Error(t, err, "%+v", fault)
+		cancel()
+		httpServer.Close()
+	}
+}
+
+func TestVersionShouldReportActiveFaults(t *testing.T) {
+	faultyDB, err := db.NewFaultyDB(dbtest.NewInMemoryDB(), db.Faults{db.MethodPing: {ErrorRate: 0.5}})
+	assert.NoError(t, err)
+	injector, err := server.NewFaultInjector(server.FaultProfile{
+		Name:   "bad-release",
+		Faults: []server.HTTPFault{{Route: "users", Percentage: 10, Status: http.StatusServiceUnavailable}},
+	})
+	assert.NoError(t, err)
+	server := server.New(faultyDB)
+	server.InjectFaults(injector)
+
+	resp := serve(get(t, "/version"), server)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "{\"version\":\"unknown\",\"httpFaults\":{\"name\":\"bad-release\",\"faults\":[{\"route\":\"users\",\"percentage\":10,\"status\":503}]},\"dbFaults\":{\"Ping\":{\"errorRate\":0.5}}}", body(t, resp.Body))
+}
+
+func newFaultyRouter(t *testing.T, profile server.FaultProfile) *mux.Router {
+	injector, err := server.NewFaultInjector(profile)
+	assert.NoError(t, err)
+	server := server.New(dbtest.NewInMemoryDB())
+	server.InjectFaults(injector)
+	router := mux.NewRouter()
+	server.RegisterRoutes(router)
+	return router
+}
+
+func serveRouter(router *mux.Router, req *http.Request) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	return resp
+}
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux" // Better HTTP API.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/auth"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/metrics"
+)
+
+// APIKeyHeader is the header clients may authenticate with, in which case they are rate limited by API key rather than IP.
+const APIKeyHeader = auth.APIKeyHeader
+
+// unlimitedRoutes are never rate limited nor shed, so that probes and scrapes keep working when the server is overloaded.
+var unlimitedRoutes = map[string]bool{"healthz": true, "livez": true, "metrics": true}
+
+// idleBucketsSweepInterval is how often token buckets left unused long enough to be full again are discarded.
+const idleBucketsSweepInterval = time.Minute
+
+// Limit is a token bucket's configuration: clients may send Burst requests at once, and then Rate requests per second.
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// Enabled returns whether this limit is enforced.
+func (limit Limit) Enabled() bool {
+	return limit.Rate > 0
+}
+
+// Validate checks this limit is valid.
+func (limit Limit) Validate() error {
+	if limit.Rate < 0 {
+		return fmt.Errorf("expected a positive rate but got %v", limit.Rate)
+	}
+	if limit.Enabled() && limit.Burst < 1 {
+		return fmt.Errorf("expected a burst of at least 1 but got %v", limit.Burst)
+	}
+	return nil
+}
+
+// ParseLimit parses the provided limit, as <rate> or <rate>:<burst>, e.g. 10:20. The burst defaults to the rate, rounded up.
+func ParseLimit(spec string) (Limit, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	rate, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return Limit{}, fmt.Errorf("invalid limit %q: %v", spec, err)
+	}
+	limit := Limit{Rate: rate, Burst: int(math.Ceil(rate))}
+	if len(parts) == 2 {
+		if limit.Burst, err = strconv.Atoi(parts[1]); err != nil {
+			return Limit{}, fmt.Errorf("invalid limit %q: %v", spec, err)
+		}
+	}
+	if err := limit.Validate(); err != nil {
+		return Limit{}, fmt.Errorf("invalid limit %q: %v", spec, err)
+	}
+	return limit, nil
+}
+
+// Limits configures a Limiter.
+type Limits struct {
+	// PerClient is the default limit applied to each client, identified by API key or IP.
+	PerClient Limit
+	// PerRoute overrides PerClient for the routes with these names.
+	PerRoute map[string]Limit
+	// MaxInFlight caps the number of requests served concurrently, across all clients. 0 means unlimited.
+	MaxInFlight int
+	// RetryAfter is suggested to clients whose requests are shed because too many requests are in flight.
+	RetryAfter time.Duration
+	// TrustForwardedFor identifies clients by the first address in X-Forwarded-For, e.g. when behind a reverse proxy.
+	TrustForwardedFor bool
+}
+
+// Limiter rate limits each client, and sheds load when too many requests are in flight.
+type Limiter struct {
+	limits    Limits
+	inFlight  int64
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+	mutex     sync.Mutex // For thread-safe access to the buckets.
+	rejected  *metrics.Counter
+	serving   *metrics.Gauge
+
+	authenticator *auth.Authenticator // Identifies authenticated clients, if authentication is enabled.
+}
+
+// NewLimiter creates a new Limiter, whose metrics are exposed via the provided registry.
+func NewLimiter(limits Limits, registry *metrics.Registry) (*Limiter, error) {
+	if err := limits.PerClient.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid rate limit: %v", err)
+	}
+	for route, limit := range limits.PerRoute {
+		if err := limit.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid rate limit for route %v: %v", route, err)
+		}
+	}
+	if limits.MaxInFlight < 0 {
+		return nil, fmt.Errorf("invalid maximum number of requests in flight: expected a positive number but got %v", limits.MaxInFlight)
+	}
+	return &Limiter{
+		limits:    limits,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+		rejected:  registry.Counter("http_requests_rejected_total", "Number of HTTP requests rejected, by route and reason: rate_limited or overloaded.", "route", "reason"),
+		serving:   registry.Gauge("http_requests_in_flight", "Number of HTTP requests currently being served."),
+	}, nil
+}
+
+// Middleware rejects requests with 429 Too Many Requests when their client exceeds its rate limit,
+// and with 503 Service Unavailable when too many requests are already in flight.
+func (limiter *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		route := ""
+		if current := mux.CurrentRoute(req); current != nil {
+			route = current.GetName()
+		}
+		if unlimitedRoutes[route] || isAdminRoute(route) {
+			next.ServeHTTP(resp, req)
+			return
+		}
+		logger := logging.FromContext(req.Context())
+
+		if limit, key, ok := limiter.limit(route, req); ok {
+			decision := limiter.take(key, limit)
+			resp.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+			resp.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.remaining))
+			resp.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(decision.reset)))
+			if !decision.allowed {
+				if logging.SampleDebug("rate limited") {
+					logger.WithField("client", key).Debug("rate limited")
+				}
+				limiter.rejected.Inc(route, "rate_limited")
+				resp.Header().Set("Retry-After", strconv.Itoa(seconds(decision.retryAfter)))
+				writeErrorBody(resp, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		inFlight := atomic.AddInt64(&limiter.inFlight, 1)
+		defer atomic.AddInt64(&limiter.inFlight, -1)
+		if limiter.limits.MaxInFlight > 0 && inFlight > int64(limiter.limits.MaxInFlight) {
+			if logging.SampleDebug("overloaded, shedding request") {
+				logger.WithField("inFlight", inFlight).Debug("overloaded, shedding request")
+			}
+			limiter.rejected.Inc(route, "overloaded")
+			resp.Header().Set("Retry-After", strconv.Itoa(seconds(limiter.limits.RetryAfter)))
+			writeErrorBody(resp, "too many requests in flight", http.StatusServiceUnavailable)
+			return
+		}
+		limiter.serving.Add(1)
+		defer limiter.serving.Add(-1)
+		next.ServeHTTP(resp, req)
+	})
+}
+
+// limit returns the limit applying to the provided request, if any, and the key of the bucket to take a token from.
+func (limiter *Limiter) limit(route string, req *http.Request) (Limit, string, bool) {
+	client := limiter.client(req)
+	if limit, ok := limiter.limits.PerRoute[route]; ok {
+		return limit, route + "|" + client, limit.Enabled()
+	}
+	return limiter.limits.PerClient, AllRoutes + "|" + client, limiter.limits.PerClient.Enabled()
+}
+
+// client identifies the client sending the provided request, by the principal it authenticates as, or else by IP.
+// Credentials are never used as is, as clients could otherwise evade their limit, and grow the buckets indefinitely,
+// by sending different invalid credentials with each request, nor logged.
+func (limiter *Limiter) client(req *http.Request) string {
+	if limiter.authenticator != nil {
+		if principal, err := limiter.authenticator.Authenticate(req); err == nil {
+			return "principal:" + principal.Subject // E.g. api-key:<fingerprint>, but never the key itself.
+		}
+	}
+	if limiter.limits.TrustForwardedFor {
+		if forwardedFor := req.Header.Get("X-Forwarded-For"); len(forwardedFor) > 0 {
+			return "ip:" + strings.TrimSpace(strings.Split(forwardedFor, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return "ip:" + req.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+type decision struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration // Until the bucket is full again.
+	retryAfter time.Duration // Until the next token, if not allowed.
+}
+
+// take takes a token from the provided bucket, creating it if need be.
+func (limiter *Limiter) take(key string, limit Limit) decision {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	now := limiter.now()
+	if now.Sub(limiter.lastSweep) > idleBucketsSweepInterval {
+		limiter.sweep(now)
+	}
+	b, ok := limiter.buckets[key]
+	if !ok {
+		b = &bucket{limit: limit, tokens: float64(limit.Burst), last: now}
+		limiter.buckets[key] = b
+	}
+	return b.take(now)
+}
+
+// sweep discards buckets which are full again, as these behave like new ones. It should be called while holding the mutex.
+func (limiter *Limiter) sweep(now time.Time) {
+	for key, b := range limiter.buckets {
+		if b.refill(now) >= float64(b.limit.Burst) {
+			delete(limiter.buckets, key)
+		}
+	}
+	limiter.lastSweep = now
+}
+
+// bucket is a token bucket: tokens are added at the limit's rate, up to its burst, and each request takes one.
+type bucket struct {
+	limit  Limit
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) refill(now time.Time) float64 {
+	b.tokens = math.Min(float64(b.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	b.last = now
+	return b.tokens
+}
+
+func (b *bucket) take(now time.Time) decision {
+	b.refill(now)
+	d := decision{allowed: b.tokens >= 1}
+	if d.allowed {
+		b.tokens--
+	} else {
+		d.retryAfter = duration((1 - b.tokens) / b.limit.Rate)
+	}
+	d.remaining = int(math.Floor(b.tokens))
+	d.reset = duration((float64(b.limit.Burst) - b.tokens) / b.limit.Rate)
+	return d
+}
+
+func duration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// seconds rounds the provided duration up to the second, as expected by Retry-After and RateLimit-Reset headers.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,178 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"             // Better HTTP API.
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/auth"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db/dbtest"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/metrics"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/server"
+)
+
+func TestLimiterShouldRateLimitEachClient(t *testing.T) {
+	registry := metrics.NewRegistry()
+	router := newLimitedRouter(t, server.Limits{PerClient: server.Limit{Rate: 0.1, Burst: 2}}, registry)
+
+	for _, remaining := range []string{"1", "0"} {
+		resp := serveRouter(router, fromClient(get(t, "/users"), "10.0.0.1:1234", ""))
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "2", resp.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, remaining, resp.Header().Get("RateLimit-Remaining"))
+	}
+	resp := serveRouter(router, fromClient(get(t, "/users"), "10.0.0.1:5678", ""))
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "0", resp.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "10", resp.Header().Get("Retry-After"))
+	assert.Equal(t, "20", resp.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, float64(1), rejected(registry, "users", "rate_limited"))
+
+	// Other clients, identified by IP, have their own buckets, but API keys are ignored unless authenticated:
+	resp = serveRouter(router, fromClient(get(t, "/users"), "10.0.0.2:1234", ""))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	resp = serveRouter(router, fromClient(get(t, "/users"), "10.0.0.1:1234", "api-key"))
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+
+	// Health checks are never limited:
+	resp = serveRouter(router, fromClient(get(t, "/healthz"), "10.0.0.1:1234", ""))
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+}
+
+func TestLimiterShouldNeverLimitAdminRoutes(t *testing.T) {
+	router := newLimitedRouter(t, server.Limits{PerClient: server.Limit{Rate: 0.1, Burst: 1}}, metrics.NewRegistry())
+	router.HandleFunc("/admin/ping", func(resp http.ResponseWriter, req *http.Request) {}).Name(server.AdminRoutePrefix + "ping")
+
+	for i := 0; i < 3; i++ {
+		resp := serveRouter(router, fromClient(get(t, "/admin/ping"), "10.0.0.1:1234", ""))
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Empty(t, resp.Header().Get("RateLimit-Limit"))
+	}
+}
+
+func TestLimiterShouldIdentifyAuthenticatedClientsByPrincipal(t *testing.T) {
+	limiter, err := server.NewLimiter(server.Limits{PerClient: server.Limit{Rate: 0.1, Burst: 1}}, metrics.NewRegistry())
+	assert.NoError(t, err)
+	authenticator, err := auth.NewAuthenticator(nil, map[string][]string{"s3cr3t-key": {auth.ScopeUsersRead}})
+	assert.NoError(t, err)
+	api := server.New(dbtest.NewInMemoryDB())
+	api.LimitRequests(limiter)
+	api.Authenticate(authenticator)
+	router := mux.NewRouter()
+	api.RegisterRoutes(router)
+
+	resp := serveRouter(router, fromClient(get(t, "/users"), "10.0.0.1:1234", "fake-key-1"))
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	// Different invalid keys do not evade the limit of their client's IP:
+	resp = serveRouter(router, fromClient(get(t, "/users"), "10.0.0.1:1234", "fake-key-2"))
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	// Valid keys are limited separately, whatever their client's IP:
+	resp = serveRouter(router, fromClient(get(t, "/users"), "10.0.0.1:1234", "s3cr3t-key"))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	resp = serveRouter(router, fromClient(get(t, "/users"), "10.0.0.2:1234", "s3cr3t-key"))
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+}
+
+func TestLimiterShouldApplyPerRouteLimits(t *testing.T) {
+	router := newLimitedRouter(t, server.Limits{
+		PerClient: server.Limit{Rate: 100, Burst: 100},
+		PerRoute:  map[string]server.Limit{"users_id": {Rate: 0.1, Burst: 1}},
+	}, metrics.NewRegistry())
+
+	resp := serveRouter(router, fromClient(get(t, "/users/1"), "10.0.0.1:1234", ""))
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	resp = serveRouter(router, fromClient(get(t, "/users/1"), "10.0.0.1:1234", ""))
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	resp = serveRouter(router, fromClient(get(t, "/users"), "10.0.0.1:1234", ""))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "100", resp.Header().Get("RateLimit-Limit"))
+}
+
+func TestLimiterShouldIdentifyClientsByForwardedForWhenTrusted(t *testing.T) {
+	router := newLimitedRouter(t, server.Limits{PerClient: server.Limit{Rate: 0.1, Burst: 1}, TrustForwardedFor: true}, metrics.NewRegistry())
+	for _, client := range []string{"192.168.0.1", "192.168.0.2, 10.0.0.1"} {
+		req := fromClient(get(t, "/users"), "10.0.0.1:1234", "")
+		req.Header.Set("X-Forwarded-For", client)
+		resp := serveRouter(router, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	}
+}
+
+func TestLimiterShouldShedLoadBeyondMaxInFlight(t *testing.T) {
+	registry := metrics.NewRegistry()
+	limiter, err := server.NewLimiter(server.Limits{MaxInFlight: 1, RetryAfter: 2 * time.Second}, registry)
+	assert.NoError(t, err)
+	started, release := make(chan struct{}), make(chan struct{})
+	router := mux.NewRouter()
+	router.Use(limiter.Middleware)
+	router.HandleFunc("/slow", func(resp http.ResponseWriter, req *http.Request) {
+		close(started)
+		<-release
+	}).Name("slow")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		resp := serveRouter(router, get(t, "/slow"))
+		assert.Equal(t, http.StatusOK, resp.Code)
+	}()
+	<-started
+	resp := serveRouter(router, get(t, "/slow"))
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, "2", resp.Header().Get("Retry-After"))
+	assert.Equal(t, float64(1), rejected(registry, "slow", "overloaded"))
+	close(release)
+	wg.Wait()
+}
+
+func TestParsingLimits(t *testing.T) {
+	limit, err := server.ParseLimit("2.5")
+	assert.NoError(t, err)
+	assert.Equal(t, server.Limit{Rate: 2.5, Burst: 3}, limit)
+	limit, err = server.ParseLimit("10:20")
+	assert.NoError(t, err)
+	assert.Equal(t, server.Limit{Rate: 10, Burst: 20}, limit)
+	_, err = server.ParseLimit("10:0")
+	assert.EqualError(t, err, "invalid limit \"10:0\": expected a burst of at least 1 but got 0")
+	_, err = server.ParseLimit("fast")
+	assert.Error(t, err)
+}
+
+func newLimitedRouter(t *testing.T, limits server.Limits, registry *metrics.Registry) *mux.Router {
+	limiter, err := server.NewLimiter(limits, registry)
+	assert.NoError(t, err)
+	server := server.New(dbtest.NewInMemoryDB())
+	server.LimitRequests(limiter)
+	router := mux.NewRouter()
+	server.RegisterRoutes(router)
+	return router
+}
+
+func fromClient(req *http.Request, remoteAddr, apiKey string) *http.Request {
+	req.RemoteAddr = remoteAddr
+	if len(apiKey) > 0 {
+		req.Header.Set(server.APIKeyHeader, apiKey)
+	}
+	return req
+}
+
+// rejected scrapes the provided registry for the number of requests rejected.
+func rejected(registry *metrics.Registry, route, reason string) float64 {
+	resp := httptest.NewRecorder()
+	registry.ServeHTTP(resp, httptest.NewRequest("GET", "/metrics", nil))
+	var value float64
+	for _, line := range strings.Split(resp.Body.String(), "\n") {
+		if strings.HasPrefix(line, "http_requests_rejected_total{route=\""+route+"\",reason=\""+reason+"\"} ") {
+			value, _ = strconv.ParseFloat(strings.Fields(line)[1], 64)
+		}
+	}
+	return value
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+)
+
+// Number of search results returned per page, unless clients ask for fewer, or more, up to maxSearchLimit.
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// SearchResults is a page of users matching a search, by decreasing relevance.
+// Clients get the next page by searching again with the provided cursor, until there is none.
+type SearchResults struct {
+	Results    []SearchResult `json:"results"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
+// SearchResult is an user matching a search, in the negotiated representation, along with its relevance, between 0 and 1.
+type SearchResult struct {
+	User  interface{} `json:"user"`
+	Score float64     `json:"score"`
+}
+
+// searchCursor is the position after which the next page of a search's results starts.
+// It carries the searched text, so that it cannot be used to page through the results of another search.
+type searchCursor struct {
+	Text string `json:"q"`
+	db.SearchCursor
+}
+
+func encodeCursor(text string, cursor *db.SearchCursor) string {
+	bytes, _ := json.Marshal(searchCursor{Text: text, SearchCursor: *cursor}) // Cannot fail.
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+func decodeCursor(text, encoded string) (*db.SearchCursor, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	cursor := searchCursor{}
+	if err := json.Unmarshal(bytes, &cursor); err != nil {
+		return nil, err
+	}
+	if cursor.Text != text {
+		return nil, fmt.Errorf("expected a cursor for %q but got one for %q", text, cursor.Text)
+	}
+	return &cursor.SearchCursor, nil
+}
+
+// SearchUsersHandler returns a page of the users whose full name matches the provided text, either fuzzily or word for word.
+func (server HTTPServer) SearchUsersHandler(resp http.ResponseWriter, req *http.Request) {
+	params := req.URL.Query()
+	text := params.Get("q")
+	logger := logging.FromContext(req.Context()).WithField("q", text)
+	searcher, ok := server.db.(db.Searcher)
+	if !ok {
+		writeError(resp, logger, fmt.Errorf("%T does not support searching users", server.db), "failed to search users", http.StatusNotImplemented)
+		return
+	}
+	if len(text) == 0 {
+		writeError(resp, logger, errors.New("empty q"), "missing search text", http.StatusBadRequest)
+		return
+	}
+	limit, err := parseParam(params.Get("limit"), defaultSearchLimit, maxSearchLimit)
+	if err != nil {
+		writeError(resp, logger, err, "invalid limit", http.StatusBadRequest)
+		return
+	}
+	var after *db.SearchCursor
+	if encoded := params.Get("cursor"); len(encoded) > 0 {
+		if after, err = decodeCursor(text, encoded); err != nil {
+			writeError(resp, logger, err, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Fetch one more match than requested, to tell whether there is a next page:
+	matches, err := searcher.SearchUsers(req.Context(), text, after, limit+1)
+	if err == db.ErrNotSupported {
+		writeError(resp, logger, err, "failed to search users", http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		writeError(resp, logger, err, "failed to search users", http.StatusInternalServerError)
+		return
+	}
+	negotiated := negotiatedFrom(req.Context())
+	results := SearchResults{Results: []SearchResult{}}
+	if len(matches) > limit {
+		matches = matches[:limit]
+		results.NextCursor = encodeCursor(text, matches[limit-1].Cursor())
+	}
+	for _, match := range matches {
+		results.Results = append(results.Results, SearchResult{User: negotiated.represent(match.User), Score: match.Score})
+	}
+	bytes, err := json.Marshal(results)
+	if err != nil {
+		writeError(resp, logger, err, "failed to serialise search results as JSON", http.StatusInternalServerError)
+		return
+	}
+	writeResponseAs(resp, logger, negotiated.MediaType, bytes)
+}
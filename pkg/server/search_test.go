@@ -0,0 +1,85 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db/dbtest"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/server"
+)
+
+func TestSearchUsers(t *testing.T) {
+	database := dbtest.Setup(t)
+	assert.NotNil(t, database)
+	defer dbtest.Cleanup(t, database)
+	api := server.New(database)
+	for _, user := range []domain.User{
+		{FirstName: "Luke", FamilyName: "Skywalker", Age: 20},
+		{FirstName: "Leia", FamilyName: "Organa", Age: 20},
+		{FirstName: "Anakin", FamilyName: "Skywalker", Age: 45},
+	} {
+		_, err := database.CreateUser(context.Background(), &user)
+		assert.NoError(t, err)
+	}
+
+	resp := serve(get(t, "/users/search?q=skywalker&limit=1"), api)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	page := searchResults(t, resp.Body.Bytes())
+	if assert.Equal(t, 1, len(page.Results)) {
+		assert.Equal(t, map[string]interface{}{"id": float64(1), "firstName": "Luke", "familyName": "Skywalker", "age": float64(20)}, page.Results[0].User)
+		assert.True(t, page.Results[0].Score > 0 && page.Results[0].Score <= 1)
+	}
+	assert.NotEmpty(t, page.NextCursor)
+
+	// The next page, in V2's representation:
+	resp = serve(get(t, "/v2/users/search?q=skywalker&limit=1&cursor="+url.QueryEscape(page.NextCursor)), api)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	page = searchResults(t, resp.Body.Bytes())
+	if assert.Equal(t, 1, len(page.Results)) {
+		assert.Equal(t, map[string]interface{}{"first": "Anakin", "family": "Skywalker"}, page.Results[0].User.(map[string]interface{})["name"])
+	}
+	assert.Empty(t, page.NextCursor)
+
+	resp = serve(get(t, "/users/search?q=chewbacca"), api)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "{\"results\":[]}", body(t, resp.Body))
+
+	for _, uri := range []string{
+		"/users/search",
+		"/users/search?q=luke&limit=0",
+		"/users/search?q=luke&limit=101",
+		"/users/search?q=luke&cursor=not-a-cursor",
+	} {
+		resp = serve(get(t, uri), api)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, uri)
+	}
+}
+
+func TestSearchUsersWithCursorOfAnotherSearchShouldFail(t *testing.T) {
+	database := dbtest.Setup(t)
+	assert.NotNil(t, database)
+	defer dbtest.Cleanup(t, database)
+	api := server.New(database)
+	for _, firstName := range []string{"Luke", "Luka"} {
+		_, err := database.CreateUser(context.Background(), &domain.User{FirstName: firstName})
+		assert.NoError(t, err)
+	}
+
+	resp := serve(get(t, "/users/search?q=luke&limit=1"), api)
+	page := searchResults(t, resp.Body.Bytes())
+	assert.NotEmpty(t, page.NextCursor)
+	resp = serve(get(t, "/users/search?q=luka&cursor="+url.QueryEscape(page.NextCursor)), api)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func searchResults(t *testing.T, bytes []byte) server.SearchResults {
+	results := server.SearchResults{}
+	assert.NoError(t, json.Unmarshal(bytes, &results))
+	return results
+}
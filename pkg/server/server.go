@@ -1,22 +1,37 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"         // Better HTTP API.
 	log "github.com/sirupsen/logrus" // Better Logging.
 
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/auth"
 	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db"
 	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/metrics"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/tracing"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/version"
 )
 
 // HTTPServer is an HTTP server reading users from the configured database.
 type HTTPServer struct {
-	db db.DB
+	db            db.DB
+	injector      *FaultInjector
+	limiter       *Limiter
+	authenticator *auth.Authenticator
+	metrics       *metrics.Registry
+	tracer        *tracing.Tracer
+	deprecation   Deprecation
+	statsCache    *StatsCache
 }
 
 // New creates a new HTTP server.
@@ -26,33 +41,152 @@ func New(db db.DB) *HTTPServer {
 	}
 }
 
+// InjectFaults makes this server inject the provided injector's faults in its responses.
+func (server *HTTPServer) InjectFaults(injector *FaultInjector) {
+	server.injector = injector
+}
+
+// LimitRequests makes this server rate limit clients and shed load according to the provided limiter.
+func (server *HTTPServer) LimitRequests(limiter *Limiter) {
+	server.limiter = limiter
+}
+
+// Authenticate makes this server require clients to be authenticated, and granted the scope of the route they call,
+// except for health checks, the version and metrics.
+func (server *HTTPServer) Authenticate(authenticator *auth.Authenticator) {
+	server.authenticator = authenticator
+}
+
+// ExposeMetrics makes this server serve the provided registry's metrics under /metrics.
+func (server *HTTPServer) ExposeMetrics(registry *metrics.Registry) {
+	server.metrics = registry
+}
+
+// Trace makes this server record a span for each request, continuing the trace propagated by the caller, if any.
+func (server *HTTPServer) Trace(tracer *tracing.Tracer) {
+	server.tracer = tracer
+}
+
+// DeprecateV1 makes this server advertise the provided schedule of V1's retirement in its V1 responses.
+func (server *HTTPServer) DeprecateV1(deprecation Deprecation) {
+	server.deprecation = deprecation
+}
+
+// CacheStats makes this server cache statistics about users, as per the provided cache.
+func (server *HTTPServer) CacheStats(cache *StatsCache) {
+	server.statsCache = cache
+}
+
 // RegisterRoutes registers the users API HTTP routes to the provided mux.Router.
 func (server *HTTPServer) RegisterRoutes(router *mux.Router) {
+	router.Use(servedBy, LogRequests)
+	if server.tracer != nil {
+		router.Use(traceRequests(server.tracer))
+	}
+	if server.limiter != nil {
+		server.limiter.authenticator = server.authenticator // Rate limits authenticated clients by principal.
+		router.Use(server.limiter.Middleware)
+	}
+	if server.injector != nil {
+		router.Use(server.injector.Middleware)
+	}
 	for _, route := range server.routes() {
-		router.Handle(route.Path, route.Handler).Methods(route.Method).Name(route.Name)
+		var handler http.Handler = route.Handler
+		if server.authenticator != nil && len(route.Scope) > 0 {
+			handler = server.authenticator.Require(route.Scope, handler)
+		}
+		router.Handle(route.Path, handler).Methods(route.Method).Name(route.Name)
+	}
+}
+
+// ServedByHeader reports the version of this server in all responses, e.g. for clients to tell versions apart during a canary release.
+const ServedByHeader = "X-Served-By"
+
+func servedBy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set(ServedByHeader, version.Version)
+		next.ServeHTTP(resp, req)
+	})
+}
+
+// AdminRoutePrefix starts the names of admin routes, which are never rate limited, shed, nor subject to injected faults,
+// even when served alongside the API, so that operators can e.g. remove faults, or profile the server, when it is overloaded.
+const AdminRoutePrefix = "admin_"
+
+func isAdminRoute(name string) bool {
+	return strings.HasPrefix(name, AdminRoutePrefix)
+}
+
+// probeRoutes are served by RegisterProbeRoutes.
+var probeRoutes = map[string]bool{"healthz": true, "livez": true}
+
+// RegisterProbeRoutes only registers the health checks' routes to the provided mux.Router,
+// e.g. to serve these over plain HTTP when serving HTTPS.
+func (server *HTTPServer) RegisterProbeRoutes(router *mux.Router) {
+	router.Use(servedBy, LogRequests)
+	for _, route := range server.routes() {
+		if probeRoutes[route.Name] {
+			router.Handle(route.Path, route.Handler).Methods(route.Method).Name(route.Name)
+		}
 	}
 }
 
 type route struct {
-	Name    string           `json:"-"`
-	Method  string           `json:"method"`
-	Path    string           `json:"path"`
-	Handler http.HandlerFunc `json:"-"`
+	Name     string           `json:"-"`
+	Method   string           `json:"method"`
+	Path     string           `json:"path"`
+	Handler  http.HandlerFunc `json:"-"`
+	Scope    string           `json:"-"` // Scope required to call this route, when authentication is enabled, or empty if open.
+	Versions []int            `json:"-"` // Versions of the API this route is served in, under their path prefix, or nil if unversioned.
 }
 
 func (server HTTPServer) routes() []route {
-	return []route{
-		{"routes", "GET", "/", server.Routes},
-		{"healthz", "GET", "/healthz", server.CheckHealth},
-		{"users", "POST", "/users", server.CreateUserHandler},
-		{"users", "GET", "/users", server.ReadUsersHandler},
-		{"users_id", "GET", "/users/{id:[0-9]+}", server.ReadUserByIDHandler},
+	routes := []route{
+		{"routes", "GET", "/", server.Routes, "", nil},
+		{"healthz", "GET", "/healthz", server.CheckHealth, "", nil},
+		{"livez", "GET", "/livez", server.CheckLiveness, "", nil},
+		{"version", "GET", "/version", server.VersionHandler, "", nil},
+		{"users", "POST", "/users", server.CreateUserHandler, auth.ScopeUsersWrite, []int{V1, V2}},
+		{"users", "GET", "/users", server.ReadUsersHandler, auth.ScopeUsersRead, []int{V1, V2}},
+		{"users_stats", "GET", "/users/stats", server.UserStatsHandler, auth.ScopeUsersRead, []int{V1, V2}},
+		{"users_search", "GET", "/users/search", server.SearchUsersHandler, auth.ScopeUsersRead, []int{V1, V2}},
+		{"users_watch", "GET", "/users/watch", server.WatchUsersHandler, auth.ScopeUsersRead, []int{V1}},
+		{"users_id", "GET", "/users/{id:[0-9]+}", server.ReadUserByIDHandler, auth.ScopeUsersRead, []int{V1, V2}},
+		{"users_id", "DELETE", "/users/{id:[0-9]+}", server.DeleteUserHandler, auth.ScopeUsersWrite, []int{V1, V2}},
+		{"events_replay", "POST", "/events/replay", server.ReplayEventsHandler, auth.ScopeEventsReplay, []int{V1}},
+	}
+	if server.metrics != nil {
+		routes = append(routes, route{"metrics", "GET", "/metrics", server.metrics.ServeHTTP, "", nil})
+	}
+	return server.versionRoutes(routes)
+}
+
+// versionRoutes serves the provided versioned routes under their unversioned path, as aliases, and under each
+// of their versions' path prefix, e.g. /v1/users and /v2/users, keeping their names so that these share their
+// faults, rate limits and metrics.
+func (server HTTPServer) versionRoutes(routes []route) []route {
+	versioned := make([]route, 0, len(routes))
+	for _, r := range routes {
+		if len(r.Versions) > 0 {
+			r.Handler = server.versioned(0, r.Versions, r.Handler)
+		}
+		versioned = append(versioned, r)
+	}
+	for _, version := range []int{V1, V2} {
+		for _, r := range routes {
+			if supports(r.Versions, version) {
+				r.Handler = server.versioned(version, r.Versions, r.Handler)
+				r.Path = versionPrefix(version) + r.Path
+				versioned = append(versioned, r)
+			}
+		}
 	}
+	return versioned
 }
 
 // Routes lists this server's endpoints.
 func (server HTTPServer) Routes(resp http.ResponseWriter, req *http.Request) {
-	logger := log.WithField("method", req.Method).WithField("path", req.URL.Path)
+	logger := logging.FromContext(req.Context())
 	bytes, err := json.Marshal(server.routes())
 	if err != nil {
 		writeError(resp, logger, err, "failed to serialise routes as JSON", http.StatusInternalServerError)
@@ -63,7 +197,14 @@ func (server HTTPServer) Routes(resp http.ResponseWriter, req *http.Request) {
 
 // CheckHealth checks the health of this server.
 func (server HTTPServer) CheckHealth(resp http.ResponseWriter, req *http.Request) {
-	logger := log.WithField("method", req.Method).WithField("path", req.URL.Path)
+	logger := logging.FromContext(req.Context())
+	if profile := server.faultProfile(); profile.Active() {
+		name := profile.Name
+		if len(name) == 0 {
+			name = "custom"
+		}
+		resp.Header().Set("X-Fault-Profile", name)
+	}
 	err := server.db.Ping(req.Context())
 	if err != nil {
 		writeError(resp, logger, err, "health check failed", http.StatusInternalServerError)
@@ -72,48 +213,151 @@ func (server HTTPServer) CheckHealth(resp http.ResponseWriter, req *http.Request
 	resp.WriteHeader(http.StatusNoContent)
 }
 
+// CheckLiveness checks this server is running, regardless of its dependencies, e.g. the database, being healthy.
+func (server HTTPServer) CheckLiveness(resp http.ResponseWriter, req *http.Request) {
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+// Version describes the running version of this server, and the faults it currently injects, if any.
+type Version struct {
+	Version    string        `json:"version"`
+	HTTPFaults *FaultProfile `json:"httpFaults,omitempty"`
+	DBFaults   db.Faults     `json:"dbFaults,omitempty"`
+}
+
+// VersionHandler returns the running version of this server, and the faults it currently injects, if any.
+func (server HTTPServer) VersionHandler(resp http.ResponseWriter, req *http.Request) {
+	logger := logging.FromContext(req.Context())
+	current := Version{Version: version.Version}
+	if profile := server.faultProfile(); profile.Active() {
+		current.HTTPFaults = &profile
+	}
+	if faultyDB, ok := findFaultyDB(server.db); ok {
+		current.DBFaults = faultyDB.Faults()
+	}
+	bytes, err := json.Marshal(current)
+	if err != nil {
+		writeError(resp, logger, err, "failed to serialise version as JSON", http.StatusInternalServerError)
+		return
+	}
+	writeResponse(resp, logger, bytes)
+}
+
+// findFaultyDB looks for a FaultyDB among the provided DB and the ones it decorates.
+func findFaultyDB(database db.DB) (*db.FaultyDB, bool) {
+	for {
+		if faultyDB, ok := database.(*db.FaultyDB); ok {
+			return faultyDB, true
+		}
+		decorator, ok := database.(db.Decorator)
+		if !ok {
+			return nil, false
+		}
+		database = decorator.Unwrap()
+	}
+}
+
+func (server HTTPServer) faultProfile() FaultProfile {
+	if server.injector == nil {
+		return FaultProfile{}
+	}
+	return server.injector.Profile()
+}
+
 // CreateUserHandler stores the provided user.
 func (server HTTPServer) CreateUserHandler(resp http.ResponseWriter, req *http.Request) {
-	logger := log.WithField("method", req.Method).WithField("path", req.URL.Path)
+	logger := logging.FromContext(req.Context())
 	json, err := ioutil.ReadAll(req.Body)
 	if err != nil {
 		writeError(resp, logger, err, "failed to read request's body", http.StatusInternalServerError)
 		return
 	}
-	user, err := domain.UnmarshalUser(json)
+	negotiated := negotiatedFrom(req.Context())
+	user, err := negotiated.unmarshalUser(json)
 	if err != nil {
 		writeError(resp, logger, err, "failed to deserialise user", http.StatusInternalServerError)
 		return
 	}
+	if err := user.Validate(); err != nil {
+		writeError(resp, logger, err, err.Error(), http.StatusBadRequest) // Tells clients which field is invalid, and why.
+		return
+	}
 	id, err := server.db.CreateUser(req.Context(), user)
+	if err == db.ErrEmailTaken {
+		server.writeEmailTaken(resp, req, logger, user.Email)
+		return
+	}
 	if err != nil {
 		writeError(resp, logger, err, "failed to create user", http.StatusInternalServerError)
 		return
 	}
-	resp.Header().Set("Location", fmt.Sprintf("/users/%v", id))
+	resp.Header().Set("Location", negotiated.location(id))
 	resp.WriteHeader(http.StatusCreated)
 }
 
-// ReadUsersHandler returns all stored users.
+// writeEmailTaken responds with 409 Conflict, and a problem pointing at the user who already has the provided email.
+func (server HTTPServer) writeEmailTaken(resp http.ResponseWriter, req *http.Request, logger *log.Entry, email string) {
+	problem := Problem{
+		Type:     EmailTakenProblem,
+		Title:    "Email already taken",
+		Status:   http.StatusConflict,
+		Detail:   fmt.Sprintf("another user already has email %v, regardless of case", email),
+		Instance: req.URL.Path,
+	}
+	existing, err := server.db.ReadUserByEmail(req.Context(), email)
+	if err == nil {
+		problem.ExistingUser = negotiatedFrom(req.Context()).location(existing.ID)
+	} else {
+		// The existing user may have been deleted since, or the database failed, but the request conflicted regardless:
+		logger.WithField("err", err).Warn("failed to read user with the same email")
+	}
+	logger.WithField("status", problem.Status).Info(problem.Title)
+	writeProblem(resp, problem)
+}
+
+// ReadUsersHandler returns all stored users, or the one with the provided email, if any, regardless of case.
 func (server HTTPServer) ReadUsersHandler(resp http.ResponseWriter, req *http.Request) {
-	logger := log.WithField("method", req.Method).WithField("path", req.URL.Path)
-	users, err := server.db.ReadUsers(req.Context())
+	logger := logging.FromContext(req.Context())
+	var users []*domain.User
+	var err error
+	if email, ok := req.URL.Query()["email"]; ok {
+		if err := domain.ValidateEmail(email[0]); err != nil {
+			writeError(resp, logger, err, "invalid email", http.StatusBadRequest)
+			return
+		}
+		users, err = server.readUsersByEmail(req.Context(), email[0])
+	} else {
+		users, err = server.db.ReadUsers(req.Context())
+	}
 	if err != nil {
 		writeError(resp, logger, err, "failed to read users", http.StatusInternalServerError)
 		return
 	}
-	bytes, err := json.Marshal(users)
+	negotiated := negotiatedFrom(req.Context())
+	bytes, err := negotiated.marshalUsers(users)
 	if err != nil {
 		writeError(resp, logger, err, "failed to serialise users as JSON", http.StatusInternalServerError)
 		return
 	}
-	writeResponse(resp, logger, bytes)
+	writeResponseAs(resp, logger, negotiated.MediaType, bytes)
+}
+
+// readUsersByEmail returns the user with the provided email, if any, as a list, so that lookups are filtered listings.
+func (server HTTPServer) readUsersByEmail(ctx context.Context, email string) ([]*domain.User, error) {
+	user, err := server.db.ReadUserByEmail(ctx, email)
+	if err == db.ErrNotFound {
+		return []*domain.User{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []*domain.User{user}, nil
 }
 
 // ReadUserByIDHandler return the stored user corresponding to the provided ID.
 func (server HTTPServer) ReadUserByIDHandler(resp http.ResponseWriter, req *http.Request) {
 	idStr := mux.Vars(req)["id"]
-	logger := log.WithField("method", req.Method).WithField("path", req.URL.Path).WithField("id", idStr)
+	logger := logging.FromContext(req.Context()).WithField("id", idStr)
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		writeError(resp, logger, err, "invalid ID", http.StatusBadRequest)
@@ -128,22 +372,198 @@ func (server HTTPServer) ReadUserByIDHandler(resp http.ResponseWriter, req *http
 		writeError(resp, logger, err, "failed to read user", http.StatusInternalServerError)
 		return
 	}
-	bytes, err := user.Marshal()
+	negotiated := negotiatedFrom(req.Context())
+	bytes, err := negotiated.marshalUser(user)
 	if err != nil {
 		writeError(resp, logger, err, "failed to serialise user as JSON", http.StatusInternalServerError)
 		return
 	}
+	writeResponseAs(resp, logger, negotiated.MediaType, bytes)
+}
+
+// DeleteUserHandler deletes the stored user corresponding to the provided ID.
+func (server HTTPServer) DeleteUserHandler(resp http.ResponseWriter, req *http.Request) {
+	idStr := mux.Vars(req)["id"]
+	logger := logging.FromContext(req.Context()).WithField("id", idStr)
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		writeError(resp, logger, err, "invalid ID", http.StatusBadRequest)
+		return
+	}
+	deleter, ok := server.db.(db.Deleter)
+	if !ok {
+		writeError(resp, logger, fmt.Errorf("%T does not support deleting users", server.db), "failed to delete user", http.StatusNotImplemented)
+		return
+	}
+	switch err := deleter.DeleteUser(req.Context(), id); err {
+	case nil:
+		resp.WriteHeader(http.StatusNoContent)
+	case db.ErrNotFound:
+		writeError(resp, logger, err, "failed to delete user", http.StatusNotFound)
+	case db.ErrNotSupported:
+		writeError(resp, logger, err, "failed to delete user", http.StatusNotImplemented)
+	default:
+		writeError(resp, logger, err, "failed to delete user", http.StatusInternalServerError)
+	}
+}
+
+// heartbeatInterval is how often a comment is sent on idle Server-Sent Events streams, to keep connections alive.
+// It ought to be shorter than --http-write-timeout, which defaults to 15s, for heartbeats to be sent at all.
+const heartbeatInterval = 5 * time.Second
+
+// WatchUsersHandler streams changes to users as Server-Sent Events, identified by the ID of the event recording them.
+// Clients resume from where they left off by sending the ID of the last change they received in the Last-Event-ID header,
+// or get all changes since the beginning by sending 0. Otherwise, clients only get the changes made from now on.
+// N.B.: streams are still subject to --http-write-timeout, upon which clients are expected to reconnect and resume.
+func (server HTTPServer) WatchUsersHandler(resp http.ResponseWriter, req *http.Request) {
+	lastEventID := req.Header.Get("Last-Event-ID")
+	logger := logging.FromContext(req.Context()).WithField("lastEventID", lastEventID)
+	watcher, ok := server.db.(db.Watcher)
+	if !ok {
+		writeError(resp, logger, fmt.Errorf("%T does not support watching users", server.db), "failed to watch users", http.StatusNotImplemented)
+		return
+	}
+	flusher, ok := resp.(http.Flusher)
+	if !ok {
+		writeError(resp, logger, fmt.Errorf("%T does not support flushing", resp), "failed to watch users", http.StatusInternalServerError)
+		return
+	}
+	afterEventID := db.LatestEvent // New clients only get new changes, rather than the whole history.
+	if len(lastEventID) > 0 {
+		id, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil {
+			writeError(resp, logger, err, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		afterEventID = id
+	}
+	changes, err := watcher.WatchUsers(req.Context(), afterEventID)
+	if err == db.ErrNotSupported {
+		writeError(resp, logger, err, "failed to watch users", http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		writeError(resp, logger, err, "failed to watch users", http.StatusInternalServerError)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.Header().Set("Connection", "keep-alive")
+	resp.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	negotiated := negotiatedFrom(req.Context())
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case change, ok := <-changes:
+			if !ok {
+				return
+			}
+			bytes, err := negotiated.marshalUser(change.User)
+			if err != nil {
+				logger.WithField("err", err).Error("failed to serialise user as JSON")
+				return
+			}
+			if _, err := fmt.Fprintf(resp, "id: %v\nevent: %v\ndata: %s\n\n", change.ID, change.Type, bytes); err != nil {
+				logger.WithField("err", err).Warn("failed to write user change")
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(resp, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// ReplayEventsHandler marks all events from the provided ID onwards as pending, so that they are delivered again.
+func (server HTTPServer) ReplayEventsHandler(resp http.ResponseWriter, req *http.Request) {
+	fromStr := req.URL.Query().Get("from")
+	logger := logging.FromContext(req.Context()).WithField("from", fromStr)
+	outbox, ok := server.db.(db.Outbox)
+	if !ok {
+		writeError(resp, logger, fmt.Errorf("%T does not support events", server.db), "failed to replay events", http.StatusNotImplemented)
+		return
+	}
+	fromID, err := strconv.ParseInt(fromStr, 10, 64)
+	if err != nil {
+		writeError(resp, logger, err, "invalid event ID", http.StatusBadRequest)
+		return
+	}
+	replayed, err := outbox.ReplayEvents(req.Context(), fromID)
+	if err == db.ErrNotSupported {
+		writeError(resp, logger, err, "failed to replay events", http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		writeError(resp, logger, err, "failed to replay events", http.StatusInternalServerError)
+		return
+	}
+	bytes, err := json.Marshal(map[string]int64{"replayed": replayed})
+	if err != nil {
+		writeError(resp, logger, err, "failed to serialise replayed events count as JSON", http.StatusInternalServerError)
+		return
+	}
 	writeResponse(resp, logger, bytes)
 }
 
+// Error is the body of error responses. Its request ID lets clients report errors, and operators find the matching logs.
+type Error struct {
+	Error     string `json:"error"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// EmailTakenProblem is the type of problems reported when creating an user with the email of another one.
+const EmailTakenProblem = "urn:kds:problem:email-taken"
+
+// Problem is the body of error responses detailing why a request conflicts with the state of the server, as per RFC 7807.
+type Problem struct {
+	Type         string `json:"type"`
+	Title        string `json:"title"`
+	Status       int    `json:"status"`
+	Detail       string `json:"detail,omitempty"`
+	Instance     string `json:"instance,omitempty"`
+	ExistingUser string `json:"existingUser,omitempty"` // URL of the user the request conflicts with, if known.
+	RequestID    string `json:"requestId,omitempty"`
+}
+
+// writeProblem responds with the provided problem, along with the request's ID, set by LogRequests.
+func writeProblem(resp http.ResponseWriter, problem Problem) {
+	problem.RequestID = resp.Header().Get(RequestIDHeader)
+	bytes, _ := json.Marshal(problem) // Cannot fail.
+	resp.Header().Set("Content-Type", "application/problem+json")
+	resp.Header().Set("X-Content-Type-Options", "nosniff")
+	resp.WriteHeader(problem.Status)
+	resp.Write(bytes)
+}
+
+// writeError logs the provided error, and responds with the provided status and message, but not the error itself,
+// which may reveal internal details.
 func writeError(resp http.ResponseWriter, logger *log.Entry, err error, message string, status int) {
-	logger.WithField("err", err).Error(message)
+	logger.WithField("err", err).WithField("status", status).Error(message)
+	writeErrorBody(resp, message, status)
+}
+
+// writeErrorBody responds with the provided status and message, along with the request's ID, set by LogRequests.
+func writeErrorBody(resp http.ResponseWriter, message string, status int) {
+	bytes, _ := json.Marshal(Error{Error: message, RequestID: resp.Header().Get(RequestIDHeader)}) // Cannot fail.
+	resp.Header().Set("Content-Type", "application/json")
+	resp.Header().Set("X-Content-Type-Options", "nosniff")
 	resp.WriteHeader(status)
+	resp.Write(bytes)
 }
 
 func writeResponse(resp http.ResponseWriter, logger *log.Entry, bytes []byte) {
+	writeResponseAs(resp, logger, "application/json", bytes)
+}
+
+func writeResponseAs(resp http.ResponseWriter, logger *log.Entry, mediaType string, bytes []byte) {
+	resp.Header().Set("Content-Type", mediaType)
 	resp.WriteHeader(http.StatusOK)
-	resp.Header().Set("Content-Type", "application/json")
 	bytesWritten, err := resp.Write(bytes)
 	logger = logger.WithField("bytesWritten", bytesWritten).WithField("bytes", len(bytes))
 	if len(bytes) != bytesWritten {
@@ -1,18 +1,25 @@
 package server_test
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"             // Better HTTP API.
 	"github.com/stretchr/testify/assert" // More readable test assertions.
 
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/auth"
 	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db/dbtest"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/metrics"
 	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/server"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/version"
 )
 
 const (
@@ -29,11 +36,12 @@ func TestCreateAndReadUsers(t *testing.T) {
 	req := get(t, "/")
 	resp := serve(req, server)
 	assert.Equal(t, http.StatusOK, resp.Code)
-	assert.Equal(t, "[{\"method\":\"GET\",\"path\":\"/\"},{\"method\":\"GET\",\"path\":\"/healthz\"},{\"method\":\"POST\",\"path\":\"/users\"},{\"method\":\"GET\",\"path\":\"/users\"},{\"method\":\"GET\",\"path\":\"/users/{id:[0-9]+}\"}]", body(t, resp.Body))
+	assert.Equal(t, "[{\"method\":\"GET\",\"path\":\"/\"},{\"method\":\"GET\",\"path\":\"/healthz\"},{\"method\":\"GET\",\"path\":\"/livez\"},{\"method\":\"GET\",\"path\":\"/version\"},{\"method\":\"POST\",\"path\":\"/users\"},{\"method\":\"GET\",\"path\":\"/users\"},{\"method\":\"GET\",\"path\":\"/users/stats\"},{\"method\":\"GET\",\"path\":\"/users/search\"},{\"method\":\"GET\",\"path\":\"/users/watch\"},{\"method\":\"GET\",\"path\":\"/users/{id:[0-9]+}\"},{\"method\":\"DELETE\",\"path\":\"/users/{id:[0-9]+}\"},{\"method\":\"POST\",\"path\":\"/events/replay\"},{\"method\":\"POST\",\"path\":\"/v1/users\"},{\"method\":\"GET\",\"path\":\"/v1/users\"},{\"method\":\"GET\",\"path\":\"/v1/users/stats\"},{\"method\":\"GET\",\"path\":\"/v1/users/search\"},{\"method\":\"GET\",\"path\":\"/v1/users/watch\"},{\"method\":\"GET\",\"path\":\"/v1/users/{id:[0-9]+}\"},{\"method\":\"DELETE\",\"path\":\"/v1/users/{id:[0-9]+}\"},{\"method\":\"POST\",\"path\":\"/v1/events/replay\"},{\"method\":\"POST\",\"path\":\"/v2/users\"},{\"method\":\"GET\",\"path\":\"/v2/users\"},{\"method\":\"GET\",\"path\":\"/v2/users/stats\"},{\"method\":\"GET\",\"path\":\"/v2/users/search\"},{\"method\":\"GET\",\"path\":\"/v2/users/{id:[0-9]+}\"},{\"method\":\"DELETE\",\"path\":\"/v2/users/{id:[0-9]+}\"}]", body(t, resp.Body))
 
 	req = get(t, "/healthz")
 	resp = serve(req, server)
 	assert.Equal(t, http.StatusNoContent, resp.Code)
+	assert.Equal(t, version.Version, resp.Header().Get("X-Served-By"))
 	assert.Equal(t, "", body(t, resp.Body))
 
 	req = get(t, "/users")
@@ -42,9 +50,12 @@ func TestCreateAndReadUsers(t *testing.T) {
 	assert.Equal(t, "[]", body(t, resp.Body))
 
 	req = get(t, "/users/1")
+	req.Header.Set("X-Request-ID", "42")
 	resp = serve(req, server)
 	assert.Equal(t, http.StatusNotFound, resp.Code)
-	assert.Equal(t, "", body(t, resp.Body))
+	assert.Equal(t, "42", resp.Header().Get("X-Request-ID"))
+	assert.Equal(t, version.Version, resp.Header().Get("X-Served-By"))
+	assert.Equal(t, "{\"error\":\"failed to read user\",\"requestId\":\"42\"}", body(t, resp.Body))
 
 	req = post(t, "/users", "{\"firstName\":\"Luke\",\"familyName\":\"Skywalker\",\"age\":20}")
 	resp = serve(req, server)
@@ -72,6 +83,173 @@ func TestCreateAndReadUsers(t *testing.T) {
 	resp = serve(req, server)
 	assert.Equal(t, http.StatusOK, resp.Code)
 	assert.Equal(t, "["+lukeSkywalker+","+obiWanKenobi+"]", body(t, resp.Body))
+
+	req = newRequest(t, "DELETE", "/users/1", nil)
+	resp = serve(req, server)
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+
+	req = newRequest(t, "DELETE", "/users/1", nil)
+	resp = serve(req, server)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	req = get(t, "/users")
+	resp = serve(req, server)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "["+obiWanKenobi+"]", body(t, resp.Body))
+}
+
+func TestCreateUserShouldReportWhichFieldIsInvalid(t *testing.T) {
+	database := dbtest.Setup(t)
+	assert.NotNil(t, database)
+	defer dbtest.Cleanup(t, database)
+	server := server.New(database)
+
+	resp := serve(post(t, "/users", "{\"firstName\":\"Luke\",\"age\":-1,\"email\":\"luke@tatooine.org\"}"), server)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, body(t, resp.Body), "\"error\":\"invalid age: expected a non-negative number but got -1\"")
+	users, err := database.ReadUsers(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+}
+
+func TestEmailUniqueness(t *testing.T) {
+	database := dbtest.Setup(t)
+	assert.NotNil(t, database)
+	defer dbtest.Cleanup(t, database)
+	server := server.New(database)
+
+	resp := serve(post(t, "/users", "{\"firstName\":\"Luke\",\"email\":\"Luke@Tatooine.org\"}"), server)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	resp = serve(post(t, "/users", "{\"firstName\":\"Luke\",\"email\":\"Luke <luke@tatooine.org>\"}"), server)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, body(t, resp.Body), "\"error\":\"invalid email: expected an address like luke@tatooine.org but got \\\"Luke \\u003cluke@tatooine.org\\u003e\\\"\"")
+
+	req := post(t, "/v2/users", "{\"name\":{\"first\":\"Darth\"},\"email\":\"luke@tatooine.org\"}")
+	req.Header.Set("X-Request-ID", "42")
+	resp = serve(req, server)
+	assert.Equal(t, http.StatusConflict, resp.Code)
+	assert.Equal(t, "application/problem+json", resp.Header().Get("Content-Type"))
+	assert.Equal(t, "{\"type\":\"urn:kds:problem:email-taken\",\"title\":\"Email already taken\",\"status\":409,\"detail\":\"another user already has email luke@tatooine.org, regardless of case\",\"instance\":\"/v2/users\",\"existingUser\":\"/v2/users/1\",\"requestId\":\"42\"}", body(t, resp.Body))
+
+	resp = serve(get(t, "/users?email=LUKE%40tatooine.org"), server)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "[{\"id\":1,\"firstName\":\"Luke\",\"familyName\":\"\",\"age\":0,\"email\":\"Luke@Tatooine.org\"}]", body(t, resp.Body))
+	resp = serve(get(t, "/users?email=leia%40alderaan.org"), server)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "[]", body(t, resp.Body))
+	resp = serve(get(t, "/users?email=leia"), server)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestWatchUsers(t *testing.T) {
+	database := dbtest.Setup(t)
+	assert.NotNil(t, database)
+	defer dbtest.Cleanup(t, database)
+	router := mux.NewRouter()
+	server.New(database).RegisterRoutes(router)
+	httpServer := httptest.NewServer(router)
+	defer httpServer.Close()
+	// Stop watching before closing the server, as closing it otherwise waits for streams to end:
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// New clients only get the changes made from now on:
+	events := watch(ctx, t, httpServer.URL, "")
+	_, err := database.CreateUser(ctx, &domain.User{FirstName: "Luke", FamilyName: "Skywalker", Age: 20})
+	assert.NoError(t, err)
+	assert.Equal(t, "id: 1", next(t, events))
+	assert.Equal(t, "event: user.created", next(t, events))
+	assert.Equal(t, "data: "+lukeSkywalker, next(t, events))
+
+	_, err = database.CreateUser(ctx, &domain.User{FirstName: "Obi-Wan", FamilyName: "Kenobi", Age: 40})
+	assert.NoError(t, err)
+	assert.Equal(t, "id: 2", next(t, events))
+	assert.Equal(t, "event: user.created", next(t, events))
+	assert.Equal(t, "data: "+obiWanKenobi, next(t, events))
+
+	// Resuming after the first change only streams the second one:
+	events = watch(ctx, t, httpServer.URL, "1")
+	assert.Equal(t, "id: 2", next(t, events))
+
+	// Resuming after 0 streams all changes since the beginning:
+	events = watch(ctx, t, httpServer.URL, "0")
+	assert.Equal(t, "id: 1", next(t, events))
+	assert.Equal(t, "event: user.created", next(t, events))
+	assert.Equal(t, "data: "+lukeSkywalker, next(t, events))
+	assert.Equal(t, "id: 2", next(t, events))
+}
+
+// Utility function to watch users, and stream the non-empty lines of the response until the provided context is done.
+func watch(ctx context.Context, t *testing.T, url, lastEventID string) <-chan string {
+	req, err := http.NewRequest("GET", url+"/users/watch", nil)
+	assert.NoError(t, err)
+	if len(lastEventID) > 0 {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	lines := make(chan string)
+	go func() {
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if len(scanner.Text()) == 0 {
+				continue
+			}
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return lines
+}
+
+// Utility function to read the next line streamed, failing the test rather than hanging if none comes.
+func next(t *testing.T, lines <-chan string) string {
+	select {
+	case line := <-lines:
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the next line of the stream")
+		return ""
+	}
+}
+
+func TestReplayEvents(t *testing.T) {
+	database := dbtest.Setup(t)
+	assert.NotNil(t, database)
+	defer dbtest.Cleanup(t, database)
+	server := server.New(database)
+
+	req := post(t, "/events/replay?from=not-an-id", "")
+	resp := serve(req, server)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	req = post(t, "/events/replay?from=1", "")
+	resp = serve(req, server)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "{\"replayed\":0}", body(t, resp.Body))
+}
+
+func TestMetrics(t *testing.T) {
+	database := dbtest.Setup(t)
+	assert.NotNil(t, database)
+	defer dbtest.Cleanup(t, database)
+	registry := metrics.NewRegistry()
+	registry.Counter("requests_total", "Number of requests.").Inc()
+	server := server.New(database)
+	server.ExposeMetrics(registry)
+
+	req := get(t, "/metrics")
+	resp := serve(req, server)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "# HELP requests_total Number of requests.\n# TYPE requests_total counter\nrequests_total 1\n", body(t, resp.Body))
 }
 
 func post(t *testing.T, uri, body string) *http.Request {
@@ -101,3 +279,50 @@ func body(t *testing.T, body *bytes.Buffer) string {
 	assert.NoError(t, err)
 	return string(bytes)
 }
+
+func TestAuthentication(t *testing.T) {
+	database := dbtest.Setup(t)
+	assert.NotNil(t, database)
+	defer dbtest.Cleanup(t, database)
+	authenticator, err := auth.NewAuthenticator(nil, map[string][]string{"reader": {auth.ScopeUsersRead}, "writer": {auth.ScopeUsersWrite}})
+	assert.NoError(t, err)
+	server := server.New(database)
+	server.Authenticate(authenticator)
+	server.ExposeMetrics(metrics.NewRegistry())
+
+	for _, uri := range []string{"/healthz", "/livez", "/metrics", "/version"} {
+		resp := serve(get(t, uri), server)
+		assert.True(t, resp.Code < 400, uri)
+	}
+
+	resp := serve(post(t, "/users", "{\"firstName\":\"Luke\"}"), server)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	resp = serve(withAPIKey(post(t, "/users", "{\"firstName\":\"Luke\"}"), "reader"), server)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	resp = serve(withAPIKey(post(t, "/users", "{\"firstName\":\"Luke\"}"), "writer"), server)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+
+	resp = serve(get(t, "/users/1"), server)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	resp = serve(withAPIKey(get(t, "/users/1"), "reader"), server)
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestProbeRoutes(t *testing.T) {
+	database := dbtest.Setup(t)
+	assert.NotNil(t, database)
+	defer dbtest.Cleanup(t, database)
+	router := mux.NewRouter()
+	server.New(database).RegisterProbeRoutes(router)
+
+	for uri, status := range map[string]int{"/healthz": http.StatusNoContent, "/livez": http.StatusNoContent, "/users": http.StatusNotFound} {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, get(t, uri))
+		assert.Equal(t, status, resp.Code, uri)
+	}
+}
+
+func withAPIKey(req *http.Request, key string) *http.Request {
+	req.Header.Set(auth.APIKeyHeader, key)
+	return req
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+)
+
+// Parameters of statistics, unless clients ask for others.
+const (
+	defaultStatsMinutes = 60
+	maxStatsMinutes     = 7 * 24 * 60
+	defaultStatsTop     = 5
+	maxStatsTop         = 100
+)
+
+// Stats are statistics about users, as computed at ComputedAt, which is older than the request if these were cached.
+type Stats struct {
+	*db.UserStats
+	Minutes    int       `json:"minutes"` // Users created in the last Minutes are counted in CreatedSince.
+	ComputedAt time.Time `json:"computedAt"`
+}
+
+// statsKey identifies statistics computed for the same parameters.
+type statsKey struct {
+	minutes int
+	top     int
+}
+
+// StatsCache caches statistics for a short time, so that dashboards polling them frequently do not overload the database.
+// Concurrent requests for the same uncached statistics wait for these to be computed once.
+type StatsCache struct {
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[statsKey]*statsEntry
+	mutex   sync.Mutex // For thread-safe access to the entries.
+}
+
+type statsEntry struct {
+	computing sync.Mutex // Held while computing these statistics, so that these are computed once at a time.
+	stats     *Stats     // Guarded by the cache's mutex, like expires.
+	expires   time.Time
+}
+
+// NewStatsCache creates a new cache of statistics, each cached for the provided TTL.
+func NewStatsCache(ttl time.Duration) (*StatsCache, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("invalid stats cache TTL: expected a positive duration but got %v", ttl)
+	}
+	return &StatsCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[statsKey]*statsEntry),
+	}, nil
+}
+
+// get returns the cached statistics for the provided key, or computes these, and whether these were cached.
+func (cache *StatsCache) get(key statsKey, compute func() (*Stats, error)) (*Stats, bool, error) {
+	entry, stats := cache.lookup(key)
+	if stats != nil {
+		return stats, true, nil
+	}
+	entry.computing.Lock()
+	defer entry.computing.Unlock()
+	if _, stats := cache.lookup(key); stats != nil {
+		return stats, true, nil // Computed by a concurrent request, while waiting for it.
+	}
+	stats, err := compute()
+	if err != nil {
+		return nil, false, err // Not cached, so that the next request tries again.
+	}
+	cache.mutex.Lock()
+	entry.stats, entry.expires = stats, cache.now().Add(cache.ttl)
+	cache.mutex.Unlock()
+	return stats, false, nil
+}
+
+// lookup returns the entry for the provided key, creating it if needed, and its statistics, unless these expired.
+func (cache *StatsCache) lookup(key statsKey) (*statsEntry, *Stats) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	now := cache.now()
+	entry, ok := cache.entries[key]
+	if !ok {
+		cache.sweep(now)
+		entry = &statsEntry{}
+		cache.entries[key] = entry
+	}
+	if entry.stats != nil && now.Before(entry.expires) {
+		return entry, entry.stats
+	}
+	return entry, nil
+}
+
+// sweep removes expired entries, so that clients varying parameters cannot grow the cache indefinitely.
+// It should be called while holding the mutex.
+func (cache *StatsCache) sweep(now time.Time) {
+	for key, entry := range cache.entries {
+		if entry.stats != nil && !now.Before(entry.expires) {
+			delete(cache.entries, key)
+		}
+	}
+}
+
+// parseParam parses the provided query parameter, which defaults to defaultValue if empty.
+func parseParam(value string, defaultValue, max int) (int, error) {
+	if len(value) == 0 {
+		return defaultValue, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 1 || i > max {
+		return 0, fmt.Errorf("expected a number between 1 and %v but got %q", max, value)
+	}
+	return i, nil
+}
+
+// UserStatsHandler returns statistics about users: how many there are, how many were created in the last ?minutes=,
+// their ages, and their ?top= most common family names.
+func (server HTTPServer) UserStatsHandler(resp http.ResponseWriter, req *http.Request) {
+	params := req.URL.Query()
+	logger := logging.FromContext(req.Context())
+	aggregator, ok := server.db.(db.Aggregator)
+	if !ok {
+		writeError(resp, logger, fmt.Errorf("%T does not support aggregating users", server.db), "failed to compute stats", http.StatusNotImplemented)
+		return
+	}
+	minutes, err := parseParam(params.Get("minutes"), defaultStatsMinutes, maxStatsMinutes)
+	if err != nil {
+		writeError(resp, logger, err, "invalid minutes", http.StatusBadRequest)
+		return
+	}
+	top, err := parseParam(params.Get("top"), defaultStatsTop, maxStatsTop)
+	if err != nil {
+		writeError(resp, logger, err, "invalid top", http.StatusBadRequest)
+		return
+	}
+	compute := func() (*Stats, error) {
+		return computeStats(req.Context(), aggregator, minutes, top)
+	}
+	var stats *Stats
+	if server.statsCache != nil {
+		var cached bool
+		stats, cached, err = server.statsCache.get(statsKey{minutes: minutes, top: top}, compute)
+		if cached {
+			resp.Header().Set("X-Cache", "hit")
+		} else {
+			resp.Header().Set("X-Cache", "miss")
+		}
+	} else {
+		stats, err = compute()
+	}
+	if err == db.ErrNotSupported {
+		writeError(resp, logger, err, "failed to compute stats", http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		writeError(resp, logger, err, "failed to compute stats", http.StatusInternalServerError)
+		return
+	}
+	bytes, err := json.Marshal(stats)
+	if err != nil {
+		writeError(resp, logger, err, "failed to serialise stats as JSON", http.StatusInternalServerError)
+		return
+	}
+	writeResponseAs(resp, logger, negotiatedFrom(req.Context()).MediaType, bytes)
+}
+
+func computeStats(ctx context.Context, aggregator db.Aggregator, minutes, top int) (*Stats, error) {
+	now := time.Now().UTC()
+	stats, err := aggregator.UserStats(ctx, now.Add(-time.Duration(minutes)*time.Minute), top)
+	if err != nil {
+		return nil, err
+	}
+	return &Stats{UserStats: stats, Minutes: minutes, ComputedAt: now}, nil
+}
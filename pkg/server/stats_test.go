@@ -0,0 +1,82 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db/dbtest"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/server"
+)
+
+func TestUserStats(t *testing.T) {
+	database := dbtest.Setup(t)
+	assert.NotNil(t, database)
+	defer dbtest.Cleanup(t, database)
+	api := server.New(database)
+	for _, user := range []domain.User{
+		{FirstName: "Luke", FamilyName: "Skywalker", Age: 19},
+		{FirstName: "Anakin", FamilyName: "Skywalker", Age: 42},
+	} {
+		_, err := database.CreateUser(context.Background(), &user)
+		assert.NoError(t, err)
+	}
+
+	resp := serve(get(t, "/users/stats?minutes=5&top=1"), api)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "", resp.Header().Get("X-Cache")) // Not cached by default.
+	stats := userStats(t, resp.Body.Bytes())
+	assert.Equal(t, 2, stats.Total)
+	assert.Equal(t, 2, stats.CreatedSince)
+	assert.Equal(t, 5, stats.Minutes)
+	assert.Equal(t, 19, *stats.Ages.Min)
+	assert.Equal(t, 42, *stats.Ages.Max)
+	assert.Equal(t, 30.5, *stats.Ages.Average)
+	assert.Equal(t, 2, len(stats.Ages.Buckets))
+	assert.Equal(t, 1, len(stats.TopFamilyNames))
+	assert.Equal(t, "Skywalker", stats.TopFamilyNames[0].Name)
+
+	for _, uri := range []string{"/users/stats?minutes=0", "/users/stats?minutes=x", "/users/stats?top=101"} {
+		resp = serve(get(t, uri), api)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, uri)
+	}
+}
+
+func TestUserStatsShouldBeCached(t *testing.T) {
+	database := dbtest.Setup(t)
+	assert.NotNil(t, database)
+	defer dbtest.Cleanup(t, database)
+	api := server.New(database)
+	cache, err := server.NewStatsCache(time.Hour)
+	assert.NoError(t, err)
+	api.CacheStats(cache)
+
+	resp := serve(get(t, "/users/stats"), api)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "miss", resp.Header().Get("X-Cache"))
+	computedAt := userStats(t, resp.Body.Bytes()).ComputedAt
+
+	_, err = database.CreateUser(context.Background(), &domain.User{FirstName: "Luke"})
+	assert.NoError(t, err)
+	resp = serve(get(t, "/users/stats"), api)
+	assert.Equal(t, "hit", resp.Header().Get("X-Cache"))
+	stats := userStats(t, resp.Body.Bytes())
+	assert.Equal(t, 0, stats.Total) // Until the cached statistics expire.
+	assert.True(t, computedAt.Equal(stats.ComputedAt))
+
+	// Statistics computed for other parameters are cached separately:
+	resp = serve(get(t, "/users/stats?top=1"), api)
+	assert.Equal(t, "miss", resp.Header().Get("X-Cache"))
+	assert.Equal(t, 1, userStats(t, resp.Body.Bytes()).Total)
+}
+
+func userStats(t *testing.T, bytes []byte) server.Stats {
+	stats := server.Stats{}
+	assert.NoError(t, json.Unmarshal(bytes, &stats))
+	return stats
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus" // Better Logging.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/filewatch"
+)
+
+// tlsVersions maps the supported values of --http-tls-min-version to TLS versions.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": 0x0304, // tls.VersionTLS13, only defined, and supported, as of Go 1.12.
+}
+
+// CertReloader serves a TLS certificate, and optionally verifies clients against a CA, both read from files,
+// which are reloaded when changed, e.g. when Kubernetes updates the secret they are mounted from.
+// Connections established with the previous certificate are left untouched.
+type CertReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	minVersion   uint16
+	certificate  *tls.Certificate
+	clientCAs    *x509.CertPool
+	mutex        sync.RWMutex // For thread-safe access to the certificate and client CAs.
+}
+
+// NewCertReloader creates a new CertReloader, and loads the provided files. clientCAFile is optional.
+func NewCertReloader(certFile, keyFile, clientCAFile string, minVersion uint16) (*CertReloader, error) {
+	reloader := &CertReloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+		minVersion:   minVersion,
+	}
+	if err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// Reload reads the certificate, key, and client CA files again. The current ones are kept if any of these is invalid.
+func (reloader *CertReloader) Reload() error {
+	certificate, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to load TLS certificate")
+	}
+	var clientCAs *x509.CertPool
+	if len(reloader.clientCAFile) > 0 {
+		bytes, err := ioutil.ReadFile(reloader.clientCAFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to read client CA file")
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(bytes) {
+			return fmt.Errorf("invalid client CA file %v: no PEM-encoded certificate found", reloader.clientCAFile)
+		}
+	}
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+	reloader.certificate = &certificate
+	reloader.clientCAs = clientCAs
+	return nil
+}
+
+// Watch reloads the certificate, key, and client CA files whenever they change, checking every interval, until the provided context is done.
+func (reloader *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	paths := []string{reloader.certFile, reloader.keyFile}
+	if len(reloader.clientCAFile) > 0 {
+		paths = append(paths, reloader.clientCAFile)
+	}
+	filewatch.Poll(ctx, interval, paths, func() error {
+		logger := log.WithField("certFile", reloader.certFile).WithField("clientCAFile", reloader.clientCAFile)
+		if err := reloader.Reload(); err != nil {
+			// Kubernetes may not have updated all files yet, so keep serving the current certificate, and try again later:
+			logger.WithField("err", err).Error("failed to reload TLS certificate, keeping the current one")
+			return err
+		}
+		logger.Info("reloaded TLS certificate")
+		return nil
+	})
+}
+
+// TLSConfig returns a TLS configuration serving the current certificate, and requiring clients to present a certificate
+// signed by the current client CA, if any.
+func (reloader *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:         reloader.minVersion,
+		GetCertificate:     reloader.getCertificate, // Also lets http.Server.ServeTLS know a certificate is configured.
+		GetConfigForClient: reloader.configForClient,
+	}
+}
+
+func (reloader *CertReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.mutex.RLock()
+	defer reloader.mutex.RUnlock()
+	return reloader.certificate, nil
+}
+
+func (reloader *CertReloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	reloader.mutex.RLock()
+	defer reloader.mutex.RUnlock()
+	config := &tls.Config{
+		MinVersion:   reloader.minVersion,
+		Certificates: []tls.Certificate{*reloader.certificate},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if reloader.clientCAs != nil {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.ClientCAs = reloader.clientCAs
+	}
+	return config, nil
+}
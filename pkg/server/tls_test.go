@@ -0,0 +1,213 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/server"
+)
+
+func TestCertReloaderShouldServeNewCertificateOnceChanged(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir) // Clean-up.
+	ca := newCA(t, dir)
+	certFile, keyFile := ca.writeCert(t, dir, "server", 1)
+	reloader, err := server.NewCertReloader(certFile, keyFile, "", tls.VersionTLS12)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Watch(ctx, 5*time.Millisecond)
+	url, stop := serveTLS(t, reloader.TLSConfig())
+	defer stop()
+
+	client := ca.client(nil, 0)
+	assert.Equal(t, int64(1), serialNumber(t, client, url))
+
+	ca.writeCert(t, dir, "server", 2)
+	assert.NoError(t, waitFor(func() bool { return serialNumber(t, client, url) == 2 }))
+}
+
+func TestCertReloaderShouldKeepCurrentCertificateWhenNewOneIsInvalid(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir) // Clean-up.
+	ca := newCA(t, dir)
+	certFile, keyFile := ca.writeCert(t, dir, "server", 1)
+	reloader, err := server.NewCertReloader(certFile, keyFile, "", tls.VersionTLS12)
+	assert.NoError(t, err)
+	url, stop := serveTLS(t, reloader.TLSConfig())
+	defer stop()
+
+	assert.NoError(t, ioutil.WriteFile(certFile, []byte("not-a-certificate"), 0600))
+	assert.Error(t, reloader.Reload())
+	assert.Equal(t, int64(1), serialNumber(t, ca.client(nil, 0), url))
+}
+
+func TestCertReloaderShouldRequireClientCertificatesSignedByClientCA(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir) // Clean-up.
+	ca := newCA(t, dir)
+	certFile, keyFile := ca.writeCert(t, dir, "server", 1)
+	clientCertFile, clientKeyFile := ca.writeCert(t, dir, "client", 2)
+	reloader, err := server.NewCertReloader(certFile, keyFile, ca.file, tls.VersionTLS12)
+	assert.NoError(t, err)
+	url, stop := serveTLS(t, reloader.TLSConfig())
+	defer stop()
+
+	_, err = ca.client(nil, 0).Get(url)
+	assert.Error(t, err)
+
+	clientCert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), serialNumber(t, ca.client(&clientCert, 0), url))
+}
+
+func TestCertReloaderShouldRejectClientsBelowMinimumVersion(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir) // Clean-up.
+	ca := newCA(t, dir)
+	certFile, keyFile := ca.writeCert(t, dir, "server", 1)
+	reloader, err := server.NewCertReloader(certFile, keyFile, "", tls.VersionTLS12)
+	assert.NoError(t, err)
+	url, stop := serveTLS(t, reloader.TLSConfig())
+	defer stop()
+
+	_, err = ca.client(nil, tls.VersionTLS11).Get(url)
+	assert.Error(t, err)
+}
+
+func TestParsingTLSArguments(t *testing.T) {
+	reloader, err := parseArgs(t, []string{}).CertReloader()
+	assert.NoError(t, err)
+	assert.Nil(t, reloader)
+
+	_, err = parseArgs(t, []string{"--tls-cert-file", "server.crt"}).CertReloader()
+	assert.EqualError(t, err, "invalid TLS configuration: both --tls-cert-file and --tls-key-file are required")
+	_, err = parseArgs(t, []string{"--tls-client-ca-file", "ca.crt"}).CertReloader()
+	assert.EqualError(t, err, "invalid --tls-client-ca-file: requires --tls-cert-file and --tls-key-file")
+	_, err = parseArgs(t, []string{"--tls-cert-file", "server.crt", "--tls-key-file", "server.key", "--tls-min-version", "1.4"}).CertReloader()
+	assert.EqualError(t, err, "invalid --tls-min-version: expected 1.0, 1.1, 1.2 or 1.3 but got \"1.4\"")
+}
+
+// testCA signs certificates for localhost.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	file string
+}
+
+func newCA(t *testing.T, dir string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1337),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	file := filepath.Join(dir, "ca.crt")
+	assert.NoError(t, ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	return &testCA{cert: cert, key: key, pool: pool, file: file}
+}
+
+// writeCert writes a certificate, with the provided serial number, and its key, to <dir>/<name>.crt and <dir>/<name>.key.
+func (ca *testCA) writeCert(t *testing.T, dir, name string, serialNumber int64) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serialNumber),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	// Write the key first, so that a reload triggered between both writes fails, rather than pairing mismatched files:
+	assert.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	assert.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	return certFile, keyFile
+}
+
+// client returns an HTTP client trusting this CA, presenting the provided certificate, if any,
+// and using at most the provided TLS version, if any.
+func (ca *testCA) client(cert *tls.Certificate, maxVersion uint16) *http.Client {
+	config := &tls.Config{RootCAs: ca.pool, MaxVersion: maxVersion}
+	if cert != nil {
+		config.Certificates = []tls.Certificate{*cert}
+	}
+	return &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: config, DisableKeepAlives: true},
+	}
+}
+
+// serveTLS serves HTTPS with the provided configuration, and returns the server's URL, and a function to stop it.
+func serveTLS(t *testing.T, config *tls.Config) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	httpServer := &http.Server{
+		Handler:   http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) { resp.WriteHeader(http.StatusNoContent) }),
+		TLSConfig: config,
+	}
+	go httpServer.ServeTLS(listener, "", "")
+	return "https://" + listener.Addr().String(), func() { httpServer.Close() }
+}
+
+// serialNumber returns the serial number of the certificate served at the provided URL, or -1 if the request failed.
+func serialNumber(t *testing.T, client *http.Client, url string) int64 {
+	resp, err := client.Get(url)
+	if err != nil {
+		return -1
+	}
+	defer resp.Body.Close()
+	return resp.TLS.PeerCertificates[0].SerialNumber.Int64()
+}
+
+func waitFor(condition func() bool) error {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return context.DeadlineExceeded
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "tls")
+	assert.NoError(t, err)
+	return dir
+}
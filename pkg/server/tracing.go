@@ -0,0 +1,51 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux" // Better HTTP API.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/tracing"
+)
+
+// traceRequests records a span for each request, continuing the trace propagated by the caller, if any, and adds the
+// trace's ID to the request's logger. It expects requests to be logged by LogRequests first.
+func traceRequests(tracer *tracing.Tracer) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			ctx := req.Context()
+			if parent, ok := tracing.Extract(req.Header); ok {
+				ctx = tracing.ContextWithRemoteParent(ctx, parent)
+			}
+			name, template := "", req.URL.Path
+			if current := mux.CurrentRoute(req); current != nil {
+				name = current.GetName()
+				if pathTemplate, err := current.GetPathTemplate(); err == nil {
+					template = pathTemplate
+				}
+			}
+			ctx, span := tracer.Start(ctx, fmt.Sprintf("%v %v", req.Method, template), tracing.KindServer)
+			defer span.End()
+			span.SetAttribute("http.method", req.Method)
+			span.SetAttribute("http.route", template)
+			span.SetAttribute("http.target", req.URL.EscapedPath()) // Without the query, which may contain PII, e.g. ?email=
+			span.SetAttribute("http.route_name", name)
+			span.SetAttribute("net.peer.addr", req.RemoteAddr)
+
+			logged, ok := resp.(*loggedResponse)
+			if !ok {
+				logged = &loggedResponse{ResponseWriter: resp}
+			}
+			logger := logging.FromContext(ctx).WithField("traceId", span.Context.TraceID.String()).WithField("spanId", span.Context.SpanID.String())
+			next.ServeHTTP(logged, req.WithContext(logging.NewContext(ctx, logger)))
+
+			status := logged.Status()
+			span.SetAttribute("http.status_code", status)
+			if status >= http.StatusInternalServerError {
+				span.SetError(fmt.Errorf("%v %v", status, http.StatusText(status)))
+			}
+		})
+	}
+}
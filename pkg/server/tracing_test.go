@@ -0,0 +1,50 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"             // Better HTTP API.
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/server"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/tracing"
+)
+
+func TestTraceShouldContinueCallersTraceAndRecordRouteSpans(t *testing.T) {
+	var out bytes.Buffer
+	tracer, err := tracing.NewTracer(tracing.NewNDJSONExporter(&out), 1)
+	assert.NoError(t, err)
+	api := server.New(db.NewInMemoryDB())
+	api.Trace(tracer)
+	router := mux.NewRouter()
+	api.RegisterRoutes(router)
+
+	req := httptest.NewRequest("GET", "/users/42?email=luke%40tatooine.org", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.NoError(t, tracer.Close())
+
+	var span map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimSpace(out.String())), &span))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span["traceId"])
+	assert.Equal(t, "00f067aa0ba902b7", span["parentSpanId"])
+	assert.Equal(t, "GET /users/{id:[0-9]+}", span["name"])
+	assert.Equal(t, "server", span["kind"])
+	assert.Equal(t, map[string]interface{}{
+		"http.method":      "GET",
+		"http.route":       "/users/{id:[0-9]+}",
+		"http.route_name":  "users_id",
+		"http.target":      "/users/42", // Without the query, which may contain PII.
+		"http.status_code": float64(404),
+		"net.peer.addr":    "192.0.2.1:1234",
+	}, span["attributes"])
+	assert.NotContains(t, span, "error")
+}
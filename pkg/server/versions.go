@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/domain"
+)
+
+// Versions of the users API. Each is served under its own path prefix, e.g. /v2/users, or under the unversioned paths,
+// e.g. /users, when requested via its vendor media type in the Accept header, e.g. application/vnd.kds.v2+json.
+// Unversioned paths serve V1 by default, so that existing clients keep working.
+const (
+	V1 = 1
+	V2 = 2
+)
+
+// VendorMediaType returns the media type clients may accept to request the provided version of the API.
+func VendorMediaType(version int) string {
+	return fmt.Sprintf("application/vnd.kds.v%v+json", version)
+}
+
+var vendorMediaType = regexp.MustCompile(`^application/vnd\.kds\.v([0-9]+)\+json$`)
+
+// genericMediaTypes are the media types in Accept which let the server pick the version, rather than the client.
+var genericMediaTypes = map[string]bool{"application/json": true, "application/*": true, "*/*": true}
+
+// negotiated is the version of the API, and the media type of responses, negotiated for a request.
+type negotiated struct {
+	Version     int
+	MediaType   string
+	PathVersion int // Version in the request's path, or 0 if unversioned.
+}
+
+var defaultNegotiated = negotiated{Version: V1, MediaType: "application/json"}
+
+type negotiatedKey struct{}
+
+// negotiatedFrom returns the representation negotiated for the request of the provided context, or V1 if none was.
+func negotiatedFrom(ctx context.Context) negotiated {
+	if n, ok := ctx.Value(negotiatedKey{}).(negotiated); ok {
+		return n
+	}
+	return defaultNegotiated
+}
+
+// negotiate picks the version of the API, among the ones supported by the route, to serve a request for the provided path
+// version, 0 if unversioned, and Accept header. The path's version wins, but conflicting vendor media types are not acceptable.
+// Accept headers without any vendor media type are ignored, as they were before versioning, e.g. for browsers' text/html.
+func negotiate(pathVersion int, supported []int, accept string) (negotiated, bool) {
+	fallback := defaultNegotiated
+	fallback.PathVersion = pathVersion
+	if pathVersion > 0 {
+		fallback.Version = pathVersion
+	}
+	best, bestQ := negotiated{}, 0.0
+	vendored := false
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qStr, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qStr, 64); err != nil {
+				continue
+			}
+		}
+		candidate := fallback
+		if match := vendorMediaType.FindStringSubmatch(mediaType); match != nil {
+			vendored = true
+			version, _ := strconv.Atoi(match[1]) // Cannot fail, as the regexp only matches digits.
+			if !supports(supported, version) || (pathVersion > 0 && version != pathVersion) {
+				continue
+			}
+			candidate = negotiated{Version: version, MediaType: mediaType, PathVersion: pathVersion}
+		} else if !genericMediaTypes[mediaType] {
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = candidate, q
+		}
+	}
+	if bestQ > 0 {
+		return best, true
+	}
+	return fallback, !vendored
+}
+
+func supports(versions []int, version int) bool {
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Deprecation is the schedule of V1's retirement, advertised to clients via the Deprecation and Sunset headers.
+type Deprecation struct {
+	Date   time.Time // Since when V1 is deprecated, or zero if it is not.
+	Sunset time.Time // When V1 will stop being served, or zero if unknown.
+}
+
+// Active returns whether V1 is deprecated.
+func (d Deprecation) Active() bool {
+	return !d.Date.IsZero() || !d.Sunset.IsZero()
+}
+
+// versioned serves the provided handler with the representation negotiated for the provided path version,
+// among the supported ones, or rejects the request with 406 Not Acceptable.
+func (server HTTPServer) versioned(pathVersion int, supported []int, handler http.HandlerFunc) http.HandlerFunc {
+	return func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Add("Vary", "Accept")
+		n, ok := negotiate(pathVersion, supported, req.Header.Get("Accept"))
+		if !ok {
+			writeErrorBody(resp, fmt.Sprintf("not acceptable: expected %v", acceptable(pathVersion, supported)), http.StatusNotAcceptable)
+			return
+		}
+		if n.Version == V1 && server.deprecation.Active() {
+			server.deprecate(resp, req, pathVersion, supported)
+		}
+		handler(resp, req.WithContext(context.WithValue(req.Context(), negotiatedKey{}, n)))
+	}
+}
+
+// acceptable lists the media types acceptable for the provided path version, among the supported ones.
+func acceptable(pathVersion int, supported []int) string {
+	mediaTypes := []string{"application/json"}
+	for _, version := range supported {
+		if pathVersion == 0 || version == pathVersion {
+			mediaTypes = append(mediaTypes, VendorMediaType(version))
+		}
+	}
+	return strings.Join(mediaTypes, " or ")
+}
+
+// deprecate sets the Deprecation and Sunset headers, and links to the V2 equivalent of the requested path, if any.
+func (server HTTPServer) deprecate(resp http.ResponseWriter, req *http.Request, pathVersion int, supported []int) {
+	if !server.deprecation.Date.IsZero() {
+		resp.Header().Set("Deprecation", fmt.Sprintf("@%v", server.deprecation.Date.Unix()))
+	}
+	if !server.deprecation.Sunset.IsZero() {
+		resp.Header().Set("Sunset", server.deprecation.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if supports(supported, V2) {
+		path := req.URL.Path
+		if pathVersion > 0 {
+			path = strings.TrimPrefix(path, versionPrefix(pathVersion))
+		}
+		resp.Header().Add("Link", fmt.Sprintf("<%v%v>; rel=\"successor-version\"", versionPrefix(V2), path))
+	}
+}
+
+func versionPrefix(version int) string {
+	return fmt.Sprintf("/v%v", version)
+}
+
+// userV2 is V2's representation of an user, with its name as a nested object, and its creation time.
+type userV2 struct {
+	ID        int        `json:"id,omitempty"`
+	Name      nameV2     `json:"name"`
+	Age       int        `json:"age"`
+	Email     string     `json:"email,omitempty"`
+	CreatedAt *time.Time `json:"createdAt"` // null for users created before creation times were recorded.
+}
+
+type nameV2 struct {
+	First  string `json:"first"`
+	Family string `json:"family"`
+}
+
+// represent returns the provided user's representation in the negotiated version.
+func (n negotiated) represent(user *domain.User) interface{} {
+	if n.Version == V2 {
+		return userV2{
+			ID:        user.ID,
+			Name:      nameV2{First: user.FirstName, Family: user.FamilyName},
+			Age:       user.Age,
+			Email:     user.Email,
+			CreatedAt: user.CreatedAt,
+		}
+	}
+	v1 := *user
+	v1.CreatedAt = nil // V1's representation predates creation times.
+	return v1
+}
+
+// marshalUser serialises the provided user in the negotiated version.
+func (n negotiated) marshalUser(user *domain.User) ([]byte, error) {
+	return json.Marshal(n.represent(user))
+}
+
+// marshalUsers serialises the provided users in the negotiated version.
+func (n negotiated) marshalUsers(users []*domain.User) ([]byte, error) {
+	represented := make([]interface{}, len(users))
+	for i, user := range users {
+		represented[i] = n.represent(user)
+	}
+	return json.Marshal(represented)
+}
+
+var blankUserV2 = userV2{}
+
+// unmarshalUser deserialises the provided JSON, in the negotiated version, into an user object.
+func (n negotiated) unmarshalUser(jsonBytes []byte) (*domain.User, error) {
+	if n.Version != V2 {
+		return domain.UnmarshalUser(jsonBytes)
+	}
+	user := userV2{}
+	if err := json.Unmarshal(jsonBytes, &user); err != nil {
+		return nil, err
+	}
+	if user == blankUserV2 {
+		return nil, fmt.Errorf("invalid JSON: doesn't yield a valid user: %v", string(jsonBytes))
+	}
+	return &domain.User{ID: user.ID, FirstName: user.Name.First, FamilyName: user.Name.Family, Age: user.Age, Email: user.Email}, nil
+}
+
+// location returns the URL of the user with the provided ID, under the path version the request was made to.
+func (n negotiated) location(id int) string {
+	if n.PathVersion > 0 {
+		return fmt.Sprintf("%v/users/%v", versionPrefix(n.PathVersion), id)
+	}
+	return fmt.Sprintf("/users/%v", id)
+}
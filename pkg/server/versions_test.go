@@ -0,0 +1,139 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db/dbtest"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/server"
+)
+
+func TestVersionedPathsAndMediaTypes(t *testing.T) {
+	database := dbtest.Setup(t)
+	assert.NotNil(t, database)
+	defer dbtest.Cleanup(t, database)
+	api := server.New(database)
+
+	resp := serve(post(t, "/v2/users", "{\"name\":{\"first\":\"Luke\",\"family\":\"Skywalker\"},\"age\":20}"), api)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	assert.Equal(t, "/v2/users/1", resp.Header().Get("Location"))
+
+	// V1, under its path prefix or the unversioned alias, is left unchanged:
+	for _, uri := range []string{"/v1/users/1", "/users/1"} {
+		resp = serve(get(t, uri), api)
+		assert.Equal(t, http.StatusOK, resp.Code, uri)
+		assert.Equal(t, "application/json", resp.Header().Get("Content-Type"), uri)
+		assert.Equal(t, "Accept", resp.Header().Get("Vary"), uri)
+		assert.Equal(t, lukeSkywalker, body(t, resp.Body), uri)
+	}
+	resp = serve(get(t, "/v1/users"), api)
+	assert.Equal(t, "["+lukeSkywalker+"]", body(t, resp.Body))
+
+	// V2, under its path prefix or the unversioned alias via its vendor media type:
+	resp = serve(get(t, "/v2/users/1"), api)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+	assertV2(t, body(t, resp.Body))
+	resp = serve(withAccept(get(t, "/users/1"), "application/vnd.kds.v2+json"), api)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "application/vnd.kds.v2+json", resp.Header().Get("Content-Type"))
+	assertV2(t, body(t, resp.Body))
+	resp = serve(withAccept(get(t, "/v2/users"), "application/vnd.kds.v2+json"), api)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	users := []map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &users))
+	assert.Equal(t, 1, len(users))
+
+	// Creating via the vendor media type expects the corresponding representation:
+	req := withAccept(post(t, "/users", "{\"name\":{\"first\":\"Obi-Wan\",\"family\":\"Kenobi\"},\"age\":40}"), "application/vnd.kds.v2+json")
+	resp = serve(req, api)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	assert.Equal(t, "/users/2", resp.Header().Get("Location"))
+	resp = serve(get(t, "/users/2"), api)
+	assert.Equal(t, obiWanKenobi, body(t, resp.Body))
+
+	// The highest quality acceptable media type wins, falling back on the path's version for generic ones:
+	resp = serve(withAccept(get(t, "/users/1"), "application/vnd.kds.v1+json;q=0.5, application/vnd.kds.v2+json"), api)
+	assert.Equal(t, "application/vnd.kds.v2+json", resp.Header().Get("Content-Type"))
+	resp = serve(withAccept(get(t, "/users/1"), "application/vnd.kds.v3+json, application/json;q=0.1"), api)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, lukeSkywalker, body(t, resp.Body))
+	resp = serve(withAccept(get(t, "/users/1"), "text/html"), api)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, lukeSkywalker, body(t, resp.Body))
+
+	// Unsupported or conflicting versions are not acceptable:
+	req = withAccept(get(t, "/users/1"), "application/vnd.kds.v3+json")
+	req.Header.Set("X-Request-ID", "42")
+	resp = serve(req, api)
+	assert.Equal(t, http.StatusNotAcceptable, resp.Code)
+	assert.Equal(t, "{\"error\":\"not acceptable: expected application/json or application/vnd.kds.v1+json or application/vnd.kds.v2+json\",\"requestId\":\"42\"}", body(t, resp.Body))
+	resp = serve(withAccept(get(t, "/v1/users/1"), "application/vnd.kds.v2+json"), api)
+	assert.Equal(t, http.StatusNotAcceptable, resp.Code)
+	resp = serve(withAccept(get(t, "/users/watch"), "application/vnd.kds.v2+json"), api)
+	assert.Equal(t, http.StatusNotAcceptable, resp.Code)
+	resp = serve(get(t, "/v2/users/watch"), api)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func assertV2(t *testing.T, body string) {
+	user := struct {
+		ID   int `json:"id"`
+		Name struct {
+			First  string `json:"first"`
+			Family string `json:"family"`
+		} `json:"name"`
+		Age       int        `json:"age"`
+		CreatedAt *time.Time `json:"createdAt"`
+	}{}
+	assert.NoError(t, json.Unmarshal([]byte(body), &user))
+	assert.Equal(t, 1, user.ID)
+	assert.Equal(t, "Luke", user.Name.First)
+	assert.Equal(t, "Skywalker", user.Name.Family)
+	assert.Equal(t, 20, user.Age)
+	assert.NotNil(t, user.CreatedAt)
+}
+
+func TestV1DeprecationHeaders(t *testing.T) {
+	database := dbtest.Setup(t)
+	assert.NotNil(t, database)
+	defer dbtest.Cleanup(t, database)
+	api := server.New(database)
+
+	resp := serve(get(t, "/v1/users"), api)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "", resp.Header().Get("Deprecation"))
+	assert.Equal(t, "", resp.Header().Get("Sunset"))
+
+	api.DeprecateV1(server.Deprecation{
+		Date:   time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Sunset: time.Date(2026, time.June, 30, 0, 0, 0, 0, time.UTC),
+	})
+	for uri, successor := range map[string]string{"/v1/users/1": "/v2/users/1", "/users": "/v2/users"} {
+		resp = serve(get(t, uri), api)
+		assert.Equal(t, "@1767225600", resp.Header().Get("Deprecation"), uri)
+		assert.Equal(t, "Tue, 30 Jun 2026 00:00:00 GMT", resp.Header().Get("Sunset"), uri)
+		assert.Equal(t, "<"+successor+">; rel=\"successor-version\"", resp.Header().Get("Link"), uri)
+	}
+
+	// Routes without a successor are deprecated too, but not linked to one:
+	resp = serve(post(t, "/v1/events/replay", ""), api)
+	assert.Equal(t, "@1767225600", resp.Header().Get("Deprecation"))
+	assert.Equal(t, "", resp.Header().Get("Link"))
+
+	// V2 is not deprecated, whichever way it is requested:
+	resp = serve(get(t, "/v2/users"), api)
+	assert.Equal(t, "", resp.Header().Get("Deprecation"))
+	resp = serve(withAccept(get(t, "/users"), "application/vnd.kds.v2+json"), api)
+	assert.Equal(t, "", resp.Header().Get("Deprecation"))
+	assert.Equal(t, "", resp.Header().Get("Sunset"))
+}
+
+func withAccept(req *http.Request, accept string) *http.Request {
+	req.Header.Set("Accept", accept)
+	return req
+}
@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"fmt"
+	"time"
+
+	flag "github.com/spf13/pflag" // POSIX/GNU-style CLI arguments.
+)
+
+// Config encapsulates the input required to configure tracing.
+type Config struct {
+	Exporter     string
+	NDJSONFile   string
+	OTLPEndpoint string
+	OTLPTimeout  time.Duration
+	SampleRatio  float64
+}
+
+const (
+	exporter     = "tracing-exporter"
+	ndjsonFile   = "tracing-ndjson-file"
+	otlpEndpoint = "tracing-otlp-endpoint"
+	otlpTimeout  = "tracing-otlp-timeout"
+	sampleRatio  = "tracing-sample-ratio"
+)
+
+// Supported exporters.
+const (
+	NDJSONExporterName = "ndjson"
+	OTLPExporterName   = "otlp"
+)
+
+// RegisterFlags maps the provided CLI arguments to fields in this configuration object.
+func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
+	f.StringVar(&cfg.Exporter, exporter, "", fmt.Sprintf("Exporter to export spans to: %q, %q, or empty to disable tracing", NDJSONExporterName, OTLPExporterName))
+	f.StringVar(&cfg.NDJSONFile, ndjsonFile, "-", fmt.Sprintf("File to append spans to, as newline-delimited JSON, when --%v=%v. Spans are written to stdout if -", exporter, NDJSONExporterName))
+	f.StringVar(&cfg.OTLPEndpoint, otlpEndpoint, "http://localhost:4318/v1/traces", fmt.Sprintf("OpenTelemetry collector's OTLP/HTTP endpoint to send spans to, when --%v=%v", exporter, OTLPExporterName))
+	f.DurationVar(&cfg.OTLPTimeout, otlpTimeout, 5*time.Second, "The maximum duration of each request sending spans to the OpenTelemetry collector")
+	f.Float64Var(&cfg.SampleRatio, sampleRatio, 1, "Probability of recording traces started by this service. Traces of incoming requests are recorded if their callers recorded them")
+}
+
+// Tracer creates a tracer exporting spans, with the provided service name, to the configured exporter,
+// or returns nil if tracing is disabled.
+func (cfg Config) Tracer(serviceName string) (*Tracer, error) {
+	var spanExporter Exporter
+	switch cfg.Exporter {
+	case "":
+		return nil, nil
+	case NDJSONExporterName:
+		ndjsonExporter, err := NewNDJSONFileExporter(cfg.NDJSONFile)
+		if err != nil {
+			return nil, err
+		}
+		spanExporter = ndjsonExporter
+	case OTLPExporterName:
+		if cfg.OTLPTimeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout: --%v must be positive but got %v", otlpTimeout, cfg.OTLPTimeout)
+		}
+		spanExporter = NewOTLPExporter(cfg.OTLPEndpoint, serviceName, cfg.OTLPTimeout)
+	default:
+		return nil, fmt.Errorf("invalid exporter: --%v must be one of %q or %q but got %q", exporter, NDJSONExporterName, OTLPExporterName, cfg.Exporter)
+	}
+	tracer, err := NewTracer(spanExporter, cfg.SampleRatio)
+	if err != nil {
+		spanExporter.Close()
+		return nil, fmt.Errorf("invalid --%v: %v", sampleRatio, err)
+	}
+	return tracer, nil
+}
@@ -0,0 +1,59 @@
+package tracing_test
+
+import (
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"        // POSIX/GNU-style CLI arguments.
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/tracing"
+)
+
+func TestParsingEmptyArgumentsShouldDisableTracing(t *testing.T) {
+	config := parseArgs(t, []string{})
+	assert.Equal(t, "", config.Exporter)
+	assert.Equal(t, "-", config.NDJSONFile)
+	assert.Equal(t, "http://localhost:4318/v1/traces", config.OTLPEndpoint)
+	assert.Equal(t, 5*time.Second, config.OTLPTimeout)
+	assert.Equal(t, 1.0, config.SampleRatio)
+
+	tracer, err := config.Tracer("kds-service")
+	assert.NoError(t, err)
+	assert.Nil(t, tracer)
+}
+
+func TestParsingArgumentsShouldConfigureTracer(t *testing.T) {
+	config := parseArgs(t, []string{
+		"--tracing-exporter", "otlp",
+		"--tracing-otlp-endpoint", "http://collector:4318/v1/traces",
+		"--tracing-otlp-timeout", "1s",
+		"--tracing-sample-ratio", "0.1",
+	})
+	assert.Equal(t, "otlp", config.Exporter)
+	assert.Equal(t, "http://collector:4318/v1/traces", config.OTLPEndpoint)
+	assert.Equal(t, 1*time.Second, config.OTLPTimeout)
+	assert.Equal(t, 0.1, config.SampleRatio)
+
+	tracer, err := config.Tracer("kds-service")
+	assert.NoError(t, err)
+	assert.NotNil(t, tracer)
+	assert.NoError(t, tracer.Close())
+}
+
+func TestInvalidTracingConfigShouldReturnError(t *testing.T) {
+	_, err := parseArgs(t, []string{"--tracing-exporter", "jaeger"}).Tracer("kds-service")
+	assert.EqualError(t, err, "invalid exporter: --tracing-exporter must be one of \"ndjson\" or \"otlp\" but got \"jaeger\"")
+
+	_, err = parseArgs(t, []string{"--tracing-exporter", "ndjson", "--tracing-sample-ratio", "2"}).Tracer("kds-service")
+	assert.EqualError(t, err, "invalid --tracing-sample-ratio: invalid sample ratio: expected a probability, within [0, 1], but got 2")
+}
+
+func parseArgs(t *testing.T, args []string) *tracing.Config {
+	config := tracing.Config{}
+	cli := flag.NewFlagSet("service-test", flag.ContinueOnError)
+	config.RegisterFlags(cli)
+	err := cli.Parse(args)
+	assert.NoError(t, err)
+	return &config
+}
@@ -0,0 +1,246 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// jsonSpan is how spans are written by the NDJSONExporter.
+type jsonSpan struct {
+	TraceID    string                 `json:"traceId"`
+	SpanID     string                 `json:"spanId"`
+	ParentID   string                 `json:"parentSpanId,omitempty"`
+	TraceState string                 `json:"traceState,omitempty"`
+	Name       string                 `json:"name"`
+	Kind       Kind                   `json:"kind"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	DurationMs float64                `json:"durationMs"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// NDJSONExporter writes spans as newline-delimited JSON, e.g. to a file, or to stdout.
+type NDJSONExporter struct {
+	writer io.Writer
+	closer io.Closer // Nil when the writer should not be closed, e.g. stdout.
+	mutex  sync.Mutex
+}
+
+// NewNDJSONExporter creates an exporter writing spans to the provided writer.
+func NewNDJSONExporter(writer io.Writer) *NDJSONExporter {
+	return &NDJSONExporter{writer: writer}
+}
+
+// NewNDJSONFileExporter creates an exporter appending spans to the provided file, or writing them to stdout if "-".
+func NewNDJSONFileExporter(path string) (*NDJSONExporter, error) {
+	if path == "-" {
+		return NewNDJSONExporter(os.Stdout), nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &NDJSONExporter{writer: file, closer: file}, nil
+}
+
+// Export writes one line of JSON per span.
+func (exporter *NDJSONExporter) Export(spans []*Span) error {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer) // Terminates each span with a newline.
+	for _, span := range spans {
+		span := jsonSpan{
+			TraceID:    span.Context.TraceID.String(),
+			SpanID:     span.Context.SpanID.String(),
+			TraceState: span.Context.State,
+			Name:       span.Name,
+			Kind:       span.Kind,
+			Start:      span.StartTime,
+			End:        span.EndTime,
+			DurationMs: float64(span.EndTime.Sub(span.StartTime)) / float64(time.Millisecond),
+			Attributes: span.Attributes,
+			Error:      span.Error,
+			ParentID:   parentID(span),
+		}
+		if err := encoder.Encode(span); err != nil {
+			return err
+		}
+	}
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+	_, err := exporter.writer.Write(buffer.Bytes())
+	return err
+}
+
+func parentID(span *Span) string {
+	if !span.ParentID.IsValid() {
+		return ""
+	}
+	return span.ParentID.String()
+}
+
+// Close closes the underlying file, if any.
+func (exporter *NDJSONExporter) Close() error {
+	if exporter.closer == nil {
+		return nil
+	}
+	return exporter.closer.Close()
+}
+
+// OTLPExporter sends spans to an OpenTelemetry collector, using the JSON encoding of OTLP/HTTP.
+type OTLPExporter struct {
+	endpoint    string
+	serviceName string
+	client      *http.Client
+}
+
+// NewOTLPExporter creates an exporter sending spans to the provided endpoint, e.g. http://localhost:4318/v1/traces.
+func NewOTLPExporter(endpoint, serviceName string, timeout time.Duration) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: timeout},
+	}
+}
+
+// Export sends the provided spans to the collector, in a single request.
+func (exporter *OTLPExporter) Export(spans []*Span) error {
+	body, err := json.Marshal(exporter.request(spans))
+	if err != nil {
+		return err
+	}
+	resp, err := exporter.client.Post(exporter.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body) // For the connection to be reused.
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to export spans to %v: %v", exporter.endpoint, resp.Status)
+	}
+	return nil
+}
+
+// Close is a no-op, as spans are sent synchronously.
+func (exporter *OTLPExporter) Close() error {
+	return nil
+}
+
+// OTLP/HTTP JSON encoding, as per https://github.com/open-telemetry/opentelemetry-proto.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		TraceState        string         `json:"traceState,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpKeyValue struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"` // 64-bit integers are strings in OTLP's JSON encoding.
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+// OTLP span kinds and status codes.
+var otlpKinds = map[Kind]int{KindInternal: 1, KindServer: 2, KindClient: 3}
+
+const (
+	otlpStatusUnset = 0
+	otlpStatusError = 2
+)
+
+func (exporter *OTLPExporter) request(spans []*Span) otlpRequest {
+	otlpSpans := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		status := otlpStatus{Code: otlpStatusUnset}
+		if len(span.Error) > 0 {
+			status = otlpStatus{Code: otlpStatusError, Message: span.Error}
+		}
+		otlpSpans = append(otlpSpans, otlpSpan{
+			TraceID:           span.Context.TraceID.String(),
+			SpanID:            span.Context.SpanID.String(),
+			ParentSpanID:      parentID(span),
+			TraceState:        span.Context.State,
+			Name:              span.Name,
+			Kind:              otlpKinds[span.Kind],
+			StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+			Attributes:        otlpAttributes(span.Attributes),
+			Status:            status,
+		})
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: otlpAttributes(map[string]interface{}{"service.name": exporter.serviceName})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "kds/tracing"}, Spans: otlpSpans}},
+	}}}
+}
+
+func otlpAttributes(attributes map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // For requests to be deterministic.
+	keyValues := make([]otlpKeyValue, 0, len(keys))
+	for _, key := range keys {
+		var value otlpValue
+		switch v := attributes[key].(type) {
+		case bool:
+			value.BoolValue = &v
+		case int:
+			i := strconv.Itoa(v)
+			value.IntValue = &i
+		case int64:
+			i := strconv.FormatInt(v, 10)
+			value.IntValue = &i
+		case float64:
+			value.DoubleValue = &v
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+		keyValues = append(keyValues, otlpKeyValue{Key: key, Value: value})
+	}
+	return keyValues
+}
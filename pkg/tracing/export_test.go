@@ -0,0 +1,102 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/tracing"
+)
+
+func spans(t *testing.T) []*tracing.Span {
+	exporter := &memoryExporter{}
+	tracer, err := tracing.NewTracer(exporter, 1)
+	assert.NoError(t, err)
+	ctx, root := tracer.Start(context.Background(), "GET /users/{id}", tracing.KindServer)
+	root.SetAttribute("http.status_code", 500)
+	_, child := tracing.Start(ctx, "postgresql SELECT", tracing.KindClient)
+	child.SetAttribute("db.statement", "SELECT id FROM users WHERE id = $1")
+	child.SetError(context.DeadlineExceeded)
+	child.End()
+	root.End()
+	assert.NoError(t, tracer.Close())
+	return exporter.spans
+}
+
+func TestNDJSONExporterShouldWriteOneLinePerSpan(t *testing.T) {
+	spans := spans(t)
+	var out bytes.Buffer
+	assert.NoError(t, tracing.NewNDJSONExporter(&out).Export(spans))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	var child map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &child))
+	assert.Equal(t, spans[0].Context.TraceID.String(), child["traceId"])
+	assert.Equal(t, spans[0].Context.SpanID.String(), child["spanId"])
+	assert.Equal(t, spans[1].Context.SpanID.String(), child["parentSpanId"])
+	assert.Equal(t, "postgresql SELECT", child["name"])
+	assert.Equal(t, "client", child["kind"])
+	assert.Equal(t, "context deadline exceeded", child["error"])
+	assert.Equal(t, map[string]interface{}{"db.statement": "SELECT id FROM users WHERE id = $1"}, child["attributes"])
+	var root map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &root))
+	assert.NotContains(t, root, "parentSpanId")
+}
+
+func TestOTLPExporterShouldPostSpansToCollector(t *testing.T) {
+	requests := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "POST", req.Method)
+		assert.Equal(t, "/v1/traces", req.URL.Path)
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(req.Body)
+		assert.NoError(t, err)
+		requests <- body
+	}))
+	defer collector.Close()
+
+	spans := spans(t)
+	exporter := tracing.NewOTLPExporter(collector.URL+"/v1/traces", "kds-service", time.Second)
+	assert.NoError(t, exporter.Export(spans))
+
+	var request struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []map[string]interface{} `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []map[string]interface{} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	assert.NoError(t, json.Unmarshal(<-requests, &request))
+	assert.Equal(t, []map[string]interface{}{{"key": "service.name", "value": map[string]interface{}{"stringValue": "kds-service"}}}, request.ResourceSpans[0].Resource.Attributes)
+	otlpSpans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	assert.Equal(t, 2, len(otlpSpans))
+	child, root := otlpSpans[0], otlpSpans[1]
+	assert.Equal(t, spans[0].Context.TraceID.String(), child["traceId"])
+	assert.Equal(t, spans[1].Context.SpanID.String(), child["parentSpanId"])
+	assert.Equal(t, float64(3), child["kind"])
+	assert.Equal(t, map[string]interface{}{"code": float64(2), "message": "context deadline exceeded"}, child["status"])
+	assert.Equal(t, float64(2), root["kind"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"key": "http.status_code", "value": map[string]interface{}{"intValue": "500"}}}, root["attributes"])
+	assert.Equal(t, map[string]interface{}{"code": float64(0)}, root["status"])
+}
+
+func TestOTLPExporterShouldReturnErrorWhenCollectorFails(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+	err := tracing.NewOTLPExporter(collector.URL, "kds-service", time.Second).Export(spans(t))
+	assert.EqualError(t, err, "failed to export spans to "+collector.URL+": 503 Service Unavailable")
+}
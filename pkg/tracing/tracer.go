@@ -0,0 +1,243 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus" // Better Logging.
+)
+
+// Kind is the role of a span in a trace.
+type Kind string
+
+// Kinds of spans.
+const (
+	KindInternal Kind = "internal"
+	KindServer   Kind = "server"
+	KindClient   Kind = "client"
+)
+
+// Span records an operation, e.g. serving an HTTP request, or running a database query.
+type Span struct {
+	Name       string
+	Kind       Kind
+	Context    SpanContext
+	ParentID   SpanID // Invalid for root spans.
+	StartTime  time.Time
+	EndTime    time.Time
+	Attributes map[string]interface{}
+	Error      string // Empty unless the operation failed.
+
+	tracer *Tracer
+	mutex  sync.Mutex // For thread-safe updates of the attributes and error.
+	ended  bool
+}
+
+// SetAttribute records the provided attribute on this span. Spans may be nil, e.g. when not traced, for convenience.
+func (span *Span) SetAttribute(key string, value interface{}) {
+	if span == nil {
+		return
+	}
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+	span.Attributes[key] = value
+}
+
+// SetError records the provided error, if any, on this span.
+func (span *Span) SetError(err error) {
+	if span == nil || err == nil {
+		return
+	}
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+	span.Error = err.Error()
+}
+
+// End ends this span, and exports it, if sampled. Subsequent calls are ignored.
+func (span *Span) End() {
+	if span == nil {
+		return
+	}
+	span.mutex.Lock()
+	if span.ended {
+		span.mutex.Unlock()
+		return
+	}
+	span.ended = true
+	span.EndTime = time.Now()
+	span.mutex.Unlock()
+	if span.Context.Sampled() {
+		span.tracer.export(span)
+	}
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// ContextWithSpan returns a copy of the provided context carrying the provided span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span carried by the provided context, if any.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemoteParent returns a copy of the provided context carrying the provided span context, e.g. extracted
+// from an incoming request, for the next span started to be its child.
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanContextFromContext returns the context of the span carried by the provided context, if any, or of its remote parent.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.Context, true
+	}
+	sc, ok := ctx.Value(remoteKey{}).(SpanContext)
+	return sc, ok
+}
+
+// Start starts a span, child of the one carried by the provided context, using the same tracer. If the provided
+// context carries no span, e.g. because requests are not traced, it returns a nil span, whose methods are no-ops.
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, kind)
+}
+
+// Exporter exports finished spans, e.g. to a file, or to a collector.
+type Exporter interface {
+	// Export exports the provided spans.
+	Export(spans []*Span) error
+	// Close releases any resource held by this exporter.
+	Close() error
+}
+
+// Batching of spans, which are dropped if the exporter cannot keep up, rather than slowing requests down.
+const (
+	queueSize     = 2048
+	batchSize     = 512
+	flushInterval = 5 * time.Second
+)
+
+// Tracer starts spans, and exports them, in batches, once ended.
+type Tracer struct {
+	exporter    Exporter
+	sampleRatio float64
+	queue       chan *Span
+	done        chan struct{}
+	closed      bool
+	mutex       sync.RWMutex // For spans not to be queued once closed.
+}
+
+// NewTracer creates a tracer, exporting spans to the provided exporter. New traces are sampled, i.e. recorded, with
+// the provided probability, while the traces of incoming requests are sampled if their callers sampled them.
+func NewTracer(exporter Exporter, sampleRatio float64) (*Tracer, error) {
+	if sampleRatio < 0 || sampleRatio > 1 {
+		return nil, fmt.Errorf("invalid sample ratio: expected a probability, within [0, 1], but got %v", sampleRatio)
+	}
+	tracer := &Tracer{
+		exporter:    exporter,
+		sampleRatio: sampleRatio,
+		queue:       make(chan *Span, queueSize),
+		done:        make(chan struct{}),
+	}
+	go tracer.run()
+	return tracer, nil
+}
+
+// Start starts a span, child of the span, or remote parent, carried by the provided context, if any, or root of a new
+// trace otherwise, and returns it, along with a copy of the provided context carrying it.
+func (tracer *Tracer) Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	span := &Span{
+		Name:       name,
+		Kind:       kind,
+		StartTime:  time.Now(),
+		Attributes: make(map[string]interface{}),
+		tracer:     tracer,
+	}
+	if parent, ok := SpanContextFromContext(ctx); ok && parent.IsValid() {
+		span.Context = parent
+		span.ParentID = parent.SpanID
+	} else {
+		rand.Read(span.Context.TraceID[:])
+		if tracer.sample(span.Context.TraceID) {
+			span.Context.Flags |= flagSampled
+		}
+	}
+	rand.Read(span.Context.SpanID[:])
+	return ContextWithSpan(ctx, span), span
+}
+
+// sample decides whether to record a new trace, consistently for a given trace ID.
+func (tracer *Tracer) sample(id TraceID) bool {
+	if tracer.sampleRatio >= 1 {
+		return true
+	}
+	return binary.BigEndian.Uint64(id[8:])>>1 < uint64(tracer.sampleRatio*(1<<63))
+}
+
+func (tracer *Tracer) export(span *Span) {
+	tracer.mutex.RLock()
+	defer tracer.mutex.RUnlock()
+	if tracer.closed {
+		return
+	}
+	select {
+	case tracer.queue <- span:
+	default:
+		log.WithField("span", span.Name).Debug("tracing: queue full, dropping span")
+	}
+}
+
+func (tracer *Tracer) run() {
+	defer close(tracer.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	batch := make([]*Span, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := tracer.exporter.Export(batch); err != nil {
+			log.WithField("spans", len(batch)).WithField("err", err).Warn("failed to export spans")
+		}
+		batch = make([]*Span, 0, batchSize)
+	}
+	for {
+		select {
+		case span, ok := <-tracer.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) == batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Close exports the spans ended so far, and closes the exporter. Spans ended afterwards are dropped.
+func (tracer *Tracer) Close() error {
+	tracer.mutex.Lock()
+	if !tracer.closed {
+		tracer.closed = true
+		close(tracer.queue)
+	}
+	tracer.mutex.Unlock()
+	<-tracer.done
+	return tracer.exporter.Close()
+}
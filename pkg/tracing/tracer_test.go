@@ -0,0 +1,99 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/tracing"
+)
+
+// memoryExporter records exported spans.
+type memoryExporter struct {
+	spans  []*tracing.Span
+	closed bool
+	mutex  sync.Mutex
+}
+
+func (exporter *memoryExporter) Export(spans []*tracing.Span) error {
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+	exporter.spans = append(exporter.spans, spans...)
+	return nil
+}
+
+func (exporter *memoryExporter) Close() error {
+	exporter.closed = true
+	return nil
+}
+
+func TestTracerShouldRecordChildSpansInTheSameTrace(t *testing.T) {
+	exporter := &memoryExporter{}
+	tracer, err := tracing.NewTracer(exporter, 1)
+	assert.NoError(t, err)
+
+	ctx, root := tracer.Start(context.Background(), "GET /users", tracing.KindServer)
+	_, child := tracing.Start(ctx, "postgresql SELECT", tracing.KindClient)
+	child.SetAttribute("db.statement", "SELECT id FROM users")
+	child.SetError(errors.New("boom"))
+	child.End()
+	root.End()
+	root.End() // Ignored.
+	assert.NoError(t, tracer.Close())
+
+	assert.True(t, exporter.closed)
+	assert.Equal(t, []*tracing.Span{child, root}, exporter.spans)
+	assert.True(t, root.Context.Sampled())
+	assert.False(t, root.ParentID.IsValid())
+	assert.Equal(t, root.Context.TraceID, child.Context.TraceID)
+	assert.Equal(t, root.Context.SpanID, child.ParentID)
+	assert.NotEqual(t, root.Context.SpanID, child.Context.SpanID)
+	assert.Equal(t, "SELECT id FROM users", child.Attributes["db.statement"])
+	assert.Equal(t, "boom", child.Error)
+}
+
+func TestTracerShouldContinueRemoteTraces(t *testing.T) {
+	exporter := &memoryExporter{}
+	tracer, err := tracing.NewTracer(exporter, 0) // Sampling is decided by the caller.
+	assert.NoError(t, err)
+
+	remote, err := tracing.ParseTraceparent(traceparent)
+	assert.NoError(t, err)
+	remote.State = "rojo=00f067aa0ba902b7"
+	_, span := tracer.Start(tracing.ContextWithRemoteParent(context.Background(), remote), "GET /users", tracing.KindServer)
+	span.End()
+	assert.NoError(t, tracer.Close())
+
+	assert.Equal(t, []*tracing.Span{span}, exporter.spans)
+	assert.Equal(t, remote.TraceID, span.Context.TraceID)
+	assert.Equal(t, remote.SpanID, span.ParentID)
+	assert.Equal(t, remote.State, span.Context.State)
+}
+
+func TestTracerShouldNotExportUnsampledSpans(t *testing.T) {
+	exporter := &memoryExporter{}
+	tracer, err := tracing.NewTracer(exporter, 0)
+	assert.NoError(t, err)
+	_, span := tracer.Start(context.Background(), "GET /users", tracing.KindServer)
+	span.End()
+	assert.NoError(t, tracer.Close())
+	assert.False(t, span.Context.Sampled())
+	assert.Empty(t, exporter.spans)
+}
+
+func TestStartShouldReturnNoOpSpanWithoutParent(t *testing.T) {
+	ctx, span := tracing.Start(context.Background(), "postgresql SELECT", tracing.KindClient)
+	assert.Nil(t, span)
+	assert.Nil(t, tracing.SpanFromContext(ctx))
+	span.SetAttribute("key", "value") // No-op.
+	span.SetError(errors.New("boom"))
+	span.End()
+}
+
+func TestNewTracerShouldReturnErrorForInvalidSampleRatio(t *testing.T) {
+	_, err := tracing.NewTracer(&memoryExporter{}, 1.5)
+	assert.EqualError(t, err, "invalid sample ratio: expected a probability, within [0, 1], but got 1.5")
+}
@@ -0,0 +1,153 @@
+// Package tracing traces requests across services, e.g. from the traffic router to this service and its database,
+// as per the W3C Trace Context recommendation (https://www.w3.org/TR/trace-context/): the trace a request belongs to
+// is propagated via the traceparent and tracestate headers, and the spans recorded along the way are exported to a
+// pluggable Exporter.
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Trace Context headers.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// String returns this ID in lowercase hexadecimal, as in traceparent headers.
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsValid returns whether this ID is valid, i.e. not all zeros.
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+// SpanID identifies a span.
+type SpanID [8]byte
+
+// String returns this ID in lowercase hexadecimal, as in traceparent headers.
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsValid returns whether this ID is valid, i.e. not all zeros.
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+// flagSampled is set in trace flags when the caller may have recorded its span, and so should callees.
+const flagSampled = 0x01
+
+// SpanContext is the part of a span propagated to other services.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+	State   string // Vendor-specific tracestate, propagated as is.
+}
+
+// IsValid returns whether this context identifies a span.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Sampled returns whether the span this context identifies, and its children, are recorded.
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&flagSampled != 0
+}
+
+// Traceparent formats this context as a version 00 traceparent header.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%v-%v-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+var traceparentFormat = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})(-.*)?$`)
+
+// ParseTraceparent parses the provided traceparent header. Headers of versions later than 00 are parsed as version 00
+// ones, ignoring what follows, as per the recommendation.
+func ParseTraceparent(header string) (SpanContext, error) {
+	matches := traceparentFormat.FindStringSubmatch(strings.TrimSpace(header))
+	if matches == nil {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q: expected <version>-<trace ID>-<parent ID>-<flags>", header)
+	}
+	version, traceID, spanID, flags, rest := matches[1], matches[2], matches[3], matches[4], matches[5]
+	if version == "ff" || (version == "00" && len(rest) > 0) {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q: invalid version", header)
+	}
+	var sc SpanContext
+	hex.Decode(sc.TraceID[:], []byte(traceID)) // Cannot fail, as per the above regular expression.
+	hex.Decode(sc.SpanID[:], []byte(spanID))
+	var flagsBytes [1]byte
+	hex.Decode(flagsBytes[:], []byte(flags))
+	sc.Flags = flagsBytes[0]
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q: all-zero trace or parent ID", header)
+	}
+	return sc, nil
+}
+
+// maxTracestateMembers is the maximum number of list members in a tracestate header.
+const maxTracestateMembers = 32
+
+var tracestateMember = regexp.MustCompile(`^([a-z0-9][a-z0-9_*/-]{0,255}|[a-z0-9][a-z0-9_*/-]{0,240}@[a-z][a-z0-9_*/-]{0,13})=[\x20-\x2b\x2d-\x3c\x3e-\x7e]{0,255}[\x21-\x2b\x2d-\x3c\x3e-\x7e]$`)
+
+// ParseTracestate validates the provided tracestate header, and returns it without optional whitespace.
+func ParseTracestate(header string) (string, error) {
+	var members []string
+	for _, member := range strings.Split(header, ",") {
+		member = strings.TrimSpace(member)
+		if len(member) == 0 {
+			continue
+		}
+		if !tracestateMember.MatchString(member) {
+			return "", fmt.Errorf("invalid tracestate member %q", member)
+		}
+		members = append(members, member)
+	}
+	if len(members) > maxTracestateMembers {
+		return "", fmt.Errorf("invalid tracestate: more than %v members", maxTracestateMembers)
+	}
+	return strings.Join(members, ","), nil
+}
+
+// Extract returns the span context propagated by the provided headers, if any and valid.
+// An invalid tracestate is discarded, but the traceparent is still used, as per the recommendation.
+func Extract(header http.Header) (SpanContext, bool) {
+	sc, err := ParseTraceparent(header.Get(TraceparentHeader))
+	if err != nil {
+		return SpanContext{}, false
+	}
+	if state, err := ParseTracestate(strings.Join(header[http.CanonicalHeaderKey(TracestateHeader)], ",")); err == nil {
+		sc.State = state
+	}
+	return sc, true
+}
+
+// Inject sets the traceparent and tracestate headers, to propagate the span of the provided context, if any.
+func Inject(ctx context.Context, header http.Header) {
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok {
+		return
+	}
+	header.Set(TraceparentHeader, sc.Traceparent())
+	if len(sc.State) > 0 {
+		header.Set(TracestateHeader, sc.State)
+	} else {
+		header.Del(TracestateHeader)
+	}
+}
+
+// sqlLiterals matches string and numeric literals in SQL, as well as placeholders, e.g. $1, which are kept.
+var sqlLiterals = regexp.MustCompile(`'(?:[^']|'')*'|\$\d+|\b\d+(?:\.\d+)?\b`)
+
+// SanitizeSQL replaces literals in the provided SQL query with ?, so that it can be recorded without leaking data.
+func SanitizeSQL(query string) string {
+	return sqlLiterals.ReplaceAllStringFunc(query, func(literal string) string {
+		if strings.HasPrefix(literal, "$") {
+			return literal
+		}
+		return "?"
+	})
+}
@@ -0,0 +1,91 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/tracing"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparentShouldParseValidHeaders(t *testing.T) {
+	sc, err := tracing.ParseTraceparent(traceparent)
+	assert.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled())
+	assert.Equal(t, traceparent, sc.Traceparent())
+
+	// Later versions are parsed as version 00, ignoring what follows:
+	sc, err = tracing.ParseTraceparent("cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-what-the-future-holds")
+	assert.NoError(t, err)
+	assert.False(t, sc.Sampled())
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", sc.Traceparent())
+}
+
+func TestParseTraceparentShouldReturnErrorForInvalidHeaders(t *testing.T) {
+	for _, header := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",        // Missing flags.
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",     // Uppercase.
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",     // All-zero trace ID.
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",     // All-zero parent ID.
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",     // Forbidden version.
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-foo", // Trailing data in version 00.
+	} {
+		_, err := tracing.ParseTraceparent(header)
+		assert.Error(t, err, header)
+	}
+}
+
+func TestParseTracestate(t *testing.T) {
+	state, err := tracing.ParseTracestate("rojo=00f067aa0ba902b7 , congo=t61rcWkgMzE,,vendor@tenant=x")
+	assert.NoError(t, err)
+	assert.Equal(t, "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE,vendor@tenant=x", state)
+
+	_, err = tracing.ParseTracestate("Invalid-Key=value")
+	assert.Error(t, err)
+	_, err = tracing.ParseTracestate("key=in,valid")
+	assert.Error(t, err)
+}
+
+func TestExtractAndInjectShouldPropagateSpanContexts(t *testing.T) {
+	header := http.Header{}
+	header.Set("Traceparent", traceparent)
+	header.Add("Tracestate", "rojo=00f067aa0ba902b7")
+	header.Add("Tracestate", "congo=t61rcWkgMzE")
+	sc, ok := tracing.Extract(header)
+	assert.True(t, ok)
+	assert.Equal(t, "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE", sc.State)
+
+	outgoing := http.Header{}
+	tracing.Inject(tracing.ContextWithRemoteParent(context.Background(), sc), outgoing)
+	assert.Equal(t, traceparent, outgoing.Get("Traceparent"))
+	assert.Equal(t, "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE", outgoing.Get("Tracestate"))
+
+	// Invalid tracestates are discarded, but the traceparent is still used:
+	header.Set("Tracestate", "INVALID")
+	sc, ok = tracing.Extract(header)
+	assert.True(t, ok)
+	assert.Equal(t, "", sc.State)
+
+	_, ok = tracing.Extract(http.Header{})
+	assert.False(t, ok)
+}
+
+func TestInjectShouldNotSetHeadersWithoutSpan(t *testing.T) {
+	header := http.Header{}
+	tracing.Inject(context.Background(), header)
+	assert.Empty(t, header)
+}
+
+func TestSanitizeSQLShouldReplaceLiteralsButKeepPlaceholders(t *testing.T) {
+	assert.Equal(t,
+		"SELECT id, first_name FROM users WHERE id = $1 AND name = ? AND age > ? LIMIT ?",
+		tracing.SanitizeSQL("SELECT id, first_name FROM users WHERE id = $1 AND name = 'O''Brien' AND age > 42.5 LIMIT 10"))
+	assert.Equal(t, "SELECT pg_advisory_xact_lock($1)", tracing.SanitizeSQL("SELECT pg_advisory_xact_lock($1)"))
+}
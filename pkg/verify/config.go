@@ -0,0 +1,83 @@
+package verify
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag" // POSIX/GNU-style CLI arguments.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/logging"
+)
+
+// Config encapsulates the input required to configure the verification.
+type Config struct {
+	Target          string
+	ExpectedVersion string
+	Timeout         time.Duration
+	HealthWait      time.Duration
+	Cleanup         bool
+	Output          string
+	apiKeyFile      string
+}
+
+const (
+	target          = "target"
+	expectedVersion = "expected-version"
+	timeout         = "timeout"
+	healthWait      = "health-wait"
+	cleanup         = "cleanup"
+	output          = "output"
+	apiKeyFile      = "api-key-file"
+)
+
+// Supported outputs.
+const (
+	TextOutput = "text"
+	JSONOutput = "json"
+)
+
+// RegisterFlags maps the provided CLI arguments to fields in this configuration object.
+func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
+	f.StringVar(&cfg.Target, target, "http://localhost:8080", "Base URL of the service to verify")
+	f.StringVar(&cfg.ExpectedVersion, expectedVersion, "", "Version the service must report, e.g. the one just deployed. Any version is accepted if empty")
+	f.DurationVar(&cfg.Timeout, timeout, 10*time.Second, "The maximum duration of each request")
+	f.DurationVar(&cfg.HealthWait, healthWait, 30*time.Second, "How long to wait for the service to be healthy, e.g. while it starts, before failing")
+	f.BoolVar(&cfg.Cleanup, cleanup, true, "Delete the data created while verifying the service")
+	f.StringVar(&cfg.Output, output, TextOutput, fmt.Sprintf("Format of the report: %q, or %q", TextOutput, JSONOutput))
+	f.StringVar(&cfg.apiKeyFile, apiKeyFile, "", "File containing the API key to send requests with, when the service requires authentication")
+}
+
+// Validate checks this configuration.
+func (cfg Config) Validate() error {
+	if u, err := url.Parse(cfg.Target); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("invalid target: --%v must be an HTTP(S) URL but got %q", target, cfg.Target)
+	}
+	if cfg.Timeout <= 0 {
+		return fmt.Errorf("invalid timeout: --%v must be positive but got %v", timeout, cfg.Timeout)
+	}
+	if cfg.HealthWait < 0 {
+		return fmt.Errorf("invalid health wait: --%v must not be negative but got %v", healthWait, cfg.HealthWait)
+	}
+	if cfg.Output != TextOutput && cfg.Output != JSONOutput {
+		return fmt.Errorf("invalid output: --%v must be one of %q or %q but got %q", output, TextOutput, JSONOutput, cfg.Output)
+	}
+	return nil
+}
+
+// APIKey reads the API key from the configured file, or returns an empty key if none is configured.
+func (cfg Config) APIKey() (string, error) {
+	if len(cfg.apiKeyFile) == 0 {
+		return "", nil
+	}
+	bytes, err := ioutil.ReadFile(cfg.apiKeyFile)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read API key file")
+	}
+	apiKey := strings.TrimSpace(string(bytes))
+	logging.AddSecret(apiKey)
+	return apiKey, nil
+}
@@ -0,0 +1,63 @@
+package verify_test
+
+import (
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"        // POSIX/GNU-style CLI arguments.
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/verify"
+)
+
+func TestParsingEmptyArgumentsShouldReturnDefaultConfiguration(t *testing.T) {
+	config := parseArgs(t, []string{})
+	assert.Equal(t, "http://localhost:8080", config.Target)
+	assert.Equal(t, "", config.ExpectedVersion)
+	assert.Equal(t, 10*time.Second, config.Timeout)
+	assert.Equal(t, 30*time.Second, config.HealthWait)
+	assert.True(t, config.Cleanup)
+	assert.Equal(t, verify.TextOutput, config.Output)
+	assert.NoError(t, config.Validate())
+	apiKey, err := config.APIKey()
+	assert.NoError(t, err)
+	assert.Equal(t, "", apiKey)
+}
+
+func TestParsingArgumentsShouldConfigureVerification(t *testing.T) {
+	config := parseArgs(t, []string{
+		"--target", "https://kds:8443",
+		"--expected-version", "v1.2.0",
+		"--timeout", "1s",
+		"--health-wait", "0",
+		"--cleanup=false",
+		"--output", "json",
+	})
+	assert.NoError(t, config.Validate())
+	assert.Equal(t, "https://kds:8443", config.Target)
+	assert.Equal(t, "v1.2.0", config.ExpectedVersion)
+	assert.Equal(t, 1*time.Second, config.Timeout)
+	assert.Equal(t, time.Duration(0), config.HealthWait)
+	assert.False(t, config.Cleanup)
+	assert.Equal(t, verify.JSONOutput, config.Output)
+}
+
+func TestValidateShouldRejectInvalidArguments(t *testing.T) {
+	for message, args := range map[string][]string{
+		"invalid target: --target must be an HTTP(S) URL but got \"kds:8080\"":           {"--target", "kds:8080"},
+		"invalid timeout: --timeout must be positive but got 0s":                         {"--timeout", "0"},
+		"invalid health wait: --health-wait must not be negative but got -1s":            {"--health-wait", "-1s"},
+		"invalid output: --output must be one of \"text\" or \"json\" but got \"junit\"": {"--output", "junit"},
+	} {
+		assert.EqualError(t, parseArgs(t, args).Validate(), message)
+	}
+}
+
+func parseArgs(t *testing.T, args []string) verify.Config {
+	config := verify.Config{}
+	cli := flag.NewFlagSet("verify-test", flag.ContinueOnError)
+	config.RegisterFlags(cli)
+	err := cli.Parse(args)
+	assert.NoError(t, err)
+	return config
+}
@@ -0,0 +1,44 @@
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// WriteJSON writes this report as JSON.
+func (report *Report) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(report)
+}
+
+// WriteText writes this report as a table, one row per check, followed by a summary.
+func (report *Report) WriteText(w io.Writer) error {
+	table := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	failed, warnings := 0, 0
+	for _, check := range report.Checks {
+		switch check.Status {
+		case Failed:
+			failed++
+		case Warning:
+			warnings++
+		}
+		fmt.Fprintf(table, "%v\t%v\t%.1fms\t%v\n", strings.ToUpper(check.Status), check.Name, check.DurationMs, check.Message)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	outcome := "passed"
+	if !report.Passed {
+		outcome = fmt.Sprintf("failed: %v of %v checks failed", failed, len(report.Checks))
+	} else if warnings > 0 {
+		outcome = fmt.Sprintf("passed with warnings: %v of %v checks need attention", warnings, len(report.Checks))
+	}
+	version := report.Version
+	if len(version) == 0 {
+		version = "unknown"
+	}
+	_, err := fmt.Fprintf(w, "verification of %v (version %v) %v\n", report.Target, version, outcome)
+	return err
+}
@@ -0,0 +1,41 @@
+package verify_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/verify"
+)
+
+var report = &verify.Report{
+	Target:     "http://kds:8080",
+	Version:    "v1",
+	Passed:     false,
+	DurationMs: 12.5,
+	Checks: []verify.Check{
+		{Name: "health", Status: verify.Passed, DurationMs: 1},
+		{Name: "version", Status: verify.Failed, DurationMs: 2, Message: "expected version \"v2\" but got \"v1\""},
+		{Name: "delete_user", Status: verify.Skipped, Message: "disabled by --cleanup=false"},
+	},
+}
+
+func TestReportShouldBeWrittenAsText(t *testing.T) {
+	var buffer bytes.Buffer
+	assert.NoError(t, report.WriteText(&buffer))
+	assert.Equal(t, "PASSED   health       1.0ms  \n"+
+		"FAILED   version      2.0ms  expected version \"v2\" but got \"v1\"\n"+
+		"SKIPPED  delete_user  0.0ms  disabled by --cleanup=false\n"+
+		"verification of http://kds:8080 (version v1) failed: 1 of 3 checks failed\n", buffer.String())
+}
+
+func TestReportShouldBeWrittenAsJSON(t *testing.T) {
+	var buffer bytes.Buffer
+	assert.NoError(t, report.WriteJSON(&buffer))
+	decoded := &verify.Report{}
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), decoded))
+	assert.Equal(t, report, decoded)
+	assert.Contains(t, buffer.String(), "\"status\":\"skipped\"")
+}
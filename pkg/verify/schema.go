@@ -0,0 +1,75 @@
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+)
+
+// Fields of the service's responses, and their JSON types. Additional fields are accepted, for the service to be able
+// to add fields without breaking this contract.
+var (
+	versionSchema = map[string]string{"version": "string"}
+	userSchema    = map[string]string{"id": "integer", "firstName": "string", "familyName": "string", "age": "integer"}
+)
+
+// decode checks the provided response is JSON, and decodes it.
+func decode(resp *http.Response, body []byte) (interface{}, error) {
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		return nil, fmt.Errorf("expected Content-Type application/json but got %q", resp.Header.Get("Content-Type"))
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	return value, nil
+}
+
+// checkSchema checks the provided value is a JSON object with the fields, and types, of the provided schema.
+func checkSchema(value interface{}, schema map[string]string) error {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("expected a JSON object but got %v", jsonType(value))
+	}
+	fields := make([]string, 0, len(schema))
+	for field := range schema {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields) // For errors to be deterministic.
+	for _, field := range fields {
+		actual, ok := object[field]
+		if !ok {
+			return fmt.Errorf("missing field %q", field)
+		}
+		if jsonType(actual) != schema[field] {
+			return fmt.Errorf("expected field %q to be %v but got %v", field, schema[field], jsonType(actual))
+		}
+	}
+	return nil
+}
+
+// jsonType returns the JSON type of the provided decoded value, distinguishing integers from other numbers.
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
@@ -0,0 +1,345 @@
+// Package verify runs an end-to-end contract against a deployed instance of the service, e.g. after each blue/green
+// switch, or as a Kubernetes post-deploy Job: it checks the service is healthy and reports the expected version, then
+// creates a user, reads it back, lists users, checking the shape of all responses, and deletes the user it created.
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Statuses of checks.
+const (
+	Passed  = "passed"
+	Failed  = "failed"
+	Skipped = "skipped"
+	Warning = "warning" // The check ran, and does not fail the verification, but needs attention, e.g. data was left behind.
+)
+
+// servedByHeader is the header the service reports its version in.
+const servedByHeader = "X-Served-By"
+
+// Check is the outcome of one step of the verification.
+type Check struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	DurationMs float64 `json:"durationMs"`
+	Message    string  `json:"message,omitempty"` // Why the check failed, was skipped, or warns.
+}
+
+// Report is the outcome of the whole verification.
+type Report struct {
+	Target     string  `json:"target"`
+	Version    string  `json:"version,omitempty"` // As reported by the service.
+	Passed     bool    `json:"passed"`
+	DurationMs float64 `json:"durationMs"`
+	Checks     []Check `json:"checks"`
+}
+
+// Verifier verifies a deployed instance of the service.
+type Verifier struct {
+	target             string
+	expectedVersion    string
+	healthWait         time.Duration
+	healthPollInterval time.Duration
+	cleanup            bool
+	apiKey             string
+	client             *http.Client
+}
+
+// New creates a verifier of the service at the configured target.
+func New(config *Config, apiKey string) *Verifier {
+	return &Verifier{
+		target:             strings.TrimRight(config.Target, "/"),
+		expectedVersion:    config.ExpectedVersion,
+		healthWait:         config.HealthWait,
+		healthPollInterval: 1 * time.Second,
+		cleanup:            config.Cleanup,
+		apiKey:             apiKey,
+		client:             &http.Client{Timeout: config.Timeout},
+	}
+}
+
+// skip is returned by checks which could not run, e.g. because a previous check failed.
+type skip string
+
+func (s skip) Error() string {
+	return string(s)
+}
+
+// warning is returned by checks which ran, but whose outcome needs attention, without failing the verification.
+type warning string
+
+func (w warning) Error() string {
+	return string(w)
+}
+
+// run holds the state of a verification, shared by its checks.
+type run struct {
+	*Verifier
+	report   *Report
+	healthy  bool
+	user     map[string]interface{} // The user created, as sent.
+	location string                 // The location of the user created, e.g. /users/42.
+}
+
+// Run runs all checks, in order, and reports on their outcome.
+func (v *Verifier) Run(ctx context.Context) *Report {
+	start := time.Now()
+	r := &run{Verifier: v, report: &Report{Target: v.target, Checks: []Check{}}}
+	for _, check := range []struct {
+		name string
+		run  func(ctx context.Context) error
+	}{
+		{"health", r.checkHealth},
+		{"version", r.checkVersion},
+		{"create_user", r.createUser},
+		{"read_user", r.readUser},
+		{"list_users", r.listUsers},
+		{"delete_user", r.deleteUser},
+	} {
+		checkStart := time.Now()
+		var err error = skip("service is not healthy")
+		if check.name == "health" || r.healthy {
+			err = check.run(ctx)
+		}
+		result := Check{Name: check.name, Status: Passed, DurationMs: milliseconds(time.Since(checkStart))}
+		if s, ok := err.(skip); ok {
+			result.Status, result.Message = Skipped, string(s)
+		} else if w, ok := err.(warning); ok {
+			result.Status, result.Message = Warning, string(w)
+		} else if err != nil {
+			result.Status, result.Message = Failed, err.Error()
+		}
+		r.report.Checks = append(r.report.Checks, result)
+	}
+	r.report.Passed = true
+	for _, check := range r.report.Checks {
+		if check.Status == Failed {
+			r.report.Passed = false
+		}
+	}
+	r.report.DurationMs = milliseconds(time.Since(start))
+	return r.report
+}
+
+func (r *run) checkHealth(ctx context.Context) error {
+	deadline := time.Now().Add(r.healthWait)
+	for {
+		_, _, err := r.expect(ctx, "GET", "/healthz", nil, http.StatusOK, http.StatusNoContent)
+		if err == nil {
+			r.healthy = true
+			return nil
+		}
+		if !time.Now().Add(r.healthPollInterval).Before(deadline) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(r.healthPollInterval):
+		}
+	}
+}
+
+func (r *run) checkVersion(ctx context.Context) error {
+	resp, body, err := r.expect(ctx, "GET", "/version", nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	value, err := decode(resp, body)
+	if err != nil {
+		return err
+	}
+	if err := checkSchema(value, versionSchema); err != nil {
+		return err
+	}
+	r.report.Version = value.(map[string]interface{})["version"].(string)
+	if servedBy := resp.Header.Get(servedByHeader); len(servedBy) > 0 && servedBy != r.report.Version {
+		return fmt.Errorf("inconsistent version: %v header reports %q but body reports %q", servedByHeader, servedBy, r.report.Version)
+	}
+	if len(r.expectedVersion) > 0 && r.report.Version != r.expectedVersion {
+		return fmt.Errorf("expected version %q but got %q", r.expectedVersion, r.report.Version)
+	}
+	return nil
+}
+
+// location matches the location of created users.
+var location = regexp.MustCompile(`^/users/([0-9]+)$`)
+
+func (r *run) createUser(ctx context.Context) error {
+	r.user = map[string]interface{}{
+		"firstName":  "Verify",
+		"familyName": "kds-verify-" + randomSuffix(), // For users created by concurrent verifications to be told apart.
+		"age":        42.0,                           // As decoded from JSON.
+	}
+	body, err := json.Marshal(r.user)
+	if err != nil {
+		return err
+	}
+	resp, _, err := r.expect(ctx, "POST", "/users", body, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	if !location.MatchString(resp.Header.Get("Location")) {
+		return fmt.Errorf("expected Location header like /users/<id> but got %q", resp.Header.Get("Location"))
+	}
+	r.location = resp.Header.Get("Location")
+	return nil
+}
+
+func (r *run) readUser(ctx context.Context) error {
+	if len(r.location) == 0 {
+		return skip("no user was created")
+	}
+	resp, body, err := r.expect(ctx, "GET", r.location, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	value, err := decode(resp, body)
+	if err != nil {
+		return err
+	}
+	if err := checkSchema(value, userSchema); err != nil {
+		return err
+	}
+	user := value.(map[string]interface{})
+	if id := fmt.Sprint(user["id"]); id != location.FindStringSubmatch(r.location)[1] {
+		return fmt.Errorf("expected user with the ID in its location %v but got ID %v", r.location, id)
+	}
+	for field, expected := range r.user {
+		if user[field] != expected {
+			return fmt.Errorf("expected %v %q but got %q", field, fmt.Sprint(expected), fmt.Sprint(user[field]))
+		}
+	}
+	return nil
+}
+
+func (r *run) listUsers(ctx context.Context) error {
+	resp, body, err := r.expect(ctx, "GET", "/users", nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	value, err := decode(resp, body)
+	if err != nil {
+		return err
+	}
+	users, ok := value.([]interface{})
+	if !ok {
+		return fmt.Errorf("expected a JSON array but got %v", jsonType(value))
+	}
+	found := false
+	for i, user := range users {
+		if err := checkSchema(user, userSchema); err != nil {
+			return fmt.Errorf("invalid user at index %v: %v", i, err)
+		}
+		found = found || "/users/"+fmt.Sprint(user.(map[string]interface{})["id"]) == r.location
+	}
+	if len(r.location) > 0 && !found {
+		return fmt.Errorf("expected the user created, %v, to be listed", r.location)
+	}
+	return nil
+}
+
+func (r *run) deleteUser(ctx context.Context) error {
+	if !r.cleanup {
+		return skip("disabled by --" + cleanup + "=false")
+	}
+	if len(r.location) == 0 {
+		return skip("no user was created")
+	}
+	resp, _, err := r.do(ctx, "DELETE", r.location, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotImplemented {
+		return warning("the service does not support deleting users: " + r.location + " was left behind")
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		return unexpectedStatus(resp, nil, http.StatusNoContent)
+	}
+	_, _, err = r.expect(ctx, "GET", r.location, nil, http.StatusNotFound)
+	return err
+}
+
+// expect sends the provided request, and returns an error if the response's status is none of the expected ones.
+func (r *run) expect(ctx context.Context, method, path string, body []byte, statuses ...int) (*http.Response, []byte, error) {
+	resp, respBody, err := r.do(ctx, method, path, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, status := range statuses {
+		if resp.StatusCode == status {
+			return resp, respBody, nil
+		}
+	}
+	return nil, nil, unexpectedStatus(resp, respBody, statuses...)
+}
+
+// do sends the provided request, and reads the response's body.
+func (r *run) do(ctx context.Context, method, path string, body []byte) (*http.Response, []byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, r.target+path, reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(r.apiKey) > 0 {
+		req.Header.Set("X-API-Key", r.apiKey)
+	}
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response to %v %v: %v", method, path, err)
+	}
+	return resp, respBody, nil
+}
+
+// maxBodyInMessages is the maximum number of bytes of responses' bodies reported in checks' messages.
+const maxBodyInMessages = 200
+
+func unexpectedStatus(resp *http.Response, body []byte, expected ...int) error {
+	statuses := make([]string, 0, len(expected))
+	for _, status := range expected {
+		statuses = append(statuses, fmt.Sprintf("%v %v", status, http.StatusText(status)))
+	}
+	message := fmt.Sprintf("%v %v: expected %v but got %v", resp.Request.Method, resp.Request.URL.Path, strings.Join(statuses, " or "), resp.Status)
+	if len(body) > maxBodyInMessages {
+		body = append(body[:maxBodyInMessages:maxBodyInMessages], "..."...)
+	}
+	if len(body) > 0 {
+		message += ": " + strings.TrimSpace(string(body))
+	}
+	return fmt.Errorf("%v", message)
+}
+
+func randomSuffix() string {
+	bytes := make([]byte, 4)
+	if _, err := rand.Read(bytes); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(bytes)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,141 @@
+package verify_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"             // Better HTTP API.
+	"github.com/stretchr/testify/assert" // More readable test assertions.
+
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/db"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/server"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/verify"
+	"github.com/marccarre/kubernetes-deployment-strategies-workload/pkg/version"
+)
+
+func TestVerifyShouldPassAgainstServiceAndCleanUp(t *testing.T) {
+	database := db.NewInMemoryDB()
+	target := newService(database)
+	defer target.Close()
+
+	report := run(t, "--target", target.URL, "--expected-version", version.Version)
+	assert.True(t, report.Passed, "%+v", report.Checks)
+	assert.Equal(t, version.Version, report.Version)
+	assert.Equal(t, []string{"health", "version", "create_user", "read_user", "list_users", "delete_user"}, names(report))
+	for _, check := range report.Checks {
+		assert.Equal(t, verify.Passed, check.Status, check.Name)
+	}
+	users, err := database.ReadUsers(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+}
+
+func TestVerifyShouldLeaveDataBehindWithoutCleanup(t *testing.T) {
+	database := db.NewInMemoryDB()
+	target := newService(database)
+	defer target.Close()
+
+	report := run(t, "--target", target.URL, "--cleanup=false")
+	assert.True(t, report.Passed)
+	assert.Equal(t, verify.Skipped, report.Checks[5].Status)
+	assert.Equal(t, "disabled by --cleanup=false", report.Checks[5].Message)
+	users, err := database.ReadUsers(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+}
+
+func TestVerifyShouldWarnWhenCleanupIsNotSupported(t *testing.T) {
+	database := db.NewInMemoryDB()
+	target := newService(struct{ db.DB }{database}) // Hides DeleteUser, hence DELETE /users/{id} responds 501.
+	defer target.Close()
+
+	report := run(t, "--target", target.URL)
+	assert.True(t, report.Passed)
+	assert.Equal(t, verify.Warning, report.Checks[5].Status)
+	assert.Equal(t, "the service does not support deleting users: /users/1 was left behind", report.Checks[5].Message)
+	var buffer bytes.Buffer
+	assert.NoError(t, report.WriteText(&buffer))
+	assert.Contains(t, buffer.String(), "WARNING  delete_user")
+	assert.Contains(t, buffer.String(), "passed with warnings: 1 of 6 checks need attention\n")
+}
+
+func TestVerifyShouldFailOnUnexpectedVersion(t *testing.T) {
+	target := newService(db.NewInMemoryDB())
+	defer target.Close()
+
+	report := run(t, "--target", target.URL, "--expected-version", "v42")
+	assert.False(t, report.Passed)
+	assert.Equal(t, verify.Failed, report.Checks[1].Status)
+	assert.Equal(t, "expected version \"v42\" but got \""+version.Version+"\"", report.Checks[1].Message)
+}
+
+func TestVerifyShouldSkipAllChecksWhenServiceIsUnhealthy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		http.Error(resp, "database unreachable", http.StatusServiceUnavailable)
+	}))
+	defer target.Close()
+
+	report := run(t, "--target", target.URL, "--health-wait", "0")
+	assert.False(t, report.Passed)
+	assert.Equal(t, verify.Failed, report.Checks[0].Status)
+	assert.Equal(t, "GET /healthz: expected 200 OK or 204 No Content but got 503 Service Unavailable: database unreachable", report.Checks[0].Message)
+	for _, check := range report.Checks[1:] {
+		assert.Equal(t, verify.Skipped, check.Status, check.Name)
+		assert.Equal(t, "service is not healthy", check.Message)
+	}
+}
+
+func TestVerifyShouldCheckShapeOfResponses(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/healthz", func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusNoContent)
+	})
+	router.HandleFunc("/version", func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("Content-Type", "application/json")
+		resp.Write([]byte("{\"version\":\"v1\"}"))
+	})
+	router.HandleFunc("/users", func(resp http.ResponseWriter, req *http.Request) {
+		if req.Method == "POST" {
+			resp.Header().Set("Location", "/users/7")
+			resp.WriteHeader(http.StatusCreated)
+			return
+		}
+		resp.Header().Set("Content-Type", "application/json")
+		resp.Write([]byte("[{\"id\":7,\"firstName\":\"Verify\",\"familyName\":\"Doe\",\"age\":\"42\"}]"))
+	})
+	router.HandleFunc("/users/7", func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("Content-Type", "application/json")
+		resp.Write([]byte("{\"id\":7,\"firstName\":\"Verify\"}"))
+	})
+	target := httptest.NewServer(router)
+	defer target.Close()
+
+	report := run(t, "--target", target.URL)
+	assert.False(t, report.Passed)
+	assert.Equal(t, "missing field \"age\"", report.Checks[3].Message)
+	assert.Equal(t, "invalid user at index 0: expected field \"age\" to be integer but got string", report.Checks[4].Message)
+	assert.Equal(t, verify.Failed, report.Checks[5].Status) // This fake does not delete users.
+}
+
+func newService(database db.DB) *httptest.Server {
+	router := mux.NewRouter()
+	server.New(database).RegisterRoutes(router)
+	return httptest.NewServer(router)
+}
+
+func run(t *testing.T, args ...string) *verify.Report {
+	config := parseArgs(t, args)
+	assert.NoError(t, config.Validate())
+	return verify.New(&config, "").Run(context.Background())
+}
+
+func names(report *verify.Report) []string {
+	names := []string{}
+	for _, check := range report.Checks {
+		names = append(names, check.Name)
+	}
+	return names
+}
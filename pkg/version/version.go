@@ -0,0 +1,5 @@
+// Package version exposes the version of this service, as set at build time.
+package version
+
+// Version is the version of this service, set at build time via the linker's -X flag, see Makefile.
+var Version = "unknown"